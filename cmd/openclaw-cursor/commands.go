@@ -61,10 +61,12 @@ func newModelsCmd() *cobra.Command {
 		Short: "List available Cursor models",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			jsonOut, _ := cmd.Flags().GetBool("json")
-			return runModels(jsonOut)
+			refresh, _ := cmd.Flags().GetBool("refresh")
+			return runModels(jsonOut, refresh)
 		},
 	}
 	cmd.Flags().Bool("json", false, "Output as JSON")
+	cmd.Flags().Bool("refresh", false, "Query cursor-agent for available models and update the cache")
 	return cmd
 }
 
@@ -87,3 +89,148 @@ func newVersionCmd() *cobra.Command {
 		},
 	}
 }
+
+func newOpenClawConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "openclaw-config",
+		Short: "Print or merge the OpenClaw provider config for the proxy",
+		Long: "Renders the models.providers.cursor block from the model registry. With --merge it is written\n" +
+			"into ~/.openclaw/openclaw.json (and a placeholder cursor:default auth profile is added),\n" +
+			"keeping unrelated settings and saving a timestamped backup first.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var o openClawConfigOpts
+			o.merge, _ = cmd.Flags().GetBool("merge")
+			o.dryRun, _ = cmd.Flags().GetBool("dry-run")
+			o.baseURL, _ = cmd.Flags().GetString("base-url")
+			o.models, _ = cmd.Flags().GetStringSlice("models")
+			o.primary, _ = cmd.Flags().GetString("primary")
+			o.forcePrimary = cmd.Flags().Changed("primary")
+			o.dir, _ = cmd.Flags().GetString("openclaw-dir")
+			o.agent, _ = cmd.Flags().GetString("agent")
+			return runOpenClawConfig(o)
+		},
+	}
+	cmd.Flags().Bool("merge", false, "Merge into openclaw.json and auth-profiles.json")
+	cmd.Flags().Bool("dry-run", false, "Show the diff --merge would apply without writing")
+	cmd.Flags().String("base-url", "", "Proxy base URL (default http://127.0.0.1:<port>/v1)")
+	cmd.Flags().StringSlice("models", nil, "Only include these model ids")
+	cmd.Flags().String("primary", "cursor/auto", "Default agent model; only set if none is configured unless given explicitly")
+	cmd.Flags().String("openclaw-dir", "", "OpenClaw directory (default ~/.openclaw)")
+	cmd.Flags().String("agent", "main", "Agent whose auth-profiles.json gets the placeholder profile")
+	return cmd
+}
+
+func newCronCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cron",
+		Short: "Inspect and fix OpenClaw cron jobs (~/.openclaw/cron/jobs.json)",
+	}
+	cmd.PersistentFlags().String("jobs", "", "Path to jobs.json (default $OPENCLAW_CRON_JOBS or ~/.openclaw/cron/jobs.json)")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List cron jobs with their model and delivery",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, _ := cmd.Flags().GetString("jobs")
+			jsonOut, _ := cmd.Flags().GetBool("json")
+			return runCronList(path, jsonOut)
+		},
+	}
+	list.Flags().Bool("json", false, "Output as JSON")
+
+	setModel := &cobra.Command{
+		Use:   "set-model [model]",
+		Short: "Point every agentTurn cron job at one model (default cursor/auto)",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, _ := cmd.Flags().GetString("jobs")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			model := ""
+			if len(args) > 0 {
+				model = args[0]
+			}
+			return runCronSetModel(path, model, dryRun)
+		},
+	}
+	setModel.Flags().Bool("dry-run", false, "Preview only")
+
+	fixDelivery := &cobra.Command{
+		Use:   "fix-delivery",
+		Short: "Give announce jobs an explicit Telegram channel and target",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, _ := cmd.Flags().GetString("jobs")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			to, _ := cmd.Flags().GetString("to")
+			legacyTo, _ := cmd.Flags().GetString("legacy-to")
+			return runCronFixDelivery(path, to, legacyTo, dryRun)
+		},
+	}
+	fixDelivery.Flags().Bool("dry-run", false, "Preview only")
+	fixDelivery.Flags().String("to", "", "Telegram numeric ID to deliver to (default $OPENCLAW_CRON_DEFAULT_TO)")
+	fixDelivery.Flags().String("legacy-to", "", "Legacy display-name target to replace (default $OPENCLAW_CRON_LEGACY_TO)")
+
+	cmd.AddCommand(list, setModel, fixDelivery)
+	return cmd
+}
+
+func newSnapshotsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshots",
+		Short: "List and restore workspace snapshots taken before agent runs",
+	}
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List archived snapshots (newest first)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ws, _ := cmd.Flags().GetString("workspace")
+			jsonOut, _ := cmd.Flags().GetBool("json")
+			return runSnapshotsList(ws, jsonOut)
+		},
+	}
+	list.Flags().String("workspace", "", "Only show snapshots of this workspace")
+	list.Flags().Bool("json", false, "Output as JSON")
+
+	restore := &cobra.Command{
+		Use:   "restore <id>",
+		Short: "Roll a workspace back to a snapshot",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			return runSnapshotsRestore(args[0], dryRun)
+		},
+	}
+	restore.Flags().Bool("dry-run", false, "Show what would change without touching files")
+
+	cmd.AddCommand(list, restore)
+	return cmd
+}
+
+func newPromptCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prompt",
+		Short: "Inspect the prompts sent to cursor-agent",
+	}
+
+	render := &cobra.Command{
+		Use:   "render <request.json>",
+		Short: "Print the prompt a chat completion request would produce (- reads stdin)",
+		Long: "Applies routing, system prompts, context fitting and the configured prompt template to an\n" +
+			"OpenAI chat completion request and prints the result. Attachments are not saved.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			model, _ := cmd.Flags().GetString("model")
+			ws, _ := cmd.Flags().GetString("workspace")
+			return runPromptRender(args[0], model, ws)
+		},
+	}
+	render.Flags().String("model", "", "Override the request's model")
+	render.Flags().String("workspace", "", "Workspace to match system_prompts against (default: configured workspace)")
+
+	cmd.AddCommand(render)
+	return cmd
+}
@@ -21,6 +21,10 @@ func main() {
 	root.AddCommand(newStartCmd())
 	root.AddCommand(newStopCmd())
 	root.AddCommand(newModelsCmd())
+	root.AddCommand(newOpenClawConfigCmd())
+	root.AddCommand(newCronCmd())
+	root.AddCommand(newSnapshotsCmd())
+	root.AddCommand(newPromptCmd())
 	root.AddCommand(newTestCmd())
 	root.AddCommand(newVersionCmd())
 
@@ -5,18 +5,25 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/menezmethod/openclaw-cursor/internal/agent"
 	"github.com/menezmethod/openclaw-cursor/internal/auth"
 	"github.com/menezmethod/openclaw-cursor/internal/config"
 	"github.com/menezmethod/openclaw-cursor/internal/logger"
 	"github.com/menezmethod/openclaw-cursor/internal/models"
+	"github.com/menezmethod/openclaw-cursor/internal/openclaw"
 	"github.com/menezmethod/openclaw-cursor/internal/server"
+	"github.com/menezmethod/openclaw-cursor/internal/snapshot"
+	"github.com/menezmethod/openclaw-cursor/internal/translator"
+	"github.com/menezmethod/openclaw-cursor/internal/workspace"
 )
 
 func runLogin() error {
@@ -139,23 +146,361 @@ func runStop() error {
 	return nil
 }
 
-func runModels(jsonOut bool) error {
+func runModels(jsonOut, refresh bool) error {
+	cache := models.DefaultCachePath()
+	if refresh {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if _, err := models.Refresh(ctx, agent.ListModels, cache); err != nil {
+			return err
+		}
+	} else if err := models.LoadCache(cache); err != nil && !os.IsNotExist(err) {
+		fmt.Fprintln(os.Stderr, "warning:", err)
+	}
 	list := models.ListOpenAI()
 	if jsonOut {
 		b, _ := json.MarshalIndent(list, "", "  ")
 		fmt.Println(string(b))
 		return nil
 	}
-	fmt.Printf("%-40s %s\n", "ID", "Name")
-	fmt.Println("----------------------------------------")
+	fmt.Printf("%-28s %-32s %9s %7s %s\n", "ID", "Name", "Context", "Output", "Flags")
+	fmt.Println(strings.Repeat("-", 90))
 	for _, m := range list.Data {
-		model := models.Registry[m.ID]
-		name := m.ID
-		if model.Name != "" {
-			name = model.Name
+		var flags []string
+		if m.Reasoning {
+			flags = append(flags, "reasoning")
+		}
+		if m.SupportsImages {
+			flags = append(flags, "images")
+		}
+		fmt.Printf("%-28s %-32s %9d %7d %s\n", m.ID, m.Name, m.ContextWindow, m.MaxTokens, strings.Join(flags, ","))
+	}
+	return nil
+}
+
+type openClawConfigOpts struct {
+	merge, dryRun bool
+	baseURL       string
+	models        []string
+	primary       string
+	forcePrimary  bool
+	dir, agent    string
+}
+
+func runOpenClawConfig(o openClawConfigOpts) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if o.baseURL == "" {
+		o.baseURL = fmt.Sprintf("http://127.0.0.1:%d/v1", cfg.Port)
+	}
+	if o.dir == "" {
+		o.dir = openclaw.Dir()
+	}
+	if cfg.ModelDiscovery {
+		if err := models.LoadCache(models.DefaultCachePath()); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintln(os.Stderr, "warning:", err)
+		}
+	}
+	list := models.All()
+	if len(o.models) > 0 {
+		list = list[:0:0]
+		for _, id := range o.models {
+			m, ok := models.Get(id)
+			if !ok {
+				return fmt.Errorf("unknown model %q", id)
+			}
+			list = append(list, m)
+		}
+	}
+	if o.primary != "" {
+		if _, err := models.Resolve(o.primary); err != nil {
+			return err
+		}
+	}
+
+	if !o.merge && !o.dryRun {
+		b, err := openclaw.Marshal(openclaw.Provider(o.baseURL, list))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Add this to %s under \"models\" -> \"providers\" -> \"cursor\"\n", openclaw.ConfigPath(o.dir))
+		fmt.Println("(or run 'openclaw-cursor openclaw-config --merge'):")
+		fmt.Println()
+		fmt.Print(string(b))
+		return nil
+	}
+
+	edits, err := openclaw.PlanConfig(openclaw.ConfigOptions{
+		Dir:          o.dir,
+		Agent:        o.agent,
+		BaseURL:      o.baseURL,
+		Models:       list,
+		Primary:      o.primary,
+		ForcePrimary: o.forcePrimary,
+	})
+	if err != nil {
+		return err
+	}
+	return applyEdits(edits, o.dryRun)
+}
+
+// applyEdits prints (dry run) or writes OpenClaw file edits.
+func applyEdits(edits []*openclaw.Edit, dryRun bool) error {
+	for _, e := range edits {
+		if !e.Changed() {
+			fmt.Println("Up to date:", e.Path)
+			continue
+		}
+		if dryRun {
+			fmt.Print(e.Diff())
+			continue
+		}
+		backup, err := e.Apply()
+		if err != nil {
+			return err
+		}
+		if backup != "" {
+			fmt.Println("Backup written to", backup)
+		}
+		fmt.Println("Updated", e.Path)
+	}
+	if dryRun {
+		fmt.Println("[dry-run] Nothing written. Run without --dry-run to apply.")
+	}
+	return nil
+}
+
+func cronJobsPath(path string) string {
+	if path == "" {
+		return openclaw.CronJobsPath()
+	}
+	return workspace.ExpandHome(path)
+}
+
+func runCronList(path string, jsonOut bool) error {
+	path = cronJobsPath(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cron jobs file not found: %s", path)
+	}
+	root, err := openclaw.DecodeObject(data)
+	if err != nil {
+		return fmt.Errorf("invalid JSON in %s: %w", path, err)
+	}
+	jobs, err := openclaw.ListCronJobs(root)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if jsonOut {
+		b, _ := json.MarshalIndent(jobs, "", "  ")
+		fmt.Println(string(b))
+		return nil
+	}
+	fmt.Printf("%-32s %-8s %-28s %s\n", "Name", "Enabled", "Model", "Delivery")
+	fmt.Println(strings.Repeat("-", 90))
+	for _, j := range jobs {
+		enabled := "-"
+		if j.Enabled != nil {
+			enabled = strconv.FormatBool(*j.Enabled)
+		}
+		model := j.Model
+		if model == "" {
+			model = j.Kind
+		}
+		fmt.Printf("%-32s %-8s %-28s %s\n", j.Name, enabled, model, j.Delivery)
+	}
+	return nil
+}
+
+func runCronSetModel(path, model string, dryRun bool) error {
+	if model == "" {
+		model = openclaw.DefaultCronModel
+	}
+	// Validate against the proxy's models, but keep aliases as given so
+	// repointing an alias in the proxy config also moves these jobs.
+	if err := models.LoadCache(models.DefaultCachePath()); err != nil && !os.IsNotExist(err) {
+		fmt.Fprintln(os.Stderr, "warning:", err)
+	}
+	if cfg, err := config.Load(); err == nil {
+		models.SetAliases(cfg.ModelAliases)
+	}
+	if _, err := models.Resolve(model); err != nil {
+		return err
+	}
+	model = openclaw.ProviderName + "/" + models.StripPrefix(model)
+
+	edit, changes, err := openclaw.PlanCron(cronJobsPath(path), func(root *openclaw.Object) ([]openclaw.CronChange, error) {
+		return openclaw.SetCronModel(root, model)
+	})
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		fmt.Printf("Set model: %s (%s)\n", c.Job, c.Detail)
+	}
+	if len(changes) == 0 {
+		fmt.Printf("No jobs needed updates (all already %s).\n", model)
+		return nil
+	}
+	return applyCronEdit(edit, len(changes), dryRun)
+}
+
+func runCronFixDelivery(path, to, legacyTo string, dryRun bool) error {
+	if to == "" {
+		to = os.Getenv("OPENCLAW_CRON_DEFAULT_TO")
+	}
+	if legacyTo == "" {
+		legacyTo = os.Getenv("OPENCLAW_CRON_LEGACY_TO")
+	}
+	opts := openclaw.DeliveryOptions{DefaultTo: to, LegacyTo: legacyTo}
+	if opts.DefaultTo == "" {
+		return fmt.Errorf("set --to (or OPENCLAW_CRON_DEFAULT_TO) to your Telegram numeric ID")
+	}
+	edit, changes, err := openclaw.PlanCron(cronJobsPath(path), func(root *openclaw.Object) ([]openclaw.CronChange, error) {
+		return openclaw.FixCronDelivery(root, opts)
+	})
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		fmt.Println("Fixed:", c.Job)
+	}
+	if len(changes) == 0 {
+		fmt.Println("No jobs needed updates.")
+		return nil
+	}
+	return applyCronEdit(edit, len(changes), dryRun)
+}
+
+func applyCronEdit(edit *openclaw.Edit, n int, dryRun bool) error {
+	if dryRun {
+		fmt.Printf("[dry-run] Would update %d job(s). Run without --dry-run to apply.\n", n)
+		return nil
+	}
+	backup, err := edit.Apply()
+	if err != nil {
+		return err
+	}
+	fmt.Println("Backup written to", backup)
+	fmt.Println("Total updated:", n)
+	return nil
+}
+
+func openSnapshotArchive() (*snapshot.Archive, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.OpenConfigured(cfg, snapshot.OptionsFromConfig(cfg))
+}
+
+func runSnapshotsList(ws string, jsonOut bool) error {
+	archive, err := openSnapshotArchive()
+	if err != nil {
+		return err
+	}
+	if ws != "" {
+		if ws, err = workspace.Canonicalize(ws, "."); err != nil {
+			return err
 		}
-		fmt.Printf("%-40s %s\n", m.ID, name)
 	}
+	list, err := archive.List(ws)
+	if err != nil {
+		return err
+	}
+	if jsonOut {
+		b, _ := json.MarshalIndent(list, "", "  ")
+		fmt.Println(string(b))
+		return nil
+	}
+	if len(list) == 0 {
+		fmt.Println("No snapshots.")
+		return nil
+	}
+	fmt.Printf("%-25s %-20s %6s  %s\n", "ID", "Created", "Files", "Workspace")
+	for _, m := range list {
+		note := ""
+		if m.Reason != "" {
+			note = " (" + m.Reason + ")"
+		}
+		fmt.Printf("%-25s %-20s %6d  %s%s\n", m.ID, m.Created.Local().Format("2006-01-02 15:04:05"), m.FileCount, m.Workspace, note)
+	}
+	return nil
+}
+
+func runSnapshotsRestore(id string, dryRun bool) error {
+	archive, err := openSnapshotArchive()
+	if err != nil {
+		return err
+	}
+	res, err := archive.Restore(id, dryRun)
+	if err != nil {
+		return err
+	}
+	prefix := ""
+	if dryRun {
+		prefix = "[dry-run] would "
+	}
+	for _, p := range res.Restored {
+		fmt.Printf("%srestore %s\n", prefix, p)
+	}
+	for _, p := range res.Deleted {
+		fmt.Printf("%sdelete  %s\n", prefix, p)
+	}
+	for _, p := range res.Skipped {
+		fmt.Printf("skip    %s (too large, content not archived)\n", p)
+	}
+	if len(res.Restored) == 0 && len(res.Deleted) == 0 {
+		fmt.Println("Workspace already matches snapshot", id)
+		return nil
+	}
+	if res.Backup != "" {
+		fmt.Println("Previous state saved as snapshot", res.Backup)
+	}
+	return nil
+}
+
+func runPromptRender(path, model, ws string) error {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	var req translator.ChatCompletionRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	if model != "" {
+		req.Model = model
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if ws == "" {
+		ws = cfg.Workspace
+	}
+	if ws == "" {
+		ws = "."
+	}
+	if ws, err = workspace.Canonicalize(ws, "."); err != nil {
+		return err
+	}
+	srv := server.New(cfg, logger.New("warn"), version)
+	modelID, prompt, err := srv.PreviewPrompt(req, ws)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "model: %s\nworkspace: %s\n\n", modelID, ws)
+	fmt.Println(prompt)
 	return nil
 }
 
@@ -2,12 +2,18 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/menezmethod/openclaw-cursor/internal/models"
 )
 
 // Options for spawning cursor-agent.
@@ -24,6 +30,8 @@ type Process struct {
 	stdout io.Reader
 	stderr io.Reader
 	cancel context.CancelFunc
+	// release frees the Limiter slot the process holds, if any.
+	release func()
 }
 
 // Stdout returns the process stdout reader.
@@ -42,11 +50,17 @@ func (p *Process) Wait() error {
 	if p.cancel != nil {
 		p.cancel()
 	}
+	if p.release != nil {
+		p.release()
+	}
 	return err
 }
 
 // Kill terminates the process.
 func (p *Process) Kill() error {
+	if p.release != nil {
+		p.release()
+	}
 	if p.cmd.Process != nil {
 		return p.cmd.Process.Kill()
 	}
@@ -110,18 +124,22 @@ func Spawn(ctx context.Context, opts Options) (*Process, error) {
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
+		cancel()
 		return nil, fmt.Errorf("stdin pipe: %w", err)
 	}
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
+		cancel()
 		return nil, fmt.Errorf("stdout pipe: %w", err)
 	}
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
+		cancel()
 		return nil, fmt.Errorf("stderr pipe: %w", err)
 	}
 
 	if err := cmd.Start(); err != nil {
+		cancel()
 		return nil, fmt.Errorf("start cursor-agent: %w", err)
 	}
 
@@ -138,3 +156,118 @@ func Spawn(ctx context.Context, opts Options) (*Process, error) {
 		cancel: cancel,
 	}, nil
 }
+
+// Limiter caps how many cursor-agent processes run at once.
+type Limiter struct {
+	slots chan struct{}
+}
+
+// NewLimiter returns a Limiter for n processes, or nil (no limit) when n is
+// not positive.
+func NewLimiter(n int) *Limiter {
+	if n <= 0 {
+		return nil
+	}
+	return &Limiter{slots: make(chan struct{}, n)}
+}
+
+// ErrBusy is returned by TrySpawn when every slot is taken.
+var ErrBusy = errors.New("no free cursor-agent slot")
+
+// Spawn waits for a free slot, or for ctx to end, and starts cursor-agent.
+// The slot is freed once the process is waited for or killed. A nil Limiter
+// spawns right away.
+func (l *Limiter) Spawn(ctx context.Context, opts Options) (*Process, error) {
+	if l == nil {
+		return Spawn(ctx, opts)
+	}
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for a cursor-agent slot: %w", ctx.Err())
+	}
+	return l.start(ctx, opts)
+}
+
+// TrySpawn is Spawn for optional runs: it fails with ErrBusy instead of
+// waiting for a slot.
+func (l *Limiter) TrySpawn(ctx context.Context, opts Options) (*Process, error) {
+	if l == nil {
+		return Spawn(ctx, opts)
+	}
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		return nil, ErrBusy
+	}
+	return l.start(ctx, opts)
+}
+
+// start spawns cursor-agent in a slot already taken.
+func (l *Limiter) start(ctx context.Context, opts Options) (*Process, error) {
+	p, err := Spawn(ctx, opts)
+	if err != nil {
+		<-l.slots
+		return nil, err
+	}
+	p.release = sync.OnceFunc(func() { <-l.slots })
+	return p, nil
+}
+
+// InUse is the number of processes currently holding a slot.
+func (l *Limiter) InUse() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.slots)
+}
+
+var ansiRegex = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// modelLine matches lines like "gpt-5.3-codex - GPT-5.3 Codex", "* auto (current)"
+// or a bare id.
+var modelLine = regexp.MustCompile(`^[\s*•>-]*([a-z0-9][a-z0-9._-]*[a-z0-9])(?:(?:\s+[-–—]|\s*:)\s+(.+?))?(?:\s+\((?:current|default)\))?\s*$`)
+
+// ListModels asks cursor-agent which models the account can use.
+// Newer CLIs expose `cursor-agent models`; older ones `--list-models`.
+func ListModels(ctx context.Context) ([]models.Model, error) {
+	bin, err := FindBinary()
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for _, args := range [][]string{{"models"}, {"--list-models"}} {
+		out, err := exec.CommandContext(ctx, bin, args...).Output()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if list := ParseModelList(string(out)); len(list) > 0 {
+			return list, nil
+		}
+		lastErr = fmt.Errorf("no models in cursor-agent %s output", args[0])
+	}
+	return nil, fmt.Errorf("list cursor-agent models: %w", lastErr)
+}
+
+// ParseModelList extracts model ids (and display names when present) from
+// cursor-agent's human-readable model listing.
+func ParseModelList(out string) []models.Model {
+	var list []models.Model
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(ansiRegex.ReplaceAllString(out, ""), "\n") {
+		m := modelLine.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil || seen[m[1]] || !strings.ContainsAny(m[1], "abcdefghijklmnopqrstuvwxyz") {
+			continue
+		}
+		// A bare single word is only trusted if we already know it; this skips
+		// stray prose such as "loading".
+		if _, known := models.Registry[m[1]]; m[2] == "" && !known && !strings.ContainsAny(m[1], "-.0123456789") {
+			continue
+		}
+		seen[m[1]] = true
+		name := strings.TrimSpace(m[2])
+		list = append(list, models.Model{ID: m[1], Name: name})
+	}
+	return list
+}
@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseModelList(t *testing.T) {
+	out := "\x1b[1mAvailable models\x1b[0m\n\n" +
+		"auto - Auto (current)\n" +
+		"* gpt-5.3-codex - GPT-5.3 Codex\n" +
+		"  sonnet-4.5-thinking\n" +
+		"gemini-3-pro: Gemini 3 Pro\n" +
+		"composer-1\n" +
+		"loading\n" +
+		"Tip: use --model <id> to pick one\n" +
+		"auto\n"
+	got := ParseModelList(out)
+	ids := make([]string, len(got))
+	for i, m := range got {
+		ids[i] = m.ID
+	}
+	assert.Equal(t, []string{"auto", "gpt-5.3-codex", "sonnet-4.5-thinking", "gemini-3-pro", "composer-1"}, ids)
+	assert.Equal(t, "Auto", got[0].Name)
+	assert.Equal(t, "GPT-5.3 Codex", got[1].Name)
+	assert.Equal(t, "", got[2].Name)
+	assert.Equal(t, "Gemini 3 Pro", got[3].Name)
+}
+
+func TestLimiter(t *testing.T) {
+	assert.Nil(t, NewLimiter(0))
+	dir := t.TempDir()
+	script := "#!/bin/sh\ncat > /dev/null\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cursor-agent"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	l := NewLimiter(1)
+	p, err := l.Spawn(context.Background(), Options{Prompt: "hi"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, l.InUse())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = l.Spawn(ctx, Options{Prompt: "hi"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "no slot is free")
+
+	require.NoError(t, p.Wait())
+	_ = p.Kill()
+	assert.Equal(t, 0, l.InUse(), "the slot is freed once, on exit")
+	p, err = l.Spawn(context.Background(), Options{Prompt: "hi"})
+	require.NoError(t, err)
+	require.NoError(t, p.Wait())
+}
+
+func TestRace(t *testing.T) {
+	dir := t.TempDir()
+	// The prompt says how long to wait before printing output, "fail", or
+	// "loud" (fill the stderr pipe first).
+	script := "#!/bin/sh\nread p\necho setup\necho \"stderr $p\" >&2\n[ \"$p\" = fail ] && exit 1\n" +
+		"[ \"$p\" = loud ] && head -c 100000 /dev/zero >&2 && p=0\nsleep \"$p\"\necho \"output after $p\"\necho done\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cursor-agent"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	start := func(prompt string) func() (*Process, error) {
+		return func() (*Process, error) { return Spawn(context.Background(), Options{Prompt: prompt + "\n"}) }
+	}
+	output := func(line []byte) bool { return strings.HasPrefix(string(line), "output") }
+	var stderr []byte
+	run := func(delay time.Duration, prompts ...string) (int, int, string) {
+		race := Race{Delay: delay, Output: output}
+		for _, p := range prompts {
+			race.Start = append(race.Start, start(p))
+		}
+		winner, started, p, err := race.Run(context.Background())
+		require.NoError(t, err)
+		out, err := io.ReadAll(p.Stdout())
+		require.NoError(t, err)
+		stderr, err = io.ReadAll(p.Stderr())
+		require.NoError(t, err)
+		_ = p.Wait()
+		return winner, started, string(out)
+	}
+
+	winner, started, out := run(10*time.Millisecond, "2", "0")
+	assert.Equal(t, 1, winner, "the hedge is faster")
+	assert.Equal(t, 2, started)
+	assert.Equal(t, "setup\noutput after 0\ndone\n", out, "output read during the race is replayed")
+	assert.Equal(t, "stderr 0\n", string(stderr), "the winner's stderr is kept")
+
+	winner, started, _ = run(time.Second, "0", "0")
+	assert.Equal(t, 0, winner)
+	assert.Equal(t, 1, started, "no hedge when the first candidate answers within the delay")
+
+	winner, started, _ = run(time.Minute, "fail", "0")
+	assert.Equal(t, 1, winner, "a failed candidate launches the next without waiting")
+	assert.Equal(t, 2, started)
+
+	winner, _, out = run(time.Minute, "fail", "fail")
+	assert.Equal(t, 0, winner, "without output the first candidate is reported")
+	assert.Equal(t, "setup\n", out)
+	assert.Equal(t, "stderr fail\n", string(stderr))
+
+	winner, _, out = run(time.Minute, "loud")
+	assert.Equal(t, 0, winner)
+	assert.Equal(t, "setup\noutput after 0\ndone\n", out, "stderr is drained while racing")
+	assert.Len(t, stderr, len("stderr loud\n")+100000)
+}
@@ -0,0 +1,164 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Race runs cursor-agent candidates against each other (hedged requests).
+// The first candidate starts at once; each further one starts after Delay
+// more without output, or as soon as every running candidate has ended
+// without any. The first candidate whose stdout has a line for which Output
+// is true wins and the others are killed. Every candidate's stderr is read
+// while it runs, so a chatty loser can't block on a full pipe; the winner's
+// is handed back for error reporting.
+type Race struct {
+	// Start launches candidate i.
+	Start []func() (*Process, error)
+	Delay time.Duration
+	// Output reports whether a line of stdout is generated output, as
+	// opposed to setup events.
+	Output func(line []byte) bool
+}
+
+// racer is one started candidate.
+type racer struct {
+	proc *Process
+	r    *bufio.Reader
+	// read is what was read from stdout while racing.
+	read bytes.Buffer
+	done chan struct{}
+	// stderr collects the candidate's stderr until errDone is closed.
+	stderr  bytes.Buffer
+	errDone chan struct{}
+}
+
+// drained reads a racer's stderr once the process has closed it.
+type drained struct {
+	rc *racer
+}
+
+func (d drained) Read(p []byte) (int, error) {
+	<-d.rc.errDone
+	return d.rc.stderr.Read(p)
+}
+
+// stop kills a losing candidate and reaps it.
+func (rc *racer) stop() {
+	_ = rc.proc.Kill()
+	<-rc.done
+	<-rc.errDone
+	_ = rc.proc.Wait()
+}
+
+// Run returns the index and process of the winner; its Stdout replays what
+// was read during the race. If no candidate produced output, the first one
+// that started is returned so its output and exit status can be reported.
+// Started is how many candidates were launched.
+func (race Race) Run(ctx context.Context) (winner, started int, p *Process, err error) {
+	type result struct {
+		i      int
+		output bool
+	}
+	results := make(chan result, len(race.Start))
+	racers := make([]*racer, len(race.Start))
+	running := 0
+	var startErr error
+
+	// launch starts the next candidate, skipping those that fail to start.
+	launch := func() {
+		for started < len(race.Start) {
+			i := started
+			started++
+			proc, err := race.Start[i]()
+			if err != nil {
+				if startErr == nil {
+					startErr = err
+				}
+				continue
+			}
+			rc := &racer{proc: proc, r: bufio.NewReader(proc.stdout), done: make(chan struct{}), errDone: make(chan struct{})}
+			racers[i] = rc
+			running++
+			go func(stderr io.Reader) {
+				defer close(rc.errDone)
+				_, _ = io.Copy(&rc.stderr, stderr)
+			}(proc.stderr)
+			go func() {
+				defer close(rc.done)
+				for {
+					line, err := rc.r.ReadBytes('\n')
+					rc.read.Write(line)
+					if len(line) > 0 && race.Output(line) {
+						results <- result{i, true}
+						return
+					}
+					if err != nil {
+						results <- result{i, false}
+						return
+					}
+				}
+			}()
+			return
+		}
+	}
+
+	// finish hands racers[i] to the caller and stops the others.
+	finish := func(i int) (int, int, *Process, error) {
+		for j, rc := range racers {
+			if rc == nil || j == i {
+				continue
+			}
+			go rc.stop()
+		}
+		rc := racers[i]
+		rc.proc.stdout = io.MultiReader(bytes.NewReader(rc.read.Bytes()), rc.r)
+		rc.proc.stderr = drained{rc}
+		return i, started, rc.proc, nil
+	}
+
+	launch()
+	timer := time.NewTimer(race.Delay)
+	defer timer.Stop()
+	for {
+		if running == 0 {
+			if started < len(race.Start) {
+				// Everything started so far has ended without output.
+				launch()
+				continue
+			}
+			for i, rc := range racers {
+				if rc != nil {
+					return finish(i)
+				}
+			}
+			if startErr == nil {
+				startErr = fmt.Errorf("no candidates to run")
+			}
+			return -1, started, nil, startErr
+		}
+		select {
+		case res := <-results:
+			if res.output {
+				return finish(res.i)
+			}
+			running--
+		case <-timer.C:
+			launch()
+			if started < len(race.Start) {
+				timer.Reset(race.Delay)
+			}
+		case <-ctx.Done():
+			for _, rc := range racers {
+				if rc != nil {
+					go rc.stop()
+				}
+			}
+			return -1, started, nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Package attachments loads the image and file parts of chat messages so
+// they can be handed to cursor-agent as files in the workspace.
+package attachments
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/menezmethod/openclaw-cursor/internal/workspace"
+)
+
+// DefaultMaxBytes caps a single attachment when Options.MaxBytes is unset.
+const DefaultMaxBytes = 20 << 20
+
+var (
+	// ErrRemoteNotAllowed is returned for http(s) URLs unless AllowRemote is set.
+	ErrRemoteNotAllowed = errors.New("remote attachment URLs are not allowed")
+	// ErrLocalNotAllowed is returned for local paths outside the allowed roots.
+	ErrLocalNotAllowed = errors.New("local file is outside the allowed attachment roots")
+	// ErrTooLarge is returned when an attachment exceeds MaxBytes.
+	ErrTooLarge = errors.New("attachment too large")
+)
+
+// Options limit where attachments may come from.
+type Options struct {
+	// AllowRemote permits fetching http(s) URLs.
+	AllowRemote bool
+	// LocalRoots are the directories local file references must be inside.
+	LocalRoots []string
+	MaxBytes   int64
+	// Client fetches remote URLs; nil uses a client with a 30s timeout.
+	Client *http.Client
+}
+
+// File is a loaded attachment.
+type File struct {
+	// Name is a file name with an extension that matches the content.
+	Name string
+	MIME string
+	Data []byte
+}
+
+// Load resolves ref, which is a data: URL, a file:// URL or absolute path,
+// an http(s) URL, or bare base64 (as in file parts). name is a suggested
+// file name, used when ref doesn't carry one.
+func Load(ctx context.Context, ref, name string, opts Options) (*File, error) {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultMaxBytes
+	}
+	ref = strings.TrimSpace(ref)
+	var f *File
+	var err error
+	switch {
+	case strings.HasPrefix(ref, "data:"):
+		f, err = decodeDataURL(ref)
+	case strings.HasPrefix(ref, "http://"), strings.HasPrefix(ref, "https://"):
+		f, err = fetch(ctx, ref, opts)
+	case strings.HasPrefix(ref, "file://"), filepath.IsAbs(ref), strings.HasPrefix(ref, "~/"):
+		f, err = readLocal(ref, opts)
+	default:
+		f, err = decodeBase64(ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(f.Data)) > opts.MaxBytes {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", ErrTooLarge, len(f.Data), opts.MaxBytes)
+	}
+	if name != "" {
+		f.Name = name
+	}
+	if f.MIME == "" || f.MIME == "application/octet-stream" {
+		f.MIME = http.DetectContentType(f.Data)
+	}
+	f.Name = withExtension(f.Name, f.MIME)
+	return f, nil
+}
+
+func decodeDataURL(ref string) (*File, error) {
+	meta, payload, ok := strings.Cut(strings.TrimPrefix(ref, "data:"), ",")
+	if !ok {
+		return nil, fmt.Errorf("malformed data URL")
+	}
+	params := strings.Split(meta, ";")
+	f := &File{MIME: strings.ToLower(params[0])}
+	isBase64 := false
+	for _, p := range params[1:] {
+		if p == "base64" {
+			isBase64 = true
+		}
+	}
+	if isBase64 {
+		data, err := decodeB64(payload)
+		if err != nil {
+			return nil, fmt.Errorf("malformed data URL: %w", err)
+		}
+		f.Data = data
+	} else {
+		s, err := url.PathUnescape(payload)
+		if err != nil {
+			return nil, fmt.Errorf("malformed data URL: %w", err)
+		}
+		f.Data = []byte(s)
+	}
+	return f, nil
+}
+
+func decodeBase64(s string) (*File, error) {
+	data, err := decodeB64(s)
+	if err != nil {
+		return nil, fmt.Errorf("attachment is neither a URL nor base64 data")
+	}
+	return &File{Data: data}, nil
+}
+
+func decodeB64(s string) ([]byte, error) {
+	s = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, s)
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if data, err := enc.DecodeString(s); err == nil {
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid base64")
+}
+
+func readLocal(ref string, opts Options) (*File, error) {
+	p := ref
+	if strings.HasPrefix(ref, "file://") {
+		u, err := url.Parse(ref)
+		if err != nil {
+			return nil, fmt.Errorf("malformed file URL: %w", err)
+		}
+		p = u.Path
+	}
+	p, err := workspace.Canonicalize(p, "/")
+	if err != nil {
+		return nil, err
+	}
+	allowed := false
+	for _, root := range opts.LocalRoots {
+		if r, err := workspace.Canonicalize(root, "/"); err == nil && workspace.Within(p, r) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("%w: %s", ErrLocalNotAllowed, p)
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", p)
+	}
+	if info.Size() > opts.MaxBytes {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", ErrTooLarge, info.Size(), opts.MaxBytes)
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	return &File{Name: filepath.Base(p), MIME: mime.TypeByExtension(filepath.Ext(p)), Data: data}, nil
+}
+
+func fetch(ctx context.Context, ref string, opts Options) (*File, error) {
+	if !opts.AllowRemote {
+		return nil, ErrRemoteNotAllowed
+	}
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ref, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch attachment: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch attachment: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, opts.MaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetch attachment: %w", err)
+	}
+	f := &File{Data: data, Name: path.Base(req.URL.Path)}
+	if ct, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		f.MIME = ct
+	}
+	return f, nil
+}
+
+// extensions for common types; mime.ExtensionsByType order varies by system.
+var extensions = map[string]string{
+	"image/png":        ".png",
+	"image/jpeg":       ".jpg",
+	"image/gif":        ".gif",
+	"image/webp":       ".webp",
+	"application/pdf":  ".pdf",
+	"text/plain":       ".txt",
+	"application/json": ".json",
+}
+
+// withExtension gives a name without an extension one that matches
+// mimeType, so cursor-agent can tell what the file is.
+func withExtension(name, mimeType string) string {
+	if name == "" || name == "." || name == "/" {
+		name = "attachment"
+	}
+	if filepath.Ext(name) != "" {
+		return name
+	}
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	ext, ok := extensions[mimeType]
+	if !ok {
+		if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	return name + ext
+}
+
+// IsImage reports whether the attachment is an image.
+func (f *File) IsImage() bool {
+	return strings.HasPrefix(f.MIME, "image/")
+}
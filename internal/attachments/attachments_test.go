@@ -0,0 +1,93 @@
+package attachments
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// png is the 8-byte PNG signature, enough for content sniffing.
+var png = []byte("\x89PNG\r\n\x1a\n")
+
+func TestLoad_DataURL(t *testing.T) {
+	ref := "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+	f, err := Load(context.Background(), ref, "", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "attachment.png", f.Name)
+	assert.Equal(t, "image/png", f.MIME)
+	assert.Equal(t, png, f.Data)
+	assert.True(t, f.IsImage())
+
+	f, err = Load(context.Background(), "data:text/plain,hello%20there", "notes", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "notes.txt", f.Name)
+	assert.Equal(t, "hello there", string(f.Data))
+
+	_, err = Load(context.Background(), "data:image/png;base64", "", Options{})
+	assert.Error(t, err)
+}
+
+func TestLoad_Base64(t *testing.T) {
+	f, err := Load(context.Background(), base64.StdEncoding.EncodeToString([]byte("%PDF-1.4\n")), "report.pdf", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "report.pdf", f.Name)
+	assert.Equal(t, "application/pdf", f.MIME)
+
+	_, err = Load(context.Background(), "not base64 at all!", "", Options{})
+	assert.Error(t, err)
+}
+
+func TestLoad_Local(t *testing.T) {
+	root := t.TempDir()
+	p := filepath.Join(root, "shot.png")
+	require.NoError(t, os.WriteFile(p, png, 0o644))
+
+	f, err := Load(context.Background(), p, "", Options{LocalRoots: []string{root}})
+	require.NoError(t, err)
+	assert.Equal(t, "shot.png", f.Name)
+	assert.True(t, f.IsImage())
+
+	f, err = Load(context.Background(), "file://"+p, "", Options{LocalRoots: []string{root}})
+	require.NoError(t, err)
+	assert.Equal(t, png, f.Data)
+
+	_, err = Load(context.Background(), p, "", Options{LocalRoots: []string{t.TempDir()}})
+	assert.ErrorIs(t, err, ErrLocalNotAllowed)
+	_, err = Load(context.Background(), filepath.Join(root, "..", filepath.Base(root), "shot.png"), "", Options{})
+	assert.ErrorIs(t, err, ErrLocalNotAllowed)
+
+	_, err = Load(context.Background(), p, "", Options{LocalRoots: []string{root}, MaxBytes: 4})
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
+
+func TestLoad_Remote(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(png)
+	}))
+	defer ts.Close()
+
+	_, err := Load(context.Background(), ts.URL+"/img", "", Options{})
+	assert.ErrorIs(t, err, ErrRemoteNotAllowed)
+
+	f, err := Load(context.Background(), ts.URL+"/img", "", Options{AllowRemote: true})
+	require.NoError(t, err)
+	assert.Equal(t, "img.png", f.Name)
+	assert.Equal(t, "image/png", f.MIME)
+
+	_, err = Load(context.Background(), ts.URL+"/missing", "", Options{AllowRemote: true})
+	assert.Error(t, err)
+	_, err = Load(context.Background(), ts.URL+"/img", "", Options{AllowRemote: true, MaxBytes: 4})
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
@@ -35,6 +35,182 @@ type Config struct {
 	DefaultModel           string `json:"default_model"`
 	EnableThinking         bool   `json:"enable_thinking"`
 	MaxToolLoopIterations  int    `json:"max_tool_loop_iterations"`
+	// MaxToolCallRepeats is how many times the same tool call may repeat
+	// before the loop guard stops the turn.
+	MaxToolCallRepeats int `json:"max_tool_call_repeats"`
+
+	// ModelDiscovery asks cursor-agent for its model list at startup and every
+	// ModelRefreshMinutes, merging the result with the built-in registry.
+	ModelDiscovery      bool `json:"model_discovery"`
+	ModelRefreshMinutes int  `json:"model_refresh_minutes"`
+	// ModelAliases maps team-level names (e.g. "fast") to model ids.
+	ModelAliases map[string]string `json:"model_aliases"`
+	ModelRoutes  []ModelRoute      `json:"model_routes"`
+	// SystemPrompt is added to every request's instructions, ahead of the
+	// client's system and developer messages.
+	SystemPrompt string `json:"system_prompt"`
+	// SystemPrompts add instructions for particular models or workspaces.
+	SystemPrompts []SystemPromptRule `json:"system_prompts"`
+	// PromptTemplates replace the built-in prompt format.
+	PromptTemplates PromptTemplates `json:"prompt_templates"`
+	// ContextWindow keeps prompts within the target model's context window.
+	ContextWindow ContextWindow `json:"context_window"`
+	// ToolResults moves large tool results out of the prompt into files.
+	ToolResults ToolResults `json:"tool_results"`
+	// Attachments controls image and file parts in messages.
+	Attachments Attachments `json:"attachments"`
+	// StructuredOutputRetries is how many times a reply that doesn't match
+	// response_format is sent back to the model before giving up.
+	StructuredOutputRetries int `json:"structured_output_retries"`
+	// MaxChoices caps the n a request may ask for; each choice is a separate
+	// cursor-agent run.
+	MaxChoices int `json:"max_choices"`
+	// MaxConcurrentAgents caps how many cursor-agent processes run at once
+	// across all requests; further runs wait for a slot. 0 is unlimited.
+	MaxConcurrentAgents int `json:"max_concurrent_agents"`
+	// Hedges race a second run against the first for requests to the given
+	// model names or aliases, to cut tail latency. Only requests isolated
+	// per request are hedged, each candidate in its own copy.
+	Hedges map[string]Hedge `json:"hedges"`
+
+	// WorkspaceRoots restricts x-openclaw-workspace to these directories.
+	WorkspaceRoots         []string  `json:"workspace_roots"`
+	RequireWorkspaceExists bool      `json:"require_workspace_exists"`
+	RequireGitWorkspace    bool      `json:"require_git_workspace"`
+	Isolation              Isolation `json:"isolation"`
+	// WorkspaceLock is off, serialize, reject or shared-read.
+	WorkspaceLock string       `json:"workspace_lock"`
+	ChangeReport  ChangeReport `json:"change_report"`
+	Snapshots     Snapshots    `json:"snapshots"`
+
+	CommandPolicy CommandPolicy `json:"command_policy"`
+}
+
+// Isolation runs cursor-agent in a git worktree (or a plain copy for non-git
+// directories) instead of the real workspace. Mode is off, request or session.
+type Isolation struct {
+	Mode          string `json:"mode"`
+	Dir           string `json:"dir"`
+	KeepWorktree  bool   `json:"keep_worktree"`
+	MaxAgeMinutes int    `json:"max_age_minutes"`
+	MaxDiffBytes  int    `json:"max_diff_bytes"`
+	// MaxCopyFiles and MaxCopyBytes cap the plain copy of a non-git
+	// workspace; 0 means no cap.
+	MaxCopyFiles int   `json:"max_copy_files"`
+	MaxCopyBytes int64 `json:"max_copy_bytes"`
+}
+
+// ChangeReport snapshots the workspace before and after each run and reports
+// the files cursor-agent created, modified or deleted.
+type ChangeReport struct {
+	Enabled       bool  `json:"enabled"`
+	MaxFiles      int   `json:"max_files"`
+	MaxFileBytes  int64 `json:"max_file_bytes"`
+	MaxTotalBytes int64 `json:"max_total_bytes"`
+	MaxDiffBytes  int   `json:"max_diff_bytes"`
+}
+
+// Snapshots archives the pre-run state of the workspace whenever a run
+// changes files, so it can be restored later. Capture limits are shared with
+// ChangeReport.
+type Snapshots struct {
+	Enabled       bool   `json:"enabled"`
+	Dir           string `json:"dir"`
+	MaxSnapshots  int    `json:"max_snapshots"`
+	MaxAgeHours   int    `json:"max_age_hours"`
+	MaxStoreBytes int64  `json:"max_store_bytes"`
+}
+
+// CommandPolicy configures checks on shell commands run by cursor-agent.
+// Mode is off, audit (log only) or enforce.
+type CommandPolicy struct {
+	Mode          string        `json:"mode"`
+	DefaultAction string        `json:"default_action"`
+	Rules         []CommandRule `json:"rules"`
+	AuditLog      string        `json:"audit_log"`
+}
+
+// CommandRule matches a command; every criterion set on the rule must match.
+// Action is allow, deny or approve (bounce to OpenClaw).
+type CommandRule struct {
+	Name         string   `json:"name"`
+	Action       string   `json:"action"`
+	Pattern      string   `json:"pattern,omitempty"`
+	Preset       string   `json:"preset,omitempty"`
+	PathPrefixes []string `json:"path_prefixes,omitempty"`
+}
+
+// ContextWindow decides what happens when a prompt would not fit the model.
+// Strategy is off (default), reject (context_length_exceeded), truncate
+// (elide large tool results) or drop_oldest (drop the oldest turns, keeping
+// system and recent messages). ReserveTokens is held back for the
+// response; 0 uses the request's max_tokens or the model's output limit.
+type ContextWindow struct {
+	Strategy            string `json:"strategy"`
+	KeepRecent          int    `json:"keep_recent"`
+	MaxToolResultTokens int    `json:"max_tool_result_tokens"`
+	ReserveTokens       int    `json:"reserve_tokens"`
+}
+
+// ToolResults writes tool results larger than SpillTokens to a file in the
+// workspace and leaves ExcerptTokens of it (head and tail) and the file's
+// path in the prompt; SpillTokens 0 (the default) turns this off. Files of
+// an OpenClaw session are kept for its later turns and removed once the
+// session has been idle for SessionTTLMinutes; others are removed after the
+// request.
+type ToolResults struct {
+	SpillTokens       int `json:"spill_tokens"`
+	ExcerptTokens     int `json:"excerpt_tokens"`
+	SessionTTLMinutes int `json:"session_ttl_minutes"`
+}
+
+// Hedge is a hedged request: Models are the candidates in launch order
+// (default: the requested model twice). Each further candidate starts after
+// DelayMs without output from the ones already running; the first to
+// produce output is used and the rest are stopped.
+type Hedge struct {
+	Models  []string `json:"models,omitempty"`
+	DelayMs int      `json:"delay_ms"`
+}
+
+// Attachments controls where image and file parts may come from. Data URLs
+// are always accepted; local paths must be inside the workspace or
+// LocalRoots; http(s) URLs are fetched only with AllowRemote.
+type Attachments struct {
+	AllowRemote bool     `json:"allow_remote"`
+	LocalRoots  []string `json:"local_roots"`
+	MaxBytes    int64    `json:"max_bytes"`
+}
+
+// PromptTemplates are Go text/template files that render requests into
+// prompts. Models maps model ids, aliases or families to a template; other
+// models use Default, or the built-in template when that is empty.
+type PromptTemplates struct {
+	Default string            `json:"default"`
+	Models  map[string]string `json:"models"`
+}
+
+// SystemPromptRule adds Prompt to the instructions of requests that match
+// every criterion set on the rule. Models lists model ids, aliases or
+// families; Workspaces lists directories the workspace must be inside.
+type SystemPromptRule struct {
+	Models     []string `json:"models,omitempty"`
+	Workspaces []string `json:"workspaces,omitempty"`
+	Prompt     string   `json:"prompt"`
+}
+
+// ModelRoute sends a request to Target when every criterion set on the rule
+// matches. Models lists requested model names or aliases; Hours is a local
+// "HH:MM-HH:MM" window and may wrap midnight.
+type ModelRoute struct {
+	Name           string   `json:"name"`
+	Target         string   `json:"target"`
+	Models         []string `json:"models,omitempty"`
+	Agents         []string `json:"agents,omitempty"`
+	Tools          *bool    `json:"tools,omitempty"`
+	MinPromptChars int      `json:"min_prompt_chars,omitempty"`
+	MaxPromptChars int      `json:"max_prompt_chars,omitempty"`
+	Hours          string   `json:"hours,omitempty"`
 }
 
 // Default returns default configuration.
@@ -50,6 +226,28 @@ func Default() *Config {
 		DefaultModel:          "auto",
 		EnableThinking:        true,
 		MaxToolLoopIterations: 10,
+		MaxToolCallRepeats:    3,
+		ModelDiscovery:        true,
+		ModelRefreshMinutes:   360,
+		WorkspaceLock:         "off",
+		ContextWindow:         ContextWindow{Strategy: "off", KeepRecent: 6, MaxToolResultTokens: 4000},
+		ChangeReport: ChangeReport{
+			MaxFiles:      5000,
+			MaxFileBytes:  1 << 20,
+			MaxTotalBytes: 64 << 20,
+			MaxDiffBytes:  256 * 1024,
+		},
+		Snapshots: Snapshots{
+			MaxSnapshots:  50,
+			MaxAgeHours:   7 * 24,
+			MaxStoreBytes: 1 << 30,
+		},
+		StructuredOutputRetries: 2,
+		MaxChoices:              4,
+		Attachments:             Attachments{LocalRoots: []string{"~/.openclaw"}, MaxBytes: 20 << 20},
+		ToolResults:             ToolResults{SpillTokens: 0, ExcerptTokens: 500, SessionTTLMinutes: 1440},
+		Isolation:               Isolation{Mode: "off", MaxAgeMinutes: 1440, MaxDiffBytes: 256 * 1024, MaxCopyFiles: 20000, MaxCopyBytes: 1 << 30},
+		CommandPolicy:           CommandPolicy{Mode: "off", DefaultAction: "allow"},
 	}
 }
 
@@ -81,6 +279,19 @@ func Load() (*Config, error) {
 	if cfg.Workspace != "" {
 		cfg.Workspace = expandHome(cfg.Workspace)
 	}
+	cfg.Snapshots.Dir = expandHome(cfg.Snapshots.Dir)
+	for i, r := range cfg.WorkspaceRoots {
+		cfg.WorkspaceRoots[i] = expandHome(r)
+	}
+	cfg.PromptTemplates.Default = expandHome(cfg.PromptTemplates.Default)
+	for name, path := range cfg.PromptTemplates.Models {
+		cfg.PromptTemplates.Models[name] = expandHome(path)
+	}
+	for _, rule := range cfg.SystemPrompts {
+		for i, w := range rule.Workspaces {
+			rule.Workspaces[i] = expandHome(w)
+		}
+	}
 	return cfg, nil
 }
 
@@ -112,6 +323,21 @@ func applyEnvOverrides(cfg *Config) {
 	if v := os.Getenv("OPENCLAW_CURSOR_WORKSPACE"); v != "" {
 		cfg.Workspace = expandHome(v)
 	}
+	if v := os.Getenv("OPENCLAW_CURSOR_WORKSPACE_ROOTS"); v != "" {
+		cfg.WorkspaceRoots = filepath.SplitList(v)
+	}
+	if v := os.Getenv("OPENCLAW_CURSOR_ISOLATION"); v != "" {
+		cfg.Isolation.Mode = v
+	}
+	if v := os.Getenv("OPENCLAW_CURSOR_WORKSPACE_LOCK"); v != "" {
+		cfg.WorkspaceLock = v
+	}
+	if v := os.Getenv("OPENCLAW_CURSOR_CHANGE_REPORT"); v != "" {
+		cfg.ChangeReport.Enabled = v == "true" || v == "1"
+	}
+	if v := os.Getenv("OPENCLAW_CURSOR_SNAPSHOTS"); v != "" {
+		cfg.Snapshots.Enabled = v == "true" || v == "1"
+	}
 	if v := os.Getenv("OPENCLAW_CURSOR_DEFAULT_MODEL"); v != "" {
 		cfg.DefaultModel = v
 	}
@@ -123,4 +349,41 @@ func applyEnvOverrides(cfg *Config) {
 			cfg.MaxToolLoopIterations = p
 		}
 	}
+	if v := os.Getenv("OPENCLAW_CURSOR_MAX_TOOL_CALL_REPEATS"); v != "" {
+		if p, err := strconv.Atoi(v); err == nil {
+			cfg.MaxToolCallRepeats = p
+		}
+	}
+	if v := os.Getenv("OPENCLAW_CURSOR_MODEL_DISCOVERY"); v != "" {
+		cfg.ModelDiscovery = v == "true" || v == "1"
+	}
+	if v := os.Getenv("OPENCLAW_CURSOR_MODEL_REFRESH_MINUTES"); v != "" {
+		if p, err := strconv.Atoi(v); err == nil {
+			cfg.ModelRefreshMinutes = p
+		}
+	}
+	if v := os.Getenv("OPENCLAW_CURSOR_SYSTEM_PROMPT"); v != "" {
+		cfg.SystemPrompt = v
+	}
+	if v := os.Getenv("OPENCLAW_CURSOR_CONTEXT_STRATEGY"); v != "" {
+		cfg.ContextWindow.Strategy = v
+	}
+	if v := os.Getenv("OPENCLAW_CURSOR_TOOL_RESULT_SPILL_TOKENS"); v != "" {
+		if p, err := strconv.Atoi(v); err == nil {
+			cfg.ToolResults.SpillTokens = p
+		}
+	}
+	if v := os.Getenv("OPENCLAW_CURSOR_STRUCTURED_OUTPUT_RETRIES"); v != "" {
+		if p, err := strconv.Atoi(v); err == nil {
+			cfg.StructuredOutputRetries = p
+		}
+	}
+	if v := os.Getenv("OPENCLAW_CURSOR_MAX_CONCURRENT_AGENTS"); v != "" {
+		if p, err := strconv.Atoi(v); err == nil {
+			cfg.MaxConcurrentAgents = p
+		}
+	}
+	if v := os.Getenv("OPENCLAW_CURSOR_COMMAND_POLICY"); v != "" {
+		cfg.CommandPolicy.Mode = v
+	}
 }
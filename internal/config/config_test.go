@@ -29,6 +29,8 @@ func TestDefault(t *testing.T) {
 	assert.Equal(t, "auto", cfg.DefaultModel)
 	assert.True(t, cfg.EnableThinking)
 	assert.Equal(t, 10, cfg.MaxToolLoopIterations)
+	assert.Equal(t, 3, cfg.MaxToolCallRepeats)
+	assert.Equal(t, "off", cfg.ContextWindow.Strategy)
 }
 
 func TestLoad_EnvOverrides(t *testing.T) {
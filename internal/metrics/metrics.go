@@ -0,0 +1,91 @@
+// Package metrics keeps the proxy's counters and writes them in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registry is a set of counters, safe for concurrent use. The zero value is
+// ready to use.
+type Registry struct {
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	name, labels string
+	value        int64
+}
+
+// Inc adds one to the counter name with the given labels, passed as key,
+// value pairs.
+func (r *Registry) Inc(name string, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.series == nil {
+		r.series = make(map[string]*series)
+	}
+	l := formatLabels(labels)
+	s, ok := r.series[name+l]
+	if !ok {
+		s = &series{name: name, labels: l}
+		r.series[name+l] = s
+	}
+	s.value++
+}
+
+// Value returns the current value of a counter.
+func (r *Registry) Value(name string, labels ...string) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.series[name+formatLabels(labels)]; ok {
+		return s.value
+	}
+	return 0
+}
+
+// WriteTo writes every counter, sorted by name and labels.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	all := make([]series, 0, len(r.series))
+	for _, s := range r.series {
+		all = append(all, *s)
+	}
+	r.mu.Unlock()
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].name != all[j].name {
+			return all[i].name < all[j].name
+		}
+		return all[i].labels < all[j].labels
+	})
+
+	var b strings.Builder
+	for i, s := range all {
+		if i == 0 || all[i-1].name != s.name {
+			fmt.Fprintf(&b, "# TYPE %s counter\n", s.name)
+		}
+		fmt.Fprintf(&b, "%s%s %d\n", s.name, s.labels, s.value)
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// formatLabels renders key, value pairs as {k="v",...}; a trailing key
+// without a value is dropped.
+func formatLabels(kv []string) string {
+	if len(kv) < 2 {
+		return ""
+	}
+	var parts []string
+	for i := 0; i+1 < len(kv); i += 2 {
+		parts = append(parts, kv[i]+`="`+escaper.Replace(kv[i+1])+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
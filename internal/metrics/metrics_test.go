@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	var r Registry
+	r.Inc("wins_total", "alias", "fast", "model", "auto")
+	r.Inc("wins_total", "alias", "fast", "model", "auto")
+	r.Inc("wins_total", "alias", `say "hi"`, "model", "gpt-5")
+	r.Inc("races_total")
+
+	assert.Equal(t, int64(2), r.Value("wins_total", "alias", "fast", "model", "auto"))
+	assert.Equal(t, int64(0), r.Value("wins_total", "alias", "slow"))
+
+	var b strings.Builder
+	_, err := r.WriteTo(&b)
+	assert.NoError(t, err)
+	assert.Equal(t, `# TYPE races_total counter
+races_total 1
+# TYPE wins_total counter
+wins_total{alias="fast",model="auto"} 2
+wins_total{alias="say \"hi\"",model="gpt-5"} 1
+`, b.String())
+}
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	discoveredMu sync.RWMutex
+	discovered   map[string]Model
+	discoveredAt time.Time
+)
+
+// Lister returns the models cursor-agent reports as available.
+type Lister func(ctx context.Context) ([]Model, error)
+
+// DiscoveryCache is the on-disk form of the last discovery result.
+type DiscoveryCache struct {
+	Updated time.Time `json:"updated"`
+	Models  []Model   `json:"models"`
+}
+
+// DefaultCachePath returns ~/.openclaw/cursor-models.json.
+func DefaultCachePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".openclaw", "cursor-models.json")
+}
+
+// SetDiscovered replaces the set of models discovered from cursor-agent.
+func SetDiscovered(list []Model, at time.Time) {
+	m := make(map[string]Model, len(list))
+	for _, d := range list {
+		if d.ID != "" {
+			m[d.ID] = d
+		}
+	}
+	discoveredMu.Lock()
+	discovered = m
+	discoveredAt = at
+	discoveredMu.Unlock()
+}
+
+// DiscoveredAt returns when the discovered set was last refreshed.
+func DiscoveredAt() time.Time {
+	discoveredMu.RLock()
+	defer discoveredMu.RUnlock()
+	return discoveredAt
+}
+
+// Lookup returns a model from the static registry, falling back to models
+// discovered from cursor-agent. Static metadata wins when both know the id.
+func Lookup(id string) (Model, bool) {
+	if m, ok := Registry[id]; ok {
+		return m, true
+	}
+	discoveredMu.RLock()
+	defer discoveredMu.RUnlock()
+	d, ok := discovered[id]
+	if !ok {
+		return Model{}, false
+	}
+	return fromDiscovery(d), true
+}
+
+// fromDiscovery fills in what a bare discovered id doesn't say.
+func fromDiscovery(d Model) Model {
+	if d.Name == "" {
+		d.Name = d.ID
+	}
+	d.SupportsTools = true
+	if strings.HasSuffix(d.ID, "-thinking") {
+		d.SupportsThinking = true
+	}
+	if d.Family == "" {
+		d.Family = familyOf(d.ID)
+	}
+	switch d.Family {
+	case "gpt", "claude", "gemini":
+		d.SupportsImages = true
+	}
+	return withDefaults(d)
+}
+
+// All returns the static registry merged with discovered models, sorted by id.
+func All() []Model {
+	out := make([]Model, 0, len(Registry))
+	for _, m := range Registry {
+		out = append(out, m)
+	}
+	discoveredMu.RLock()
+	for id, d := range discovered {
+		if _, ok := Registry[id]; !ok {
+			out = append(out, fromDiscovery(d))
+		}
+	}
+	discoveredMu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// LoadCache loads a previous discovery result into the discovered set.
+func LoadCache(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var c DiscoveryCache
+	if err := json.Unmarshal(data, &c); err != nil {
+		return fmt.Errorf("parse model cache %s: %w", path, err)
+	}
+	SetDiscovered(c.Models, c.Updated)
+	return nil
+}
+
+// Refresh queries cursor-agent via list, updates the discovered set and
+// writes the cache. On failure the previous set is kept.
+func Refresh(ctx context.Context, list Lister, cachePath string) (int, error) {
+	found, err := list(ctx)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	SetDiscovered(found, now)
+	if cachePath != "" {
+		b, err := json.MarshalIndent(DiscoveryCache{Updated: now, Models: found}, "", "  ")
+		if err != nil {
+			return len(found), err
+		}
+		os.MkdirAll(filepath.Dir(cachePath), 0755)
+		if err := os.WriteFile(cachePath, b, 0644); err != nil {
+			return len(found), fmt.Errorf("write model cache: %w", err)
+		}
+	}
+	return len(found), nil
+}
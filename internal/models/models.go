@@ -4,99 +4,227 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
+)
+
+// Default limits for models that don't set their own.
+const (
+	DefaultContextWindow = 200000
+	DefaultMaxTokens     = 8192
 )
 
 // Model represents a Cursor model.
 type Model struct {
-	ID               string `json:"id"`
-	Name             string `json:"name"`
-	SupportsThinking bool   `json:"supports_thinking"`
-	SupportsTools    bool   `json:"supports_tools"`
+	ID               string   `json:"id"`
+	Name             string   `json:"name"`
+	Family           string   `json:"family,omitempty"`
+	ContextWindow    int      `json:"context_window,omitempty"`
+	MaxTokens        int      `json:"max_tokens,omitempty"`
+	SupportsThinking bool     `json:"supports_thinking"`
+	SupportsTools    bool     `json:"supports_tools"`
+	SupportsImages   bool     `json:"supports_images"`
+	Aliases          []string `json:"aliases,omitempty"`
 }
 
-// Registry contains all supported Cursor models.
+// Registry contains all supported Cursor models. Zero ContextWindow and
+// MaxTokens are filled with the defaults at init.
 var Registry = map[string]Model{
 	// Composer
-	"auto":         {ID: "auto", Name: "Auto", SupportsThinking: false, SupportsTools: true},
-	"composer-1.5": {ID: "composer-1.5", Name: "Composer 1.5", SupportsThinking: false, SupportsTools: true},
-	"composer-1":   {ID: "composer-1", Name: "Composer 1", SupportsThinking: false, SupportsTools: true},
+	"auto":         {ID: "auto", Name: "Auto", Family: "composer", SupportsTools: true},
+	"composer-1.5": {ID: "composer-1.5", Name: "Composer 1.5", Family: "composer", SupportsTools: true, Aliases: []string{"composer"}},
+	"composer-1":   {ID: "composer-1", Name: "Composer 1", Family: "composer", SupportsTools: true},
 
 	// GPT-5.3 Codex
-	"gpt-5.3-codex":      {ID: "gpt-5.3-codex", Name: "GPT-5.3 Codex", SupportsThinking: true, SupportsTools: true},
-	"gpt-5.3-codex-low":  {ID: "gpt-5.3-codex-low", Name: "GPT-5.3 Codex Low", SupportsThinking: true, SupportsTools: true},
-	"gpt-5.3-codex-high": {ID: "gpt-5.3-codex-high", Name: "GPT-5.3 Codex High", SupportsThinking: true, SupportsTools: true},
-	"gpt-5.3-codex-xhigh": {ID: "gpt-5.3-codex-xhigh", Name: "GPT-5.3 Codex Extra High", SupportsThinking: true, SupportsTools: true},
-	"gpt-5.3-codex-fast":  {ID: "gpt-5.3-codex-fast", Name: "GPT-5.3 Codex Fast", SupportsThinking: true, SupportsTools: true},
-	"gpt-5.3-codex-low-fast":  {ID: "gpt-5.3-codex-low-fast", Name: "GPT-5.3 Codex Low Fast", SupportsThinking: true, SupportsTools: true},
-	"gpt-5.3-codex-high-fast": {ID: "gpt-5.3-codex-high-fast", Name: "GPT-5.3 Codex High Fast", SupportsThinking: true, SupportsTools: true},
-	"gpt-5.3-codex-xhigh-fast": {ID: "gpt-5.3-codex-xhigh-fast", Name: "GPT-5.3 Codex Extra High Fast", SupportsThinking: true, SupportsTools: true},
+	"gpt-5.3-codex":            {ID: "gpt-5.3-codex", Name: "GPT-5.3 Codex", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true, Aliases: []string{"codex"}},
+	"gpt-5.3-codex-low":        {ID: "gpt-5.3-codex-low", Name: "GPT-5.3 Codex Low", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
+	"gpt-5.3-codex-high":       {ID: "gpt-5.3-codex-high", Name: "GPT-5.3 Codex High", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
+	"gpt-5.3-codex-xhigh":      {ID: "gpt-5.3-codex-xhigh", Name: "GPT-5.3 Codex Extra High", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
+	"gpt-5.3-codex-fast":       {ID: "gpt-5.3-codex-fast", Name: "GPT-5.3 Codex Fast", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
+	"gpt-5.3-codex-low-fast":   {ID: "gpt-5.3-codex-low-fast", Name: "GPT-5.3 Codex Low Fast", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
+	"gpt-5.3-codex-high-fast":  {ID: "gpt-5.3-codex-high-fast", Name: "GPT-5.3 Codex High Fast", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
+	"gpt-5.3-codex-xhigh-fast": {ID: "gpt-5.3-codex-xhigh-fast", Name: "GPT-5.3 Codex Extra High Fast", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
 
 	// GPT-5.2
-	"gpt-5.2":       {ID: "gpt-5.2", Name: "GPT-5.2", SupportsThinking: true, SupportsTools: true},
-	"gpt-5.2-codex": {ID: "gpt-5.2-codex", Name: "GPT-5.2 Codex", SupportsThinking: true, SupportsTools: true},
-	"gpt-5.2-codex-high":  {ID: "gpt-5.2-codex-high", Name: "GPT-5.2 Codex High", SupportsThinking: true, SupportsTools: true},
-	"gpt-5.2-codex-low":   {ID: "gpt-5.2-codex-low", Name: "GPT-5.2 Codex Low", SupportsThinking: true, SupportsTools: true},
-	"gpt-5.2-codex-xhigh": {ID: "gpt-5.2-codex-xhigh", Name: "GPT-5.2 Codex Extra High", SupportsThinking: true, SupportsTools: true},
-	"gpt-5.2-codex-fast":       {ID: "gpt-5.2-codex-fast", Name: "GPT-5.2 Codex Fast", SupportsThinking: true, SupportsTools: true},
-	"gpt-5.2-codex-high-fast":  {ID: "gpt-5.2-codex-high-fast", Name: "GPT-5.2 Codex High Fast", SupportsThinking: true, SupportsTools: true},
-	"gpt-5.2-codex-low-fast":   {ID: "gpt-5.2-codex-low-fast", Name: "GPT-5.2 Codex Low Fast", SupportsThinking: true, SupportsTools: true},
-	"gpt-5.2-codex-xhigh-fast": {ID: "gpt-5.2-codex-xhigh-fast", Name: "GPT-5.2 Codex Extra High Fast", SupportsThinking: true, SupportsTools: true},
-	"gpt-5.2-high": {ID: "gpt-5.2-high", Name: "GPT-5.2 High", SupportsThinking: true, SupportsTools: true},
+	"gpt-5.2":                  {ID: "gpt-5.2", Name: "GPT-5.2", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true, Aliases: []string{"gpt"}},
+	"gpt-5.2-codex":            {ID: "gpt-5.2-codex", Name: "GPT-5.2 Codex", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
+	"gpt-5.2-codex-high":       {ID: "gpt-5.2-codex-high", Name: "GPT-5.2 Codex High", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
+	"gpt-5.2-codex-low":        {ID: "gpt-5.2-codex-low", Name: "GPT-5.2 Codex Low", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
+	"gpt-5.2-codex-xhigh":      {ID: "gpt-5.2-codex-xhigh", Name: "GPT-5.2 Codex Extra High", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
+	"gpt-5.2-codex-fast":       {ID: "gpt-5.2-codex-fast", Name: "GPT-5.2 Codex Fast", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
+	"gpt-5.2-codex-high-fast":  {ID: "gpt-5.2-codex-high-fast", Name: "GPT-5.2 Codex High Fast", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
+	"gpt-5.2-codex-low-fast":   {ID: "gpt-5.2-codex-low-fast", Name: "GPT-5.2 Codex Low Fast", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
+	"gpt-5.2-codex-xhigh-fast": {ID: "gpt-5.2-codex-xhigh-fast", Name: "GPT-5.2 Codex Extra High Fast", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
+	"gpt-5.2-high":             {ID: "gpt-5.2-high", Name: "GPT-5.2 High", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
 
 	// GPT-5.1
-	"gpt-5.1-codex-max":    {ID: "gpt-5.1-codex-max", Name: "GPT-5.1 Codex Max", SupportsThinking: true, SupportsTools: true},
-	"gpt-5.1-codex-max-high": {ID: "gpt-5.1-codex-max-high", Name: "GPT-5.1 Codex Max High", SupportsThinking: true, SupportsTools: true},
-	"gpt-5.1-high":         {ID: "gpt-5.1-high", Name: "GPT-5.1 High", SupportsThinking: true, SupportsTools: true},
+	"gpt-5.1-codex-max":      {ID: "gpt-5.1-codex-max", Name: "GPT-5.1 Codex Max", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
+	"gpt-5.1-codex-max-high": {ID: "gpt-5.1-codex-max-high", Name: "GPT-5.1 Codex Max High", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
+	"gpt-5.1-high":           {ID: "gpt-5.1-high", Name: "GPT-5.1 High", Family: "gpt", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
 
 	// Claude
-	"opus-4.6":          {ID: "opus-4.6", Name: "Claude 4.6 Opus", SupportsThinking: false, SupportsTools: true},
-	"opus-4.6-thinking": {ID: "opus-4.6-thinking", Name: "Claude 4.6 Opus (Thinking)", SupportsThinking: true, SupportsTools: true},
-	"opus-4.5":          {ID: "opus-4.5", Name: "Claude 4.5 Opus", SupportsThinking: false, SupportsTools: true},
-	"opus-4.5-thinking": {ID: "opus-4.5-thinking", Name: "Claude 4.5 Opus (Thinking)", SupportsThinking: true, SupportsTools: true},
-	"sonnet-4.5":          {ID: "sonnet-4.5", Name: "Claude 4.5 Sonnet", SupportsThinking: false, SupportsTools: true},
-	"sonnet-4.5-thinking": {ID: "sonnet-4.5-thinking", Name: "Claude 4.5 Sonnet (Thinking)", SupportsThinking: true, SupportsTools: true},
+	"opus-4.6":            {ID: "opus-4.6", Name: "Claude 4.6 Opus", Family: "claude", SupportsTools: true, SupportsImages: true, Aliases: []string{"opus"}},
+	"opus-4.6-thinking":   {ID: "opus-4.6-thinking", Name: "Claude 4.6 Opus (Thinking)", Family: "claude", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
+	"opus-4.5":            {ID: "opus-4.5", Name: "Claude 4.5 Opus", Family: "claude", SupportsTools: true, SupportsImages: true},
+	"opus-4.5-thinking":   {ID: "opus-4.5-thinking", Name: "Claude 4.5 Opus (Thinking)", Family: "claude", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
+	"sonnet-4.5":          {ID: "sonnet-4.5", Name: "Claude 4.5 Sonnet", Family: "claude", SupportsTools: true, SupportsImages: true, Aliases: []string{"sonnet"}},
+	"sonnet-4.5-thinking": {ID: "sonnet-4.5-thinking", Name: "Claude 4.5 Sonnet (Thinking)", Family: "claude", SupportsThinking: true, SupportsTools: true, SupportsImages: true},
 
 	// Other
-	"gemini-3-pro":   {ID: "gemini-3-pro", Name: "Gemini 3 Pro", SupportsThinking: false, SupportsTools: true},
-	"gemini-3-flash": {ID: "gemini-3-flash", Name: "Gemini 3 Flash", SupportsThinking: false, SupportsTools: true},
-	"grok":           {ID: "grok", Name: "Grok", SupportsThinking: false, SupportsTools: true},
+	"gemini-3-pro":   {ID: "gemini-3-pro", Name: "Gemini 3 Pro", Family: "gemini", ContextWindow: 1000000, SupportsTools: true, SupportsImages: true, Aliases: []string{"gemini"}},
+	"gemini-3-flash": {ID: "gemini-3-flash", Name: "Gemini 3 Flash", Family: "gemini", ContextWindow: 1000000, SupportsTools: true, SupportsImages: true},
+	"grok":           {ID: "grok", Name: "Grok", Family: "grok", SupportsTools: true},
 }
 
-// Resolve strips cursor/ or cursor-acp/ prefix and validates model ID.
-func Resolve(input string) (string, error) {
+// aliases maps short names such as "sonnet" to registry ids.
+var aliases = map[string]string{}
+
+func init() {
+	for id, m := range Registry {
+		Registry[id] = withDefaults(m)
+		for _, a := range m.Aliases {
+			aliases[a] = id
+		}
+	}
+}
+
+func withDefaults(m Model) Model {
+	if m.ContextWindow == 0 {
+		m.ContextWindow = DefaultContextWindow
+	}
+	if m.MaxTokens == 0 {
+		m.MaxTokens = DefaultMaxTokens
+	}
+	return m
+}
+
+// familyOf guesses a model family from its id, for models only known through
+// discovery.
+func familyOf(id string) string {
+	for _, f := range []string{"composer", "gpt", "claude", "gemini", "grok"} {
+		if strings.HasPrefix(id, f) {
+			return f
+		}
+	}
+	if strings.HasPrefix(id, "opus") || strings.HasPrefix(id, "sonnet") || strings.HasPrefix(id, "haiku") {
+		return "claude"
+	}
+	return ""
+}
+
+// configAliases holds aliases from the proxy config. They take precedence over
+// built-in aliases but never shadow a real model id.
+var (
+	configAliasMu sync.RWMutex
+	configAliases map[string]string
+)
+
+// SetAliases installs alias definitions from the proxy config. Targets may be
+// model ids, cursor/-prefixed ids or built-in aliases.
+func SetAliases(m map[string]string) {
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[StripPrefix(k)] = StripPrefix(v)
+	}
+	configAliasMu.Lock()
+	configAliases = c
+	configAliasMu.Unlock()
+}
+
+// StripPrefix removes the cursor/ or cursor-acp/ provider prefix.
+func StripPrefix(input string) string {
 	s := strings.TrimSpace(input)
 	s = strings.TrimPrefix(s, "cursor/")
-	s = strings.TrimPrefix(s, "cursor-acp/")
-	if m, ok := Registry[s]; ok {
-		return m.ID, nil
+	return strings.TrimPrefix(s, "cursor-acp/")
+}
+
+// Resolve strips cursor/ or cursor-acp/ prefix and validates model ID against
+// the registry, aliases and the models discovered from cursor-agent.
+func Resolve(input string) (string, error) {
+	m, ok := Get(input)
+	if !ok {
+		return "", fmt.Errorf("unknown model %q", input)
+	}
+	return m.ID, nil
+}
+
+// Get is like Resolve but returns the model's metadata.
+func Get(input string) (Model, bool) {
+	s := StripPrefix(input)
+	if m, ok := Lookup(s); ok {
+		return m, true
+	}
+	configAliasMu.RLock()
+	target, ok := configAliases[s]
+	configAliasMu.RUnlock()
+	if ok {
+		s = target
+		if m, ok := Lookup(s); ok {
+			return m, true
+		}
 	}
-	return "", fmt.Errorf("unknown model %q", input)
+	if id, ok := aliases[s]; ok {
+		return Lookup(id)
+	}
+	return Model{}, false
 }
 
-// OpenAIModel represents a model in OpenAI /v1/models response.
+// OpenAIModel represents a model in OpenAI /v1/models response. The
+// openclaw_* fields are extensions carrying the metadata OpenClaw needs for
+// its provider config.
 type OpenAIModel struct {
 	ID      string `json:"id"`
 	Object  string `json:"object"`
 	Created int64  `json:"created"`
 	OwnedBy string `json:"owned_by"`
+
+	Name           string   `json:"openclaw_name,omitempty"`
+	Family         string   `json:"openclaw_family,omitempty"`
+	ContextWindow  int      `json:"openclaw_context_window,omitempty"`
+	MaxTokens      int      `json:"openclaw_max_tokens,omitempty"`
+	Reasoning      bool     `json:"openclaw_reasoning"`
+	SupportsTools  bool     `json:"openclaw_supports_tools"`
+	SupportsImages bool     `json:"openclaw_supports_images"`
+	Aliases        []string `json:"openclaw_aliases,omitempty"`
+	// ReasoningEfforts maps reasoning_effort values to the model id used;
+	// ThinkingVariants maps thinking "enabled"/"disabled" likewise.
+	ReasoningEfforts map[string]string `json:"openclaw_reasoning_efforts,omitempty"`
+	ThinkingVariants map[string]string `json:"openclaw_thinking_variants,omitempty"`
 }
 
 // OpenAIModelList is the response for GET /v1/models.
 type OpenAIModelList struct {
-	Object string         `json:"object"`
-	Data   []OpenAIModel  `json:"data"`
+	Object string        `json:"object"`
+	Data   []OpenAIModel `json:"data"`
+}
+
+// ToOpenAI converts a model to its /v1/models entry.
+func ToOpenAI(m Model) OpenAIModel {
+	return OpenAIModel{
+		ID:             m.ID,
+		Object:         "model",
+		Created:        1700000000,
+		OwnedBy:        "cursor",
+		Name:           m.Name,
+		Family:         m.Family,
+		ContextWindow:  m.ContextWindow,
+		MaxTokens:      m.MaxTokens,
+		Reasoning:      m.SupportsThinking,
+		SupportsTools:  m.SupportsTools,
+		SupportsImages: m.SupportsImages,
+		Aliases:        m.Aliases,
+
+		ReasoningEfforts: EffortVariants(m.ID),
+		ThinkingVariants: ThinkingVariants(m.ID),
+	}
 }
 
-// ListOpenAI returns models in OpenAI API format.
+// ListOpenAI returns the registry merged with discovered models in OpenAI API
+// format, sorted by id.
 func ListOpenAI() OpenAIModelList {
-	data := make([]OpenAIModel, 0, len(Registry))
-	for _, m := range Registry {
-		data = append(data, OpenAIModel{
-			ID:      m.ID,
-			Object:  "model",
-			Created: 1700000000,
-			OwnedBy: "cursor",
-		})
+	all := All()
+	data := make([]OpenAIModel, 0, len(all))
+	for _, m := range all {
+		data = append(data, ToOpenAI(m))
 	}
 	return OpenAIModelList{Object: "list", Data: data}
 }
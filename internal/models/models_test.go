@@ -1,8 +1,13 @@
 package models
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -18,6 +23,8 @@ func TestResolve(t *testing.T) {
 		{"cursor-acp/sonnet-4.5", "sonnet-4.5", false},
 		{"auto", "auto", false},
 		{"cursor/gpt-5.3-codex-high", "gpt-5.3-codex-high", false},
+		{"cursor/sonnet", "sonnet-4.5", false},
+		{"codex", "gpt-5.3-codex", false},
 		{"cursor/unknown-model", "", true},
 	}
 	for _, tt := range tests {
@@ -37,10 +44,35 @@ func TestListOpenAI(t *testing.T) {
 	list := ListOpenAI()
 	assert.Equal(t, "list", list.Object)
 	assert.GreaterOrEqual(t, len(list.Data), 30)
-	for _, m := range list.Data {
+	for i, m := range list.Data {
 		assert.NotEmpty(t, m.ID)
 		assert.Equal(t, "model", m.Object)
+		assert.NotEmpty(t, m.Name)
+		assert.Positive(t, m.ContextWindow)
+		assert.Positive(t, m.MaxTokens)
+		if i > 0 {
+			assert.Less(t, list.Data[i-1].ID, m.ID, "list must be sorted")
+		}
 	}
+	assert.Equal(t, list, ListOpenAI())
+}
+
+func TestRegistryMetadata(t *testing.T) {
+	for id, m := range Registry {
+		assert.Equal(t, id, m.ID)
+		assert.NotEmpty(t, m.Family, id)
+		if strings.HasSuffix(id, "-thinking") {
+			assert.True(t, m.SupportsThinking, id)
+		}
+		for _, a := range m.Aliases {
+			_, clash := Registry[a]
+			assert.False(t, clash, "alias %q shadows a model id", a)
+		}
+	}
+	m, ok := Get("cursor/gemini")
+	require.True(t, ok)
+	assert.Equal(t, "gemini-3-pro", m.ID)
+	assert.Equal(t, 1000000, m.ContextWindow)
 }
 
 func TestListOpenAIJSON(t *testing.T) {
@@ -50,3 +82,109 @@ func TestListOpenAIJSON(t *testing.T) {
 	require.NoError(t, json.Unmarshal(b, &list))
 	assert.Equal(t, "list", list.Object)
 }
+
+func TestDiscoveredModels(t *testing.T) {
+	t.Cleanup(func() { SetDiscovered(nil, time.Time{}) })
+	SetDiscovered([]Model{
+		{ID: "gemini-4-ultra"},
+		{ID: "grok-5-thinking", Name: "Grok 5 (Thinking)"},
+		{ID: "auto", Name: "overridden"},
+	}, time.Now())
+
+	got, err := Resolve("cursor/gemini-4-ultra")
+	require.NoError(t, err)
+	assert.Equal(t, "gemini-4-ultra", got)
+
+	m, ok := Lookup("grok-5-thinking")
+	require.True(t, ok)
+	assert.Equal(t, "Grok 5 (Thinking)", m.Name)
+	assert.True(t, m.SupportsThinking)
+	assert.True(t, m.SupportsTools)
+
+	// Static metadata wins over discovery.
+	m, _ = Lookup("auto")
+	assert.Equal(t, Registry["auto"].Name, m.Name)
+
+	all := All()
+	assert.Len(t, all, len(Registry)+2)
+	for i := 1; i < len(all); i++ {
+		assert.Less(t, all[i-1].ID, all[i].ID)
+	}
+}
+
+func TestRefreshWritesCache(t *testing.T) {
+	t.Cleanup(func() { SetDiscovered(nil, time.Time{}) })
+	path := filepath.Join(t.TempDir(), "cursor-models.json")
+	n, err := Refresh(context.Background(), func(context.Context) ([]Model, error) {
+		return []Model{{ID: "new-model-1"}}, nil
+	}, path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	SetDiscovered(nil, time.Time{})
+	_, err = Resolve("new-model-1")
+	require.Error(t, err)
+
+	require.NoError(t, LoadCache(path))
+	_, err = Resolve("new-model-1")
+	require.NoError(t, err)
+	assert.False(t, DiscoveredAt().IsZero())
+
+	// A failed refresh keeps the previous set.
+	_, err = Refresh(context.Background(), func(context.Context) ([]Model, error) {
+		return nil, errors.New("boom")
+	}, path)
+	require.Error(t, err)
+	_, err = Resolve("new-model-1")
+	assert.NoError(t, err)
+}
+
+func TestConfigAliases(t *testing.T) {
+	t.Cleanup(func() { SetAliases(nil) })
+	SetAliases(map[string]string{"fast": "cursor/composer-1", "smart": "opus", "sonnet": "sonnet-4.5-thinking", "auto": "grok"})
+
+	for in, want := range map[string]string{
+		"cursor/fast": "composer-1",
+		"smart":       "opus-4.6",            // chains through a built-in alias
+		"sonnet":      "sonnet-4.5-thinking", // overrides a built-in alias
+		"auto":        "auto",                // never shadows a model id
+	} {
+		got, err := Resolve(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+}
+
+func TestVariant(t *testing.T) {
+	on, off := true, false
+	tests := []struct {
+		id       string
+		effort   string
+		thinking *bool
+		want     string
+	}{
+		{"gpt-5.3-codex", "", nil, "gpt-5.3-codex"},
+		{"gpt-5.3-codex", "high", nil, "gpt-5.3-codex-high"},
+		{"gpt-5.3-codex", "minimal", nil, "gpt-5.3-codex-low"},
+		{"gpt-5.3-codex-high", "medium", nil, "gpt-5.3-codex"},
+		{"gpt-5.3-codex-fast", "xhigh", nil, "gpt-5.3-codex-xhigh-fast"},
+		{"gpt-5.2", "high", nil, "gpt-5.2-high"},
+		{"gpt-5.2", "low", nil, "gpt-5.2"}, // no gpt-5.2-low
+		{"opus-4.6", "high", nil, "opus-4.6-thinking"},
+		{"opus-4.6-thinking", "none", nil, "opus-4.6"},
+		{"opus-4.6", "high", &off, "opus-4.6"},
+		{"sonnet-4.5", "", &on, "sonnet-4.5-thinking"},
+		{"sonnet-4.5-thinking", "", &off, "sonnet-4.5"},
+		{"auto", "high", &on, "auto"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Variant(tt.id, tt.effort, tt.thinking), "%s effort=%q", tt.id, tt.effort)
+	}
+
+	m := ToOpenAI(Registry["gpt-5.3-codex"])
+	assert.Equal(t, "gpt-5.3-codex-xhigh", m.ReasoningEfforts["xhigh"])
+	assert.Nil(t, m.ThinkingVariants)
+	m = ToOpenAI(Registry["opus-4.6"])
+	assert.Equal(t, map[string]string{"enabled": "opus-4.6-thinking", "disabled": "opus-4.6"}, m.ThinkingVariants)
+	assert.Nil(t, ToOpenAI(Registry["auto"]).ReasoningEfforts)
+}
@@ -0,0 +1,104 @@
+package models
+
+import "strings"
+
+// Reasoning efforts accepted from OpenAI-style clients, mapped onto the
+// suffixes Cursor uses in model ids. "medium" is the unsuffixed base model.
+var effortSuffix = map[string]string{
+	"none":    "-low",
+	"minimal": "-low",
+	"low":     "-low",
+	"medium":  "",
+	"high":    "-high",
+	"xhigh":   "-xhigh",
+}
+
+// Efforts lists the accepted reasoning efforts in increasing order.
+var Efforts = []string{"none", "minimal", "low", "medium", "high", "xhigh"}
+
+const (
+	thinkingSuffix = "-thinking"
+	fastSuffix     = "-fast"
+)
+
+// splitVariant breaks an id like "gpt-5.3-codex-high-fast" into its base
+// ("gpt-5.3-codex"), effort suffix ("-high") and fast suffix ("-fast").
+func splitVariant(id string) (base, effort, fast string) {
+	base = id
+	if strings.HasSuffix(base, fastSuffix) {
+		base, fast = strings.TrimSuffix(base, fastSuffix), fastSuffix
+	}
+	for _, s := range []string{"-xhigh", "-high", "-low"} {
+		if strings.HasSuffix(base, s) {
+			return strings.TrimSuffix(base, s), s, fast
+		}
+	}
+	return base, "", fast
+}
+
+// Variant picks the Cursor model id that combines id with a requested
+// reasoning effort and thinking toggle. Effort selects among -low/-high/-xhigh
+// variants; for models that only come in plain and -thinking flavours, any
+// effort other than none enables thinking. An explicit thinking toggle wins
+// over effort. When the requested variant doesn't exist, id is returned as is.
+func Variant(id, effort string, thinking *bool) string {
+	effort = strings.ToLower(strings.TrimSpace(effort))
+	out := id
+	if suffix, ok := effortSuffix[effort]; ok {
+		base, _, fast := splitVariant(out)
+		if _, ok := Lookup(base + suffix + fast); ok {
+			out = base + suffix + fast
+		} else if _, ok := Lookup(base + suffix); ok {
+			out = base + suffix
+		}
+		if thinking == nil && hasThinkingVariant(out) {
+			on := effort != "none"
+			thinking = &on
+		}
+	}
+	if thinking != nil {
+		plain := strings.TrimSuffix(out, thinkingSuffix)
+		if *thinking {
+			if _, ok := Lookup(plain + thinkingSuffix); ok {
+				out = plain + thinkingSuffix
+			}
+		} else if _, ok := Lookup(plain); ok {
+			out = plain
+		}
+	}
+	return out
+}
+
+// hasThinkingVariant reports whether id comes in plain and -thinking flavours.
+func hasThinkingVariant(id string) bool {
+	plain := strings.TrimSuffix(id, thinkingSuffix)
+	_, a := Lookup(plain)
+	_, b := Lookup(plain + thinkingSuffix)
+	return a && b
+}
+
+// EffortVariants returns, for each reasoning effort, the model id Variant
+// would select starting from id. Nil when effort doesn't change the model.
+func EffortVariants(id string) map[string]string {
+	m := make(map[string]string)
+	changes := false
+	for _, e := range Efforts {
+		v := Variant(id, e, nil)
+		m[e] = v
+		changes = changes || v != id
+	}
+	if !changes {
+		return nil
+	}
+	return m
+}
+
+// ThinkingVariants returns the ids selected by thinking on/off, or nil when
+// the model has no separate thinking variant.
+func ThinkingVariants(id string) map[string]string {
+	if !hasThinkingVariant(id) {
+		return nil
+	}
+	on, off := true, false
+	return map[string]string{"enabled": Variant(id, "", &on), "disabled": Variant(id, "", &off)}
+}
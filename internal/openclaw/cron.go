@@ -0,0 +1,213 @@
+package openclaw
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultCronModel is what cron set-model uses when no model is given; it
+// matches the heartbeat default.
+const DefaultCronModel = "cursor/auto"
+
+// CronJobsPath returns OPENCLAW_CRON_JOBS or ~/.openclaw/cron/jobs.json.
+func CronJobsPath() string {
+	if p := os.Getenv("OPENCLAW_CRON_JOBS"); p != "" {
+		return p
+	}
+	return filepath.Join(Dir(), "cron", "jobs.json")
+}
+
+// CronChange describes one job rewritten by SetCronModel or FixCronDelivery.
+type CronChange struct {
+	Job    string
+	Detail string
+}
+
+// CronJob is the summary printed by cron list.
+type CronJob struct {
+	Name     string `json:"name"`
+	Enabled  *bool  `json:"enabled,omitempty"`
+	Kind     string `json:"kind,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Delivery string `json:"delivery,omitempty"`
+}
+
+// cronJobs returns the jobs array of a jobs.json document.
+func cronJobs(root *Object) ([]*Object, error) {
+	v, _ := root.Get("jobs")
+	arr, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("missing or invalid jobs array")
+	}
+	jobs := make([]*Object, 0, len(arr))
+	for _, j := range arr {
+		if o, ok := j.(*Object); ok {
+			jobs = append(jobs, o)
+		}
+	}
+	return jobs, nil
+}
+
+func childObject(o *Object, key string) *Object {
+	v, _ := o.Get(key)
+	c, _ := v.(*Object)
+	return c
+}
+
+// ListCronJobs summarizes the jobs in a jobs.json document.
+func ListCronJobs(root *Object) ([]CronJob, error) {
+	jobs, err := cronJobs(root)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]CronJob, 0, len(jobs))
+	for _, j := range jobs {
+		cj := CronJob{Name: j.String("name")}
+		if v, ok := j.Get("enabled"); ok {
+			if b, ok := v.(bool); ok {
+				cj.Enabled = &b
+			}
+		}
+		if p := childObject(j, "payload"); p != nil {
+			cj.Kind, cj.Model = p.String("kind"), p.String("model")
+		}
+		if d := childObject(j, "delivery"); d != nil {
+			var parts []string
+			for _, k := range []string{"mode", "channel"} {
+				if v := d.String(k); v != "" {
+					parts = append(parts, v)
+				}
+			}
+			if to, ok := deliveryTo(d); ok {
+				parts = append(parts, "→ "+to)
+			}
+			cj.Delivery = strings.Join(parts, " ")
+		}
+		out = append(out, cj)
+	}
+	return out, nil
+}
+
+// deliveryTo returns a delivery's "to" as text. Any present, non-null value
+// counts as a target: chat ids are often written as JSON numbers.
+func deliveryTo(d *Object) (string, bool) {
+	v, ok := d.Get("to")
+	if !ok || v == nil {
+		return "", false
+	}
+	if s, ok := v.(string); ok {
+		return s, s != ""
+	}
+	return fmt.Sprint(v), true
+}
+
+// SetCronModel points every agentTurn job at model.
+func SetCronModel(root *Object, model string) ([]CronChange, error) {
+	jobs, err := cronJobs(root)
+	if err != nil {
+		return nil, err
+	}
+	var changes []CronChange
+	for _, j := range jobs {
+		p := childObject(j, "payload")
+		if p == nil || p.String("kind") != "agentTurn" {
+			continue
+		}
+		prev := p.String("model")
+		if prev == model {
+			continue
+		}
+		p.Set("model", model)
+		detail := "→ " + model
+		if prev != "" {
+			detail = prev + " " + detail
+		}
+		changes = append(changes, CronChange{Job: j.String("name"), Detail: detail})
+	}
+	return changes, nil
+}
+
+// DeliveryOptions configures FixCronDelivery.
+type DeliveryOptions struct {
+	// DefaultTo is the Telegram chat id used for jobs missing a target.
+	DefaultTo string
+	// LegacyTo is an old display-name "to" value to replace with DefaultTo.
+	LegacyTo string
+}
+
+// FixCronDelivery gives announce jobs an explicit channel and target so
+// OpenClaw doesn't fall back to WhatsApp delivery:
+//   - a legacy display-name "to" with no channel becomes Telegram + DefaultTo
+//   - a Telegram delivery without "to" gets DefaultTo
+//   - mode "announce" (the default) with neither channel nor "to" becomes
+//     Telegram + DefaultTo
+func FixCronDelivery(root *Object, opts DeliveryOptions) ([]CronChange, error) {
+	if opts.DefaultTo == "" {
+		return nil, fmt.Errorf("a default Telegram target is required")
+	}
+	jobs, err := cronJobs(root)
+	if err != nil {
+		return nil, err
+	}
+	var changes []CronChange
+	for _, j := range jobs {
+		d := childObject(j, "delivery")
+		if d == nil {
+			continue
+		}
+		mode := d.String("mode")
+		if mode == "" {
+			mode = "announce"
+		}
+		channel := d.String("channel")
+		to, hasTo := deliveryTo(d)
+
+		next := d.clone()
+		next.Set("mode", mode)
+		changed := false
+		switch {
+		case opts.LegacyTo != "" && to == opts.LegacyTo && channel == "":
+			next.Set("channel", "telegram")
+			next.Set("to", opts.DefaultTo)
+			changed = true
+		case channel == "telegram" && !hasTo:
+			next.Set("to", opts.DefaultTo)
+			changed = true
+		case mode == "announce" && channel == "" && !hasTo:
+			next.Set("channel", "telegram")
+			next.Set("to", opts.DefaultTo)
+			changed = true
+		}
+		if changed {
+			j.Set("delivery", next)
+			changes = append(changes, CronChange{Job: j.String("name"), Detail: "telegram → " + opts.DefaultTo})
+		}
+	}
+	return changes, nil
+}
+
+// clone returns a shallow copy of o.
+func (o *Object) clone() *Object {
+	c := NewObject()
+	for _, k := range o.keys {
+		c.Set(k, o.vals[k])
+	}
+	return c
+}
+
+// PlanCron applies fn to the jobs file at path and returns the edit and the
+// per-job changes. Unlike PlanEdit, a missing file is an error.
+func PlanCron(path string, fn func(*Object) ([]CronChange, error)) (*Edit, []CronChange, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, nil, fmt.Errorf("cron jobs file not found: %s", path)
+	}
+	var changes []CronChange
+	edit, err := PlanEdit(path, func(root *Object) error {
+		var err error
+		changes, err = fn(root)
+		return err
+	})
+	return edit, changes, err
+}
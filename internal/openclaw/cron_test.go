@@ -0,0 +1,113 @@
+package openclaw
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// copyFixture copies testdata/cron/jobs.json into a temp dir.
+func copyFixture(t *testing.T) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "cron", "jobs.json"))
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	return path
+}
+
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	golden := filepath.Join("testdata", "cron", name)
+	if *update {
+		require.NoError(t, os.WriteFile(golden, got, 0644))
+	}
+	want, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(got))
+}
+
+func TestSetCronModel(t *testing.T) {
+	path := copyFixture(t)
+	edit, changes, err := PlanCron(path, func(root *Object) ([]CronChange, error) {
+		return SetCronModel(root, "cursor/opus-4.6")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []CronChange{
+		{Job: "morning-brief", Detail: "anthropic/claude-sonnet → cursor/opus-4.6"},
+		{Job: "standup", Detail: "→ cursor/opus-4.6"},
+		{Job: "legacy", Detail: "cursor/auto → cursor/opus-4.6"},
+		{Job: "already-fine", Detail: "cursor/auto → cursor/opus-4.6"},
+	}, changes)
+	assertGolden(t, "jobs.set-model.json", edit.After)
+
+	backup, err := edit.Apply()
+	require.NoError(t, err)
+	orig, _ := os.ReadFile(filepath.Join("testdata", "cron", "jobs.json"))
+	saved, err := os.ReadFile(backup)
+	require.NoError(t, err)
+	assert.Equal(t, orig, saved)
+
+	// Running again changes nothing.
+	edit, changes, err = PlanCron(path, func(root *Object) ([]CronChange, error) {
+		return SetCronModel(root, "cursor/opus-4.6")
+	})
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.False(t, edit.Changed())
+}
+
+func TestFixCronDelivery(t *testing.T) {
+	path := copyFixture(t)
+	opts := DeliveryOptions{DefaultTo: "123456789", LegacyTo: "Jane's phone"}
+	edit, changes, err := PlanCron(path, func(root *Object) ([]CronChange, error) {
+		return FixCronDelivery(root, opts)
+	})
+	require.NoError(t, err)
+	var names []string
+	for _, c := range changes {
+		names = append(names, c.Job)
+	}
+	assert.Equal(t, []string{"morning-brief", "standup", "legacy"}, names)
+	assertGolden(t, "jobs.fix-delivery.json", edit.After)
+
+	_, err = FixCronDelivery(NewObject(), DeliveryOptions{})
+	assert.Error(t, err)
+}
+
+func TestListCronJobs(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "cron", "jobs.json"))
+	require.NoError(t, err)
+	root, err := DecodeObject(data)
+	require.NoError(t, err)
+	jobs, err := ListCronJobs(root)
+	require.NoError(t, err)
+	require.Len(t, jobs, 6)
+	assert.Equal(t, "anthropic/claude-sonnet", jobs[0].Model)
+	assert.Equal(t, "announce", jobs[0].Delivery)
+	require.NotNil(t, jobs[1].Enabled)
+	assert.False(t, *jobs[1].Enabled)
+	assert.Equal(t, "systemEvent", jobs[3].Kind)
+	assert.Equal(t, "announce telegram → 123456789", jobs[4].Delivery)
+	assert.Equal(t, "announce telegram → 987654321", jobs[5].Delivery)
+}
+
+func TestPlanCronErrors(t *testing.T) {
+	_, _, err := PlanCron(filepath.Join(t.TempDir(), "missing.json"), func(root *Object) ([]CronChange, error) {
+		return SetCronModel(root, "cursor/auto")
+	})
+	assert.ErrorContains(t, err, "not found")
+
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"jobs": {}}`), 0644))
+	_, _, err = PlanCron(path, func(root *Object) ([]CronChange, error) {
+		return SetCronModel(root, "cursor/auto")
+	})
+	assert.ErrorContains(t, err, "jobs array")
+}
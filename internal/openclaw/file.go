@@ -0,0 +1,121 @@
+package openclaw
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Dir returns ~/.openclaw.
+func Dir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".openclaw")
+}
+
+// Edit is a pending rewrite of one OpenClaw file.
+type Edit struct {
+	Path   string
+	Before []byte // nil when the file doesn't exist yet
+	After  []byte
+}
+
+// Changed reports whether applying the edit would change the file.
+func (e *Edit) Changed() bool {
+	return string(e.Before) != string(e.After)
+}
+
+// Diff returns a unified diff of the edit.
+func (e *Edit) Diff() string {
+	from, a := e.Path, difflib.SplitLines(string(e.Before))
+	if e.Before == nil {
+		from, a = "/dev/null", nil
+	}
+	out, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        a,
+		B:        difflib.SplitLines(string(e.After)),
+		FromFile: from,
+		ToFile:   e.Path,
+		Context:  3,
+	})
+	return out
+}
+
+// Apply writes the edit, first copying the current file to
+// <path>.bak.<unix-ms>. It returns the backup path ("" for a new file).
+func (e *Edit) Apply() (string, error) {
+	if !e.Changed() {
+		return "", nil
+	}
+	var backup string
+	if e.Before != nil {
+		backup = fmt.Sprintf("%s.bak.%d", e.Path, time.Now().UnixMilli())
+		if err := os.WriteFile(backup, e.Before, 0600); err != nil {
+			return "", fmt.Errorf("write backup: %w", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(e.Path), 0755); err != nil {
+		return backup, err
+	}
+	// OpenClaw files can hold tokens; new ones are private.
+	mode := os.FileMode(0600)
+	if fi, err := os.Stat(e.Path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	tmp := e.Path + ".tmp"
+	if err := os.WriteFile(tmp, e.After, mode); err != nil {
+		return backup, err
+	}
+	if err := os.Rename(tmp, e.Path); err != nil {
+		os.Remove(tmp)
+		return backup, err
+	}
+	return backup, nil
+}
+
+// readObject loads a JSON object file. A missing file yields an empty object
+// and nil Before.
+func readObject(path string) (*Object, []byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return NewObject(), nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	o, err := DecodeObject(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return o, data, nil
+}
+
+// PlanEdit loads the JSON object at path (empty if missing), applies mutate
+// and returns the resulting edit. If mutate changes nothing the edit is a
+// no-op, even when the file's own formatting differs from ours.
+func PlanEdit(path string, mutate func(*Object) error) (*Edit, error) {
+	root, before, err := readObject(path)
+	if err != nil {
+		return nil, err
+	}
+	orig, err := Marshal(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := mutate(root); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	after, err := Marshal(root)
+	if err != nil {
+		return nil, err
+	}
+	if before != nil && string(after) == string(orig) {
+		after = before
+	}
+	return &Edit{Path: path, Before: before, After: after}, nil
+}
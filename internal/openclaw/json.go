@@ -0,0 +1,191 @@
+package openclaw
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Object is a JSON object that keeps its keys in file order, so rewriting an
+// OpenClaw config only changes the lines we touch.
+type Object struct {
+	keys []string
+	vals map[string]any
+}
+
+// NewObject returns an empty object.
+func NewObject() *Object {
+	return &Object{vals: make(map[string]any)}
+}
+
+// Get returns the value for key.
+func (o *Object) Get(key string) (any, bool) {
+	v, ok := o.vals[key]
+	return v, ok
+}
+
+// Set adds or replaces key, keeping its position if it already exists.
+func (o *Object) Set(key string, v any) {
+	if _, ok := o.vals[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.vals[key] = v
+}
+
+// Keys returns the keys in order.
+func (o *Object) Keys() []string {
+	return o.keys
+}
+
+// Object returns the child object at key, creating it when missing. A
+// non-object value at key is an error.
+func (o *Object) Object(key string) (*Object, error) {
+	v, ok := o.vals[key]
+	if !ok || v == nil {
+		child := NewObject()
+		o.Set(key, child)
+		return child, nil
+	}
+	child, ok := v.(*Object)
+	if !ok {
+		return nil, fmt.Errorf("%q is not an object", key)
+	}
+	return child, nil
+}
+
+// String returns the string at key, or "".
+func (o *Object) String(key string) string {
+	s, _ := o.vals[key].(string)
+	return s
+}
+
+// Decode parses JSON into *Object, []any, string, json.Number, bool or nil.
+func Decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := decodeValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return v, nil
+}
+
+// DecodeObject parses JSON that must be an object.
+func DecodeObject(data []byte) (*Object, error) {
+	v, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	o, ok := v.(*Object)
+	if !ok {
+		return nil, fmt.Errorf("top-level JSON value is not an object")
+	}
+	return o, nil
+}
+
+func decodeValue(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			o := NewObject()
+			for dec.More() {
+				kt, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				v, err := decodeValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				o.Set(kt.(string), v)
+			}
+			_, err := dec.Token()
+			return o, err
+		case '[':
+			arr := []any{}
+			for dec.More() {
+				v, err := decodeValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, v)
+			}
+			_, err := dec.Token()
+			return arr, err
+		}
+		return nil, fmt.Errorf("unexpected %v", t)
+	default:
+		return tok, nil
+	}
+}
+
+// Marshal encodes v with two-space indentation and a trailing newline, the
+// layout OpenClaw and JSON.stringify(data, null, 2) produce. HTML characters
+// are not escaped.
+func Marshal(v any) ([]byte, error) {
+	var compact bytes.Buffer
+	if err := writeValue(&compact, v); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, compact.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (o *Object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	err := writeValue(&buf, o)
+	return buf.Bytes(), err
+}
+
+func writeValue(buf *bytes.Buffer, v any) error {
+	switch t := v.(type) {
+	case *Object:
+		buf.WriteByte('{')
+		for i, k := range t.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeValue(buf, k); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeValue(buf, t.vals[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []any:
+		buf.WriteByte('[')
+		for i, e := range t {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeValue(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(t); err != nil {
+			return err
+		}
+		buf.Truncate(buf.Len() - 1) // Encode appends a newline
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package openclaw
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/menezmethod/openclaw-cursor/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalKeepsOrder(t *testing.T) {
+	in := "{\n  \"zeta\": 1,\n  \"alpha\": {\n    \"b\": [\n      1.50,\n      \"<x&y>\"\n    ],\n    \"a\": null\n  }\n}\n"
+	o, err := DecodeObject([]byte(in))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"zeta", "alpha"}, o.Keys())
+	out, err := Marshal(o)
+	require.NoError(t, err)
+	assert.Equal(t, in, string(out))
+
+	_, err = DecodeObject([]byte(`[1]`))
+	assert.Error(t, err)
+	_, err = DecodeObject([]byte(`{} {}`))
+	assert.Error(t, err)
+}
+
+func TestPlanConfig(t *testing.T) {
+	dir := t.TempDir()
+	orig := `{
+  "gateway": {"port": 18789},
+  "models": {
+    "providers": {
+      "anthropic": {"apiKey": "x"},
+      "cursor": {"baseUrl": "http://old/v1", "headers": {"X": "1"}}
+    }
+  },
+  "agents": {"defaults": {"model": {"primary": "anthropic/claude"}}}
+}`
+	require.NoError(t, os.WriteFile(ConfigPath(dir), []byte(orig), 0644))
+
+	opts := ConfigOptions{
+		Dir:     dir,
+		Agent:   "main",
+		BaseURL: "http://127.0.0.1:32125/v1",
+		Models:  []models.Model{models.Registry["auto"], models.Registry["opus-4.6-thinking"]},
+		Primary: "cursor/auto",
+	}
+	edits, err := PlanConfig(opts)
+	require.NoError(t, err)
+	require.Len(t, edits, 2)
+	for _, e := range edits {
+		require.True(t, e.Changed())
+		assert.NotEmpty(t, e.Diff())
+	}
+
+	// Nothing is written until Apply.
+	data, err := os.ReadFile(ConfigPath(dir))
+	require.NoError(t, err)
+	assert.Equal(t, orig, string(data))
+
+	backup, err := edits[0].Apply()
+	require.NoError(t, err)
+	require.NotEmpty(t, backup)
+	data, err = os.ReadFile(backup)
+	require.NoError(t, err)
+	assert.Equal(t, orig, string(data))
+	backup, err = edits[1].Apply()
+	require.NoError(t, err)
+	assert.Empty(t, backup, "new file needs no backup")
+
+	root, err := readJSON(ConfigPath(dir))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gateway", "models", "agents"}, root.Keys())
+	cursor := walk(t, root, "models", "providers", "cursor")
+	assert.Equal(t, "http://127.0.0.1:32125/v1", cursor.String("baseUrl"))
+	assert.Equal(t, "openai-completions", cursor.String("api"))
+	_, ok := cursor.Get("headers")
+	assert.True(t, ok, "extra provider keys are kept")
+	ms, _ := cursor.Get("models")
+	require.Len(t, ms, 2)
+	opus := ms.([]any)[1].(*Object)
+	assert.Equal(t, "opus-4.6-thinking", opus.String("id"))
+	reasoning, _ := opus.Get("reasoning")
+	assert.Equal(t, true, reasoning)
+	assert.NotNil(t, walk(t, root, "models", "providers", "anthropic"))
+	assert.Equal(t, "anthropic/claude", walk(t, root, "agents", "defaults", "model").String("primary"), "existing primary is kept")
+
+	auth, err := readJSON(AuthProfilesPath(dir, "main"))
+	require.NoError(t, err)
+	assert.Equal(t, "placeholder", walk(t, auth, "profiles", AuthProfileID).String("key"))
+
+	// A second run is a no-op.
+	edits, err = PlanConfig(opts)
+	require.NoError(t, err)
+	for _, e := range edits {
+		assert.False(t, e.Changed(), e.Path)
+	}
+
+	opts.ForcePrimary = true
+	edits, err = PlanConfig(opts)
+	require.NoError(t, err)
+	assert.True(t, edits[0].Changed())
+	assert.Contains(t, edits[0].Diff(), `+        "primary": "cursor/auto"`)
+}
+
+func TestMergeProviderRejectsNonObject(t *testing.T) {
+	root, err := DecodeObject([]byte(`{"models": {"providers": []}}`))
+	require.NoError(t, err)
+	assert.Error(t, MergeProvider(root, Provider("http://x/v1", nil), "", false))
+}
+
+func readJSON(path string) (*Object, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeObject(data)
+}
+
+func walk(t *testing.T, o *Object, keys ...string) *Object {
+	t.Helper()
+	for _, k := range keys {
+		v, ok := o.Get(k)
+		require.True(t, ok, filepath.Join(keys...))
+		o = v.(*Object)
+	}
+	return o
+}
@@ -0,0 +1,143 @@
+package openclaw
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/menezmethod/openclaw-cursor/internal/models"
+)
+
+// ProviderName is the provider key OpenClaw uses for the proxy; model refs
+// look like cursor/<id>.
+const ProviderName = "cursor"
+
+// AuthProfileID is the placeholder auth profile OpenClaw requires for every
+// provider. The proxy ignores the key.
+const AuthProfileID = "cursor:default"
+
+// ConfigPath returns the openclaw.json path under dir.
+func ConfigPath(dir string) string {
+	return filepath.Join(dir, "openclaw.json")
+}
+
+// AuthProfilesPath returns the auth-profiles.json path for agent under dir.
+func AuthProfilesPath(dir, agent string) string {
+	return filepath.Join(dir, "agents", agent, "agent", "auth-profiles.json")
+}
+
+// Provider renders the models.providers.cursor block from model metadata.
+func Provider(baseURL string, list []models.Model) *Object {
+	ms := make([]any, 0, len(list))
+	for _, m := range list {
+		e := NewObject()
+		e.Set("id", m.ID)
+		e.Set("name", m.Name)
+		if m.SupportsThinking {
+			e.Set("reasoning", true)
+		}
+		input := []any{"text"}
+		if m.SupportsImages {
+			input = append(input, "image")
+		}
+		e.Set("input", input)
+		e.Set("contextWindow", m.ContextWindow)
+		e.Set("maxTokens", m.MaxTokens)
+		ms = append(ms, e)
+	}
+	p := NewObject()
+	p.Set("baseUrl", baseURL)
+	p.Set("api", "openai-completions")
+	p.Set("models", ms)
+	return p
+}
+
+// MergeProvider sets models.providers.cursor in an openclaw.json document.
+// Other providers and settings, and extra keys on the cursor provider (such
+// as headers), are kept. primary sets agents.defaults.model.primary: always
+// when force is set, otherwise only if no primary model is configured.
+func MergeProvider(root, provider *Object, primary string, force bool) error {
+	ms, err := root.Object("models")
+	if err != nil {
+		return err
+	}
+	if _, ok := ms.Get("mode"); !ok {
+		ms.Set("mode", "merge")
+	}
+	providers, err := ms.Object("providers")
+	if err != nil {
+		return fmt.Errorf("models: %w", err)
+	}
+	cur, err := providers.Object(ProviderName)
+	if err != nil {
+		return fmt.Errorf("models.providers: %w", err)
+	}
+	for _, k := range provider.Keys() {
+		v, _ := provider.Get(k)
+		cur.Set(k, v)
+	}
+	if primary == "" {
+		return nil
+	}
+	agents, err := root.Object("agents")
+	if err != nil {
+		return err
+	}
+	defaults, err := agents.Object("defaults")
+	if err != nil {
+		return fmt.Errorf("agents: %w", err)
+	}
+	model, err := defaults.Object("model")
+	if err != nil {
+		return fmt.Errorf("agents.defaults: %w", err)
+	}
+	if force || model.String("primary") == "" {
+		model.Set("primary", primary)
+	}
+	return nil
+}
+
+// MergeAuthProfile adds the placeholder cursor:default profile to an
+// auth-profiles.json document unless one exists.
+func MergeAuthProfile(root *Object) error {
+	profiles, err := root.Object("profiles")
+	if err != nil {
+		return err
+	}
+	if _, ok := profiles.Get(AuthProfileID); ok {
+		return nil
+	}
+	p := NewObject()
+	p.Set("type", "api_key")
+	p.Set("provider", ProviderName)
+	p.Set("key", "placeholder")
+	profiles.Set(AuthProfileID, p)
+	return nil
+}
+
+// ConfigOptions controls PlanConfig.
+type ConfigOptions struct {
+	Dir     string // ~/.openclaw
+	Agent   string // agent whose auth profiles to update, usually "main"
+	BaseURL string
+	Models  []models.Model
+	// Primary is the default model ref (e.g. "cursor/auto"); ForcePrimary
+	// overwrites an existing default.
+	Primary      string
+	ForcePrimary bool
+}
+
+// PlanConfig computes the edits to openclaw.json and auth-profiles.json
+// without writing anything.
+func PlanConfig(opts ConfigOptions) ([]*Edit, error) {
+	cfg, err := PlanEdit(ConfigPath(opts.Dir), func(root *Object) error {
+		return MergeProvider(root, Provider(opts.BaseURL, opts.Models), opts.Primary, opts.ForcePrimary)
+	})
+	if err != nil {
+		return nil, err
+	}
+	auth, err := PlanEdit(AuthProfilesPath(opts.Dir, opts.Agent), MergeAuthProfile)
+	if err != nil {
+		return nil, err
+	}
+	return []*Edit{cfg, auth}, nil
+}
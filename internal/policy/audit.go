@@ -0,0 +1,74 @@
+package policy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// AuditMeta identifies where a command came from.
+type AuditMeta struct {
+	Workspace string `json:"workspace,omitempty"`
+	Model     string `json:"model,omitempty"`
+	CallID    string `json:"call_id,omitempty"`
+}
+
+// AuditEntry is one line in the audit log.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	AuditMeta
+	Command  string `json:"command"`
+	Action   Action `json:"action"`
+	Rule     string `json:"rule,omitempty"`
+	Mode     string `json:"mode"`
+	Enforced bool   `json:"enforced"`
+}
+
+// AuditLog appends policy decisions as JSON lines.
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+}
+
+// DefaultAuditPath returns ~/.openclaw/logs/cursor-proxy-audit.jsonl.
+func DefaultAuditPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".openclaw", "logs", "cursor-proxy-audit.jsonl")
+}
+
+// NewAuditLog creates an audit log at path (default location if empty).
+func NewAuditLog(path string) *AuditLog {
+	if path == "" {
+		path = DefaultAuditPath()
+	}
+	return &AuditLog{path: expandHome(path)}
+}
+
+// Record appends an entry. Failures are swallowed: auditing must never take
+// down the request path.
+func (a *AuditLog) Record(e AuditEntry) {
+	if a == nil || a.path == "" {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	os.MkdirAll(filepath.Dir(a.path), 0755)
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.Write(append(b, '\n'))
+}
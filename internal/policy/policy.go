@@ -0,0 +1,296 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/menezmethod/openclaw-cursor/internal/config"
+)
+
+// Action is the outcome of evaluating a command against the policy.
+type Action string
+
+const (
+	// Allow lets cursor-agent run the command.
+	Allow Action = "allow"
+	// Deny kills the agent turn and returns a policy error.
+	Deny Action = "deny"
+	// Approve kills the agent turn and hands the command back to OpenClaw as a
+	// tool call, so OpenClaw's own exec approval flow decides.
+	Approve Action = "approve"
+)
+
+// Policy modes.
+const (
+	ModeOff     = "off"
+	ModeAudit   = "audit"
+	ModeEnforce = "enforce"
+)
+
+// Built-in rule presets.
+var presets = map[string]func(segment []string) bool{
+	"network":  isNetworkCommand,
+	"rm-rf":    isRecursiveForceRemove,
+	"git-push": isGitPush,
+	"sudo":     func(seg []string) bool { return len(seg) > 0 && seg[0] == "sudo" },
+}
+
+var networkTools = map[string]bool{
+	"curl": true, "wget": true, "nc": true, "ncat": true, "netcat": true, "ssh": true,
+	"scp": true, "sftp": true, "rsync": true, "ftp": true, "telnet": true, "socat": true,
+}
+
+// Decision is the result of a policy check.
+type Decision struct {
+	Action Action
+	Rule   string
+	Reason string
+	// Enforced is false in audit mode: the decision is logged but not acted on.
+	Enforced bool
+}
+
+// Blocks reports whether the decision stops the agent turn.
+func (d Decision) Blocks() bool {
+	return d.Enforced && d.Action != Allow
+}
+
+type rule struct {
+	name         string
+	action       Action
+	pattern      *regexp.Regexp
+	pathPrefixes []string
+	preset       func([]string) bool
+}
+
+// Engine evaluates shell commands against configured allow/deny rules.
+type Engine struct {
+	mode          string
+	defaultAction Action
+	rules         []rule
+	audit         *AuditLog
+}
+
+// New compiles the command policy from config.
+func New(cfg config.CommandPolicy) (*Engine, error) {
+	mode := cfg.Mode
+	if mode == "" {
+		mode = ModeOff
+	}
+	if mode != ModeOff && mode != ModeAudit && mode != ModeEnforce {
+		return nil, fmt.Errorf("command policy: unknown mode %q", cfg.Mode)
+	}
+	def, err := parseAction(cfg.DefaultAction, Allow)
+	if err != nil {
+		return nil, err
+	}
+	e := &Engine{mode: mode, defaultAction: def}
+	for i, rc := range cfg.Rules {
+		r := rule{name: rc.Name}
+		if r.name == "" {
+			r.name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if r.action, err = parseAction(rc.Action, Deny); err != nil {
+			return nil, fmt.Errorf("%s: %w", r.name, err)
+		}
+		if rc.Pattern != "" {
+			if r.pattern, err = regexp.Compile(rc.Pattern); err != nil {
+				return nil, fmt.Errorf("command policy %s: %w", r.name, err)
+			}
+		}
+		for _, p := range rc.PathPrefixes {
+			r.pathPrefixes = append(r.pathPrefixes, filepath.Clean(expandHome(p)))
+		}
+		if rc.Preset != "" {
+			fn, ok := presets[rc.Preset]
+			if !ok {
+				return nil, fmt.Errorf("command policy %s: unknown preset %q", r.name, rc.Preset)
+			}
+			r.preset = fn
+		}
+		if r.pattern == nil && r.preset == nil && len(r.pathPrefixes) == 0 {
+			return nil, fmt.Errorf("command policy %s: rule needs a pattern, preset or path_prefixes", r.name)
+		}
+		e.rules = append(e.rules, r)
+	}
+	if mode != ModeOff {
+		e.audit = NewAuditLog(cfg.AuditLog)
+	}
+	return e, nil
+}
+
+func parseAction(s string, def Action) (Action, error) {
+	switch Action(s) {
+	case "":
+		return def, nil
+	case Allow, Deny, Approve:
+		return Action(s), nil
+	}
+	return "", fmt.Errorf("command policy: unknown action %q", s)
+}
+
+// Enabled reports whether commands should be inspected at all.
+func (e *Engine) Enabled() bool {
+	return e != nil && e.mode != ModeOff
+}
+
+// Evaluate matches a command against the rules. The first matching rule wins;
+// otherwise the default action applies. workspace resolves relative paths.
+func (e *Engine) Evaluate(command, workspace string) Decision {
+	segments := splitCommand(command)
+	for _, r := range e.rules {
+		if r.matches(command, segments, workspace) {
+			return Decision{Action: r.action, Rule: r.name, Reason: fmt.Sprintf("matched rule %s", r.name), Enforced: e.mode == ModeEnforce}
+		}
+	}
+	return Decision{Action: e.defaultAction, Reason: "default action", Enforced: e.mode == ModeEnforce}
+}
+
+// Check evaluates a command and records the decision in the audit log.
+func (e *Engine) Check(command string, meta AuditMeta) Decision {
+	if !e.Enabled() {
+		return Decision{Action: Allow}
+	}
+	d := e.Evaluate(command, meta.Workspace)
+	e.audit.Record(AuditEntry{
+		AuditMeta: meta,
+		Command:   command,
+		Action:    d.Action,
+		Rule:      d.Rule,
+		Mode:      e.mode,
+		Enforced:  d.Enforced,
+	})
+	return d
+}
+
+func (r rule) matches(command string, segments [][]string, workspace string) bool {
+	if r.pattern != nil && !r.pattern.MatchString(command) {
+		return false
+	}
+	if r.preset != nil && !anySegment(segments, r.preset) {
+		return false
+	}
+	if len(r.pathPrefixes) > 0 && !touchesPrefix(segments, r.pathPrefixes, workspace) {
+		return false
+	}
+	return true
+}
+
+func anySegment(segments [][]string, fn func([]string) bool) bool {
+	for _, seg := range segments {
+		if fn(seg) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitCommand breaks a shell command into simple commands on ; && || | and
+// newlines, dropping leading env assignments and wrappers like env/nohup.
+// Quoting is handled loosely; this is a guard rail, not a shell parser.
+func splitCommand(command string) [][]string {
+	replacer := strings.NewReplacer("&&", "\n", "||", "\n", ";", "\n", "|", "\n", "$(", "\n", "`", "\n", "(", " ", ")", " ")
+	var out [][]string
+	for _, line := range strings.Split(replacer.Replace(command), "\n") {
+		var seg []string
+		for _, f := range strings.Fields(line) {
+			seg = append(seg, strings.Trim(f, `"'`))
+		}
+		for len(seg) > 0 && (strings.Contains(seg[0], "=") || seg[0] == "env" || seg[0] == "nohup" || seg[0] == "time" || seg[0] == "command") {
+			seg = seg[1:]
+		}
+		if len(seg) > 0 {
+			seg[0] = filepath.Base(seg[0])
+			out = append(out, seg)
+		}
+	}
+	return out
+}
+
+func isNetworkCommand(seg []string) bool {
+	if len(seg) > 0 && seg[0] == "sudo" {
+		seg = seg[1:]
+	}
+	return len(seg) > 0 && networkTools[seg[0]]
+}
+
+func isRecursiveForceRemove(seg []string) bool {
+	if len(seg) > 0 && seg[0] == "sudo" {
+		seg = seg[1:]
+	}
+	if len(seg) == 0 || seg[0] != "rm" {
+		return false
+	}
+	var recursive, force bool
+	for _, a := range seg[1:] {
+		switch {
+		case a == "--recursive":
+			recursive = true
+		case a == "--force":
+			force = true
+		case strings.HasPrefix(a, "-") && !strings.HasPrefix(a, "--"):
+			recursive = recursive || strings.ContainsAny(a, "rR")
+			force = force || strings.Contains(a, "f")
+		}
+	}
+	return recursive && force
+}
+
+func isGitPush(seg []string) bool {
+	if len(seg) == 0 || seg[0] != "git" {
+		return false
+	}
+	for i := 1; i < len(seg); i++ {
+		a := seg[i]
+		if a == "-C" || a == "-c" || a == "--git-dir" || a == "--work-tree" {
+			i++
+			continue
+		}
+		if strings.HasPrefix(a, "-") {
+			continue
+		}
+		return a == "push"
+	}
+	return false
+}
+
+func touchesPrefix(segments [][]string, prefixes []string, workspace string) bool {
+	for _, seg := range segments {
+		for _, tok := range seg {
+			if !looksLikePath(tok) {
+				continue
+			}
+			p := expandHome(tok)
+			if !filepath.IsAbs(p) && workspace != "" {
+				p = filepath.Join(workspace, p)
+			}
+			p = filepath.Clean(p)
+			for _, prefix := range prefixes {
+				if p == prefix || strings.HasPrefix(p, prefix+string(filepath.Separator)) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func looksLikePath(tok string) bool {
+	return strings.HasPrefix(tok, "/") || strings.HasPrefix(tok, "~") || strings.HasPrefix(tok, ".") || strings.Contains(tok, "/")
+}
+
+func expandHome(p string) string {
+	if p == "" || p[0] != '~' {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	if len(p) == 1 || p[1] == '/' {
+		return filepath.Join(home, p[1:])
+	}
+	return p
+}
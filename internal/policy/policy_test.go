@@ -0,0 +1,98 @@
+package policy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/menezmethod/openclaw-cursor/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluate(t *testing.T) {
+	e, err := New(config.CommandPolicy{
+		Mode: ModeEnforce,
+		Rules: []config.CommandRule{
+			{Name: "allow-git-status", Action: "allow", Pattern: `^git status\b`},
+			{Name: "no-rm-rf", Action: "deny", Preset: "rm-rf"},
+			{Name: "push-needs-approval", Action: "approve", Preset: "git-push"},
+			{Name: "no-network", Action: "deny", Preset: "network"},
+			{Name: "no-ssh-dir", Action: "deny", PathPrefixes: []string{"/home/u/.ssh"}},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		command string
+		action  Action
+		rule    string
+	}{
+		{"ls -la", Allow, ""},
+		{"git status --short", Allow, "allow-git-status"},
+		{"rm -rf build", Deny, "no-rm-rf"},
+		{"rm -r -f build", Deny, "no-rm-rf"},
+		{"cd /tmp && sudo rm --recursive --force x", Deny, "no-rm-rf"},
+		{"rm -r build", Allow, ""},
+		{"git -C repo push origin main", Approve, "push-needs-approval"},
+		{"git commit -m 'push it'", Allow, ""},
+		{"echo hi | curl -X POST https://example.com -d @-", Deny, "no-network"},
+		{"FOO=1 /usr/bin/wget https://example.com", Deny, "no-network"},
+		{"cat /home/u/.ssh/id_rsa", Deny, "no-ssh-dir"},
+		{"cat ../.ssh/id_rsa", Deny, "no-ssh-dir"},
+		{"cat /home/u/.sshx/notes", Allow, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			d := e.Evaluate(tt.command, "/home/u/project")
+			assert.Equal(t, tt.action, d.Action)
+			assert.Equal(t, tt.rule, d.Rule)
+			assert.True(t, d.Enforced)
+		})
+	}
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	_, err := New(config.CommandPolicy{Mode: "strict"})
+	assert.Error(t, err)
+	_, err = New(config.CommandPolicy{Mode: ModeEnforce, Rules: []config.CommandRule{{Action: "deny"}}})
+	assert.Error(t, err)
+	_, err = New(config.CommandPolicy{Mode: ModeEnforce, Rules: []config.CommandRule{{Preset: "telepathy"}}})
+	assert.Error(t, err)
+	_, err = New(config.CommandPolicy{Mode: ModeEnforce, Rules: []config.CommandRule{{Pattern: "("}}})
+	assert.Error(t, err)
+}
+
+func TestCheck_AuditModeLogsButAllows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	e, err := New(config.CommandPolicy{
+		Mode:     ModeAudit,
+		AuditLog: path,
+		Rules:    []config.CommandRule{{Action: "deny", Preset: "rm-rf"}},
+	})
+	require.NoError(t, err)
+
+	d := e.Check("rm -rf /", AuditMeta{Workspace: "/w", CallID: "call_1"})
+	assert.Equal(t, Deny, d.Action)
+	assert.False(t, d.Blocks())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 1)
+	var entry AuditEntry
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "rm -rf /", entry.Command)
+	assert.Equal(t, Deny, entry.Action)
+	assert.Equal(t, "call_1", entry.CallID)
+	assert.False(t, entry.Enforced)
+}
+
+func TestCheck_Off(t *testing.T) {
+	e, err := New(config.CommandPolicy{})
+	require.NoError(t, err)
+	assert.False(t, e.Enabled())
+	assert.Equal(t, Allow, e.Check("rm -rf /", AuditMeta{}).Action)
+}
@@ -0,0 +1,137 @@
+package routing
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/menezmethod/openclaw-cursor/internal/config"
+	"github.com/menezmethod/openclaw-cursor/internal/models"
+)
+
+// Request is what routing rules can look at.
+type Request struct {
+	// Model is the model name as sent by the client (prefix and all).
+	Model       string
+	HasTools    bool
+	PromptChars int
+	// Agent is the x-openclaw-agent header.
+	Agent string
+	Now   time.Time
+}
+
+// Decision is the outcome of routing a request. Rule is empty when no rule
+// matched and Model is the requested model unchanged.
+type Decision struct {
+	Model string
+	Rule  string
+}
+
+type route struct {
+	name      string
+	target    string
+	models    map[string]bool
+	agents    map[string]bool
+	tools     *bool
+	minPrompt int
+	maxPrompt int
+	// from and to are minutes since midnight; from > to wraps midnight.
+	from, to int
+	hours    bool
+}
+
+// Router picks a target model from request properties. The first matching
+// rule wins.
+type Router struct {
+	routes []route
+}
+
+// New compiles routing rules from config.
+func New(rules []config.ModelRoute) (*Router, error) {
+	r := &Router{}
+	for i, rc := range rules {
+		rt := route{name: rc.Name, target: strings.TrimSpace(rc.Target), tools: rc.Tools, minPrompt: rc.MinPromptChars, maxPrompt: rc.MaxPromptChars}
+		if rt.name == "" {
+			rt.name = fmt.Sprintf("route-%d", i+1)
+		}
+		if rt.target == "" {
+			return nil, fmt.Errorf("model route %s: target is required", rt.name)
+		}
+		if len(rc.Models) > 0 {
+			rt.models = make(map[string]bool)
+			for _, m := range rc.Models {
+				rt.models[models.StripPrefix(m)] = true
+			}
+		}
+		if len(rc.Agents) > 0 {
+			rt.agents = make(map[string]bool)
+			for _, a := range rc.Agents {
+				rt.agents[a] = true
+			}
+		}
+		if rc.Hours != "" {
+			from, to, err := parseHours(rc.Hours)
+			if err != nil {
+				return nil, fmt.Errorf("model route %s: %w", rt.name, err)
+			}
+			rt.from, rt.to, rt.hours = from, to, true
+		}
+		r.routes = append(r.routes, rt)
+	}
+	return r, nil
+}
+
+// parseHours parses "HH:MM-HH:MM" into minutes since midnight.
+func parseHours(s string) (int, int, error) {
+	a, b, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("hours %q: want HH:MM-HH:MM", s)
+	}
+	from, err := time.Parse("15:04", strings.TrimSpace(a))
+	if err != nil {
+		return 0, 0, fmt.Errorf("hours %q: %w", s, err)
+	}
+	to, err := time.Parse("15:04", strings.TrimSpace(b))
+	if err != nil {
+		return 0, 0, fmt.Errorf("hours %q: %w", s, err)
+	}
+	return from.Hour()*60 + from.Minute(), to.Hour()*60 + to.Minute(), nil
+}
+
+// Route returns the model to use for req.
+func (r *Router) Route(req Request) Decision {
+	if r != nil {
+		for _, rt := range r.routes {
+			if rt.matches(req) {
+				return Decision{Model: rt.target, Rule: rt.name}
+			}
+		}
+	}
+	return Decision{Model: req.Model}
+}
+
+func (rt route) matches(req Request) bool {
+	if rt.models != nil && !rt.models[models.StripPrefix(req.Model)] {
+		return false
+	}
+	if rt.agents != nil && !rt.agents[req.Agent] {
+		return false
+	}
+	if rt.tools != nil && *rt.tools != req.HasTools {
+		return false
+	}
+	if rt.minPrompt > 0 && req.PromptChars < rt.minPrompt {
+		return false
+	}
+	if rt.maxPrompt > 0 && req.PromptChars > rt.maxPrompt {
+		return false
+	}
+	if rt.hours {
+		now := req.Now.Hour()*60 + req.Now.Minute()
+		if rt.from <= rt.to {
+			return now >= rt.from && now < rt.to
+		}
+		return now >= rt.from || now < rt.to
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package routing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/menezmethod/openclaw-cursor/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoute(t *testing.T) {
+	yes, no := true, false
+	r, err := New([]config.ModelRoute{
+		{Name: "night", Target: "composer-1", Hours: "22:00-06:00"},
+		{Name: "reviewer", Target: "opus-4.6-thinking", Agents: []string{"reviewer"}},
+		{Name: "big-prompts", Target: "gemini-3-pro", Models: []string{"smart"}, MinPromptChars: 100000},
+		{Name: "smart-tools", Target: "gpt-5.3-codex", Models: []string{"cursor/smart"}, Tools: &yes},
+		{Name: "smart-chat", Target: "sonnet-4.5", Models: []string{"smart"}, Tools: &no},
+	})
+	require.NoError(t, err)
+
+	noon := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		name string
+		req  Request
+		want Decision
+	}{
+		{"no match", Request{Model: "cursor/auto", Now: noon}, Decision{Model: "cursor/auto"}},
+		{"night", Request{Model: "cursor/auto", Now: noon.Add(11 * time.Hour)}, Decision{Model: "composer-1", Rule: "night"}},
+		{"early morning", Request{Model: "cursor/auto", Now: noon.Add(-7 * time.Hour)}, Decision{Model: "composer-1", Rule: "night"}},
+		{"night ends", Request{Model: "cursor/auto", Now: noon.Add(-6 * time.Hour)}, Decision{Model: "cursor/auto"}},
+		{"agent", Request{Model: "cursor/smart", Agent: "reviewer", Now: noon}, Decision{Model: "opus-4.6-thinking", Rule: "reviewer"}},
+		{"big prompt", Request{Model: "cursor/smart", PromptChars: 200000, HasTools: true, Now: noon}, Decision{Model: "gemini-3-pro", Rule: "big-prompts"}},
+		{"tools", Request{Model: "cursor/smart", HasTools: true, Now: noon}, Decision{Model: "gpt-5.3-codex", Rule: "smart-tools"}},
+		{"chat", Request{Model: "smart", Now: noon}, Decision{Model: "sonnet-4.5", Rule: "smart-chat"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, r.Route(tt.req))
+		})
+	}
+}
+
+func TestNewRejectsBadRules(t *testing.T) {
+	_, err := New([]config.ModelRoute{{Name: "x"}})
+	assert.Error(t, err)
+	_, err = New([]config.ModelRoute{{Target: "auto", Hours: "9-5"}})
+	assert.Error(t, err)
+
+	var r *Router
+	assert.Equal(t, Decision{Model: "auto"}, r.Route(Request{Model: "auto"}))
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/menezmethod/openclaw-cursor/internal/attachments"
+	"github.com/menezmethod/openclaw-cursor/internal/errors"
+	"github.com/menezmethod/openclaw-cursor/internal/translator"
+	"github.com/menezmethod/openclaw-cursor/internal/workspace"
+)
+
+// saveAttachments writes the request's image and file parts to a scratch
+// directory inside agentDir and points the messages at them. Local file
+// references may come from the workspace or the configured roots. The
+// returned cleanup removes the directory once the run is over.
+func (s *Server) saveAttachments(ctx context.Context, req translator.ChatCompletionRequest, wsPath, agentDir, reqID string) (translator.ChatCompletionRequest, func(), *errors.ParsedError) {
+	opts := attachments.Options{
+		AllowRemote: s.cfg.Attachments.AllowRemote,
+		LocalRoots:  append([]string{wsPath, agentDir}, s.cfg.Attachments.LocalRoots...),
+		MaxBytes:    s.cfg.Attachments.MaxBytes,
+	}
+	var scratch *workspace.Scratch
+	cleanup := func() {
+		if scratch != nil {
+			if err := scratch.Remove(); err != nil {
+				s.log.Warn("remove attachments", "dir", scratch.Dir, "err", err)
+			}
+		}
+	}
+	var pe *errors.ParsedError
+	out, err := translator.ReplaceAttachments(req, func(a translator.Attachment) (string, error) {
+		f, err := attachments.Load(ctx, a.Ref, a.Filename, opts)
+		if err != nil {
+			pe = &errors.ParsedError{Type: "invalid_request", Message: fmt.Sprintf("Cannot use %s attachment: %v", a.Kind, err)}
+			return "", err
+		}
+		if scratch == nil {
+			if scratch, err = workspace.NewScratch(agentDir, "req-"+reqID); err != nil {
+				pe = &errors.ParsedError{Type: "workspace_error", Message: err.Error()}
+				return "", err
+			}
+		}
+		path, err := scratch.Write(f.Name, f.Data)
+		if err != nil {
+			pe = &errors.ParsedError{Type: "workspace_error", Message: err.Error()}
+		}
+		return path, err
+	})
+	if err != nil {
+		cleanup()
+		if pe == nil {
+			pe = &errors.ParsedError{Type: "invalid_request", Message: err.Error()}
+		}
+		return req, func() {}, pe
+	}
+	return out, cleanup, nil
+}
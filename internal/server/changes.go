@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/menezmethod/openclaw-cursor/internal/errors"
+	"github.com/menezmethod/openclaw-cursor/internal/snapshot"
+	"github.com/menezmethod/openclaw-cursor/internal/workspace"
+)
+
+// snapshotOptions returns the capture limits, leaving out the proxy's own
+// snapshot archive and isolation copies in case the workspace contains them
+// (e.g. when it is $HOME).
+func (s *Server) snapshotOptions() snapshot.Options {
+	opts := snapshot.OptionsFromConfig(s.cfg)
+	archive, isolation := s.cfg.Snapshots.Dir, s.cfg.Isolation.Dir
+	if archive == "" {
+		archive = snapshot.DefaultArchiveDir()
+	}
+	if isolation == "" {
+		isolation = workspace.DefaultIsolationDir()
+	}
+	for _, dir := range []string{archive, isolation} {
+		if dir, err := workspace.Canonicalize(dir, ""); err == nil {
+			opts.SkipDirs = append(opts.SkipDirs, dir)
+		}
+	}
+	return opts
+}
+
+// snapshotBefore captures the workspace before cursor-agent runs, into the
+// archive when snapshots are enabled. It returns nil when neither change
+// reports nor snapshots are on, or the capture fails; the request goes ahead
+// either way.
+func (s *Server) snapshotBefore(dir string) *snapshot.Snapshot {
+	if !s.cfg.ChangeReport.Enabled && s.archive == nil {
+		return nil
+	}
+	var snap *snapshot.Snapshot
+	var err error
+	if s.archive != nil {
+		snap, err = s.archive.Take(dir)
+	} else {
+		snap, err = snapshot.Take(dir, nil, s.snapshotOptions())
+	}
+	if err != nil {
+		s.log.Warn("snapshot workspace", "dir", dir, "err", err)
+		return nil
+	}
+	if snap.Truncated {
+		s.log.Debug("workspace exceeds snapshot limits, change report is partial", "dir", dir, "files", len(snap.Files))
+	}
+	return snap
+}
+
+// changeExtensions rescans the workspace, diffs it against the pre-run
+// snapshot and, when the run changed something, archives the pre-run state.
+func (s *Server) changeExtensions(t *turn, ext map[string]interface{}) {
+	after, err := t.before.Rescan()
+	if err != nil {
+		s.log.Warn("rescan workspace", "dir", t.before.Root, "err", err)
+		return
+	}
+	report := snapshot.Compare(t.before, after, s.cfg.ChangeReport.MaxDiffBytes)
+	if report.Empty() {
+		if s.cfg.ChangeReport.Enabled {
+			ext["openclaw_changes"] = report
+		}
+		return
+	}
+	s.log.Info("agent changed files", "dir", t.before.Root,
+		"created", len(report.Created), "modified", len(report.Modified), "deleted", len(report.Deleted))
+	if s.cfg.ChangeReport.Enabled {
+		ext["openclaw_changes"] = report
+	}
+	if s.archive != nil {
+		m, err := s.archive.Save(t.before, snapshot.Manifest{RequestID: t.id, Model: t.modelID})
+		if err != nil {
+			s.log.Warn("archive snapshot", "dir", t.before.Root, "err", err)
+		}
+		if m != nil {
+			ext["openclaw_snapshot"] = map[string]interface{}{"id": m.ID, "workspace": m.Workspace}
+		}
+	}
+}
+
+func (s *Server) snapshotsDisabled(w http.ResponseWriter) bool {
+	if s.archive != nil {
+		return false
+	}
+	s.writeError(w, &errors.ParsedError{Type: "not_found", Message: "Snapshots are disabled", Suggestion: `Set "snapshots": {"enabled": true} in the proxy config`})
+	return true
+}
+
+func (s *Server) handleListSnapshots(w http.ResponseWriter, r *http.Request) {
+	if s.snapshotsDisabled(w) {
+		return
+	}
+	ws := r.URL.Query().Get("workspace")
+	if ws != "" {
+		if c, err := workspace.Canonicalize(ws, "/"); err == nil {
+			ws = c
+		}
+	}
+	list, err := s.archive.List(ws)
+	if err != nil {
+		s.writeError(w, &errors.ParsedError{Type: "snapshot_error", Message: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"object": "list", "data": list})
+}
+
+func (s *Server) handleGetSnapshot(w http.ResponseWriter, r *http.Request) {
+	if s.snapshotsDisabled(w) {
+		return
+	}
+	m, err := s.archive.Load(r.PathValue("id"))
+	if err != nil {
+		s.writeError(w, &errors.ParsedError{Type: "not_found", Message: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+// handleRestoreSnapshot rolls a workspace back. It takes the workspace lock
+// so a restore can't race a running agent; ?dry_run=true only reports.
+func (s *Server) handleRestoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	if s.snapshotsDisabled(w) {
+		return
+	}
+	id := r.PathValue("id")
+	m, err := s.archive.Load(id)
+	if err != nil {
+		s.writeError(w, &errors.ParsedError{Type: "not_found", Message: err.Error()})
+		return
+	}
+	release, err := s.acquireLock(r, m.Workspace, workspace.Holder{ID: "restore-" + id, Access: workspace.AccessWrite})
+	if err != nil {
+		s.writeError(w, lockError(err))
+		return
+	}
+	defer release()
+
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	res, err := s.archive.Restore(id, dryRun)
+	if err != nil {
+		s.writeError(w, &errors.ParsedError{Type: "snapshot_error", Message: err.Error()})
+		return
+	}
+	s.log.Info("restored snapshot", "id", id, "workspace", m.Workspace, "dry_run", dryRun,
+		"restored", len(res.Restored), "deleted", len(res.Deleted), "backup", res.Backup)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
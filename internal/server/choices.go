@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/menezmethod/openclaw-cursor/internal/errors"
+	"github.com/menezmethod/openclaw-cursor/internal/streaming"
+	"github.com/menezmethod/openclaw-cursor/internal/workspace"
+)
+
+// forEachChoice runs fn for every choice of t at once, each on its own copy
+// of t: choice 0 on t's run, the others on a fresh run of the same prompt in
+// their workspace copy (see isolateCopies), so parallel agents don't edit
+// the same files. fn gets the error instead of a turn when a run could not
+// start.
+func (s *Server) forEachChoice(t *turn, fn func(i int, c *turn, pe *errors.ParsedError)) {
+	base := *t
+	var wg sync.WaitGroup
+	for i := 0; i < max(t.n, 1); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := base
+			if i == 0 {
+				fn(0, &c, nil)
+				return
+			}
+			iso := base.choiceIsos[i-1]
+			c.iso, c.workspace = iso, iso.Path
+			c.before = s.snapshotBefore(iso.Path)
+			proc, err := c.spawn(c.workspace, c.prompt)
+			if err != nil {
+				s.log.Warn("choice failed to start", "choice", i, "err", err)
+				fn(i, nil, errors.Parse(err.Error()))
+				return
+			}
+			c.proc = proc
+			defer func() { _ = c.proc.Kill() }()
+			fn(i, &c, nil)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// isolateCopies copies dir, the workspace the request's first run uses (in
+// session mode, the session's copy with its earlier edits), n-1 times, for
+// extra choices or hedge candidates, with the request's scratch files
+// (attachments, tool results). It runs before any agent starts, so every run
+// begins from the same state. The returned release removes the copies.
+func (s *Server) isolateCopies(dir string, n int) ([]*workspace.Isolated, func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	var isos []*workspace.Isolated
+	release := func() {
+		for _, iso := range isos {
+			if err := s.isolator.Release(iso, s.cfg.Isolation.KeepWorktree); err != nil {
+				s.log.Warn("remove workspace copy", "path", iso.Root, "err", err)
+			}
+		}
+	}
+	for i := 1; i < n; i++ {
+		iso, err := s.isolator.Acquire(ctx, dir, workspace.NewKey())
+		if err == nil {
+			isos = append(isos, iso)
+			err = workspace.CopyScratch(dir, iso.Path)
+		}
+		if err != nil {
+			release()
+			return nil, func() {}, fmt.Errorf("workspace copy %d: %w", i, err)
+		}
+	}
+	return isos, release, nil
+}
+
+// choiceResult is how one choice ended: a result or an error, plus the
+// extensions of an extra choice's own workspace.
+type choiceResult struct {
+	res *runResult
+	err *errors.ParsedError
+	ext map[string]interface{}
+}
+
+// runChoices runs every choice of t to completion, enforcing
+// response_format on each.
+func (s *Server) runChoices(t *turn) []choiceResult {
+	results := make([]choiceResult, max(t.n, 1))
+	s.forEachChoice(t, func(i int, c *turn, pe *errors.ParsedError) {
+		var res *runResult
+		if pe == nil {
+			res, pe = s.collect(c, c.prompt)
+		}
+		if pe == nil {
+			res, pe = s.conform(c, res)
+		}
+		if pe != nil && t.n > 1 {
+			s.log.Warn("choice failed", "choice", i, "type", pe.Type, "err", pe.Message)
+		}
+		results[i] = choiceResult{res: res, err: pe}
+		if i > 0 && c != nil {
+			results[i].ext = s.extensions(c)
+		}
+	})
+	return results
+}
+
+// allFailed returns the first choice's error when no choice succeeded, so
+// the request fails as a whole; otherwise failed choices are reported
+// alongside the others.
+func allFailed(results []choiceResult) *errors.ParsedError {
+	for _, r := range results {
+		if r.err == nil {
+			return nil
+		}
+	}
+	return results[0].err
+}
+
+// failedChoice is a choice whose run failed: finish_reason "error" and the
+// error in OpenAI's format.
+func failedChoice(index int, pe *errors.ParsedError) map[string]interface{} {
+	return map[string]interface{}{
+		"index":         index,
+		"message":       map[string]interface{}{"role": "assistant", "content": nil},
+		"finish_reason": "error",
+		"error":         errors.ToOpenAIError(pe).Error,
+	}
+}
+
+// sseWriter serializes the chunks of concurrent choices onto one stream.
+type sseWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	flusher http.Flusher
+}
+
+// write sends chunks as one unit and flushes them.
+func (o *sseWriter) write(chunks ...[]byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, c := range chunks {
+		if len(c) > 0 {
+			o.w.Write(c)
+		}
+	}
+	o.flusher.Flush()
+}
+
+// choiceError ends a failed choice of a stream: a named
+// "openclaw.choice_error" event with the index and error, then a chunk with
+// finish_reason "error".
+func choiceError(conv *streaming.Converter, pe *errors.ParsedError) [][]byte {
+	b, _ := json.Marshal(map[string]interface{}{"index": conv.Index, "error": errors.ToOpenAIError(pe).Error})
+	return [][]byte{[]byte(fmt.Sprintf("event: openclaw.choice_error\ndata: %s\n\n", b)), conv.Finish("error")}
+}
+
+// choiceExtensions reports what an extra choice did in its own workspace
+// copy: an "openclaw.choice" event with the index and its extensions.
+func choiceExtensions(index int, ext map[string]interface{}) []byte {
+	if len(ext) == 0 {
+		return nil
+	}
+	m := map[string]interface{}{"index": index}
+	for k, v := range ext {
+		m[k] = v
+	}
+	b, _ := json.Marshal(m)
+	return []byte(fmt.Sprintf("event: openclaw.choice\ndata: %s\n\n", b))
+}
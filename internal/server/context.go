@@ -0,0 +1,35 @@
+package server
+
+import (
+	"slices"
+
+	"github.com/menezmethod/openclaw-cursor/internal/models"
+	"github.com/menezmethod/openclaw-cursor/internal/translator"
+)
+
+// contextOptions derives the prompt budget for modelID: its context window
+// minus what the response may use.
+func (s *Server) contextOptions(req translator.ChatCompletionRequest, modelID string) translator.ContextOptions {
+	cw := s.cfg.ContextWindow
+	m, ok := models.Get(modelID)
+	if !ok {
+		m = models.Model{ContextWindow: models.DefaultContextWindow, MaxTokens: models.DefaultMaxTokens}
+	}
+	reserve := cw.ReserveTokens
+	if reserve <= 0 {
+		reserve = m.MaxTokens
+		if n := req.CompletionLimit(); n > 0 && n < reserve {
+			reserve = n
+		}
+	}
+	return translator.ContextOptions{
+		Strategy:            cw.Strategy,
+		Limit:               m.ContextWindow - reserve,
+		KeepRecent:          cw.KeepRecent,
+		MaxToolResultTokens: cw.MaxToolResultTokens,
+	}
+}
+
+func validContextStrategy(s string) bool {
+	return slices.Contains(translator.ContextStrategies, s)
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/menezmethod/openclaw-cursor/internal/agent"
+	"github.com/menezmethod/openclaw-cursor/internal/models"
+)
+
+// refreshModels asks cursor-agent for its model list now and then every
+// ModelRefreshMinutes. Failures keep the cached or built-in list.
+func (s *Server) refreshModels(ctx context.Context) {
+	interval := time.Duration(s.cfg.ModelRefreshMinutes) * time.Minute
+	for {
+		listCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		n, err := models.Refresh(listCtx, agent.ListModels, models.DefaultCachePath())
+		cancel()
+		if err != nil {
+			s.log.Warn("model discovery failed, using cached list", "err", err)
+		} else {
+			s.log.Info("discovered cursor-agent models", "count", n)
+		}
+		if interval <= 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/menezmethod/openclaw-cursor/internal/agent"
+	"github.com/menezmethod/openclaw-cursor/internal/config"
+	"github.com/menezmethod/openclaw-cursor/internal/models"
+	"github.com/menezmethod/openclaw-cursor/internal/streaming"
+	"github.com/menezmethod/openclaw-cursor/internal/tools"
+	"github.com/menezmethod/openclaw-cursor/internal/translator"
+)
+
+// hedgeFor returns the hedges entry for a request, looked up by the
+// requested name (with or without the cursor/ prefix) and then by the
+// resolved model.
+func (s *Server) hedgeFor(requested, modelID string) (string, config.Hedge, bool) {
+	for _, k := range []string{requested, models.StripPrefix(requested), modelID} {
+		if h, ok := s.cfg.Hedges[k]; ok {
+			return k, h, true
+		}
+	}
+	return "", config.Hedge{}, false
+}
+
+// candidate is one contender in a hedged request.
+type candidate struct {
+	modelID, prompt string
+	// dir is the workspace the candidate runs in.
+	dir string
+}
+
+// hedgeCandidates resolves a hedge's models the way the request's own model
+// was resolved (aliases, then the requested effort or thinking variant) and
+// renders each one's prompt. Models that don't resolve are skipped.
+func (s *Server) hedgeCandidates(h config.Hedge, req, fitted translator.ChatCompletionRequest, loop tools.LoopVerdict) []candidate {
+	names := h.Models
+	if len(names) == 0 {
+		names = []string{req.Model, req.Model}
+	}
+	var out []candidate
+	for _, name := range names {
+		id, err := models.Resolve(name)
+		if err != nil {
+			s.log.Warn("skipping hedge candidate", "model", name, "err", err)
+			continue
+		}
+		id = models.Variant(id, req.Effort(), req.ThinkingToggle())
+		prompt, err := s.renderPrompt(fitted, req.Model, id, loop)
+		if err != nil {
+			s.log.Warn("skipping hedge candidate", "model", id, "err", err)
+			continue
+		}
+		out = append(out, candidate{modelID: id, prompt: prompt})
+	}
+	return out
+}
+
+// hedge races the candidates (see agent.Race) and returns the winner's
+// index and process. Candidates after the first only start if an agent slot is
+// free. Races, launched hedges and winners are counted in the metrics.
+func (s *Server) hedge(ctx context.Context, name string, h config.Hedge, cands []candidate, opts agent.Options) (int, *agent.Process, error) {
+	race := agent.Race{Delay: time.Duration(h.DelayMs) * time.Millisecond, Output: isOutput}
+	for i, c := range cands {
+		opts := opts
+		opts.Model, opts.Prompt, opts.Workspace = c.modelID, c.prompt, c.dir
+		spawn := s.agents.Spawn
+		if i > 0 {
+			spawn = s.agents.TrySpawn
+		}
+		race.Start = append(race.Start, func() (*agent.Process, error) { return spawn(ctx, opts) })
+	}
+	winner, started, proc, err := race.Run(ctx)
+	s.metrics.Inc("openclaw_cursor_hedged_requests_total", "alias", name)
+	if started > 1 {
+		s.metrics.Inc("openclaw_cursor_hedges_launched_total", "alias", name)
+	}
+	if err != nil {
+		return -1, nil, err
+	}
+	c := cands[winner]
+	s.metrics.Inc("openclaw_cursor_hedge_wins_total", "alias", name, "candidate", strconv.Itoa(winner), "model", c.modelID)
+	s.log.Info("hedged request", "alias", name, "winner", winner, "model", c.modelID, "started", started)
+	return winner, proc, nil
+}
+
+// isOutput reports whether a line of cursor-agent output is generated
+// text, reasoning or a tool call: the first token of a hedged run.
+func isOutput(line []byte) bool {
+	e, err := streaming.ParseEvent(line)
+	if err != nil || e == nil {
+		return false
+	}
+	return e.IsAssistantText() || e.IsThinking() || e.IsToolCall()
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.metrics.WriteTo(w)
+}
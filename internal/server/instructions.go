@@ -0,0 +1,65 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/menezmethod/openclaw-cursor/internal/models"
+	"github.com/menezmethod/openclaw-cursor/internal/workspace"
+)
+
+// systemPrompt returns the proxy's own instructions for a request: the
+// global system_prompt, then every system_prompts rule that matches the
+// requested model, the model it resolved to, and the workspace.
+func (s *Server) systemPrompt(requested, modelID, wsPath string) string {
+	var parts []string
+	if p := strings.TrimSpace(s.cfg.SystemPrompt); p != "" {
+		parts = append(parts, p)
+	}
+	for _, rule := range s.cfg.SystemPrompts {
+		p := strings.TrimSpace(rule.Prompt)
+		if p == "" {
+			continue
+		}
+		if len(rule.Models) > 0 && !matchesModel(rule.Models, requested, modelID) {
+			continue
+		}
+		if len(rule.Workspaces) > 0 && !matchesWorkspace(rule.Workspaces, wsPath) {
+			continue
+		}
+		parts = append(parts, p)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// matchesModel reports whether any of names is the requested model, the
+// resolved model, an alias of it, or its family.
+func matchesModel(names []string, requested, modelID string) bool {
+	family := ""
+	if m, ok := models.Get(modelID); ok {
+		family = m.Family
+	}
+	requested = models.StripPrefix(requested)
+	for _, n := range names {
+		n = models.StripPrefix(n)
+		if n == requested || n == modelID || (family != "" && n == family) {
+			return true
+		}
+		if id, err := models.Resolve(n); err == nil && id == modelID {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesWorkspace(dirs []string, wsPath string) bool {
+	ws, err := workspace.Canonicalize(wsPath, "/")
+	if err != nil {
+		return false
+	}
+	for _, d := range dirs {
+		if dir, err := workspace.Canonicalize(d, "/"); err == nil && workspace.Within(ws, dir) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/menezmethod/openclaw-cursor/internal/workspace"
+)
+
+// isolationKey picks the worktree key: the OpenClaw session in session mode
+// (so follow-up turns see earlier edits), otherwise a fresh per-request key.
+func (s *Server) isolationKey(r *http.Request) string {
+	if s.cfg.Isolation.Mode == workspace.IsolationSession {
+		if id := strings.TrimSpace(r.Header.Get("x-openclaw-session-id")); id != "" {
+			return "session-" + id
+		}
+	}
+	return workspace.NewKey()
+}
+
+// isolate creates (or reuses) the isolated copy of the workspace for this request.
+func (s *Server) isolate(r *http.Request, source string) (*workspace.Isolated, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+	iso, err := s.isolator.Acquire(ctx, source, s.isolationKey(r))
+	if err != nil {
+		return nil, err
+	}
+	s.log.Debug("isolated workspace", "source", source, "path", iso.Path, "git", iso.Git, "reused", iso.Reused)
+	return iso, nil
+}
+
+// keepIsolated reports whether the copy outlives the request: session copies
+// are kept until they go stale, request copies only when keep_worktree is set.
+func (s *Server) keepIsolated() bool {
+	return s.cfg.Isolation.Mode == workspace.IsolationSession || s.cfg.Isolation.KeepWorktree
+}
+
+// releaseIsolated removes a per-request copy once the response is written.
+func (s *Server) releaseIsolated(iso *workspace.Isolated) {
+	if iso == nil {
+		return
+	}
+	if err := s.isolator.Release(iso, s.keepIsolated()); err != nil {
+		s.log.Warn("remove isolated workspace", "path", iso.Root, "err", err)
+	}
+}
+
+// isolationReport builds the openclaw_workspace extension: where the agent ran
+// and the diff of what it changed there.
+func (s *Server) isolationReport(iso *workspace.Isolated) map[string]interface{} {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	report := map[string]interface{}{
+		"isolated": true,
+		"mode":     s.cfg.Isolation.Mode,
+		"source":   iso.Source,
+		"path":     iso.Path,
+		"git":      iso.Git,
+		"kept":     s.keepIsolated(),
+	}
+	diff, err := iso.Diff(ctx, s.cfg.Isolation.MaxDiffBytes)
+	if err != nil {
+		s.log.Warn("diff isolated workspace", "path", iso.Root, "err", err)
+		report["error"] = err.Error()
+	} else {
+		report["diff"] = diff
+	}
+	return report
+}
+
+// cleanupIsolated removes stale worktrees at boot and then hourly.
+func (s *Server) cleanupIsolated(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if n, err := s.isolator.CleanupStale(); err != nil {
+			s.log.Warn("clean stale worktrees", "err", err)
+		} else if n > 0 {
+			s.log.Info("removed stale worktrees", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"strings"
+
+	"github.com/menezmethod/openclaw-cursor/internal/errors"
+	"github.com/menezmethod/openclaw-cursor/internal/workspace"
+)
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "req-" + hex.EncodeToString(b)
+}
+
+// lockWorkspace takes the workspace lock for the directory cursor-agent runs in.
+// The lock is keyed on the repository (or workspace root) around dir so nested
+// paths share it. Clients that only read can send
+// x-openclaw-workspace-access: read to share the workspace under the
+// shared-read policy.
+func (s *Server) lockWorkspace(r *http.Request, dir, reqID, modelID string) (func(), error) {
+	access := workspace.AccessWrite
+	if strings.EqualFold(strings.TrimSpace(r.Header.Get("x-openclaw-workspace-access")), workspace.AccessRead) {
+		access = workspace.AccessRead
+	}
+	return s.acquireLock(r, dir, workspace.Holder{ID: reqID, Model: modelID, Access: access})
+}
+
+func (s *Server) acquireLock(r *http.Request, dir string, h workspace.Holder) (func(), error) {
+	if s.locks.Mode() == workspace.LockOff {
+		return func() {}, nil
+	}
+	key := workspace.LockKey(r.Context(), dir)
+	release, err := s.locks.Acquire(r.Context(), key, h)
+	if err != nil {
+		s.log.Info("workspace lock not acquired", "workspace", key, "policy", s.locks.Mode(), "err", err)
+	}
+	return release, err
+}
+
+func lockError(err error) *errors.ParsedError {
+	if stderrors.Is(err, workspace.ErrBusy) {
+		return &errors.ParsedError{
+			Type:        "workspace_busy",
+			Message:     err.Error(),
+			Recoverable: true,
+			Suggestion:  "Another agent is working in this workspace; retry when it finishes",
+		}
+	}
+	return &errors.ParsedError{Type: "workspace_busy", Message: "gave up waiting for workspace lock: " + err.Error(), Recoverable: true}
+}
+
+func (s *Server) handleListLocks(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]interface{}{
+		"policy": s.locks.Mode(),
+		"locks":  s.locks.Locks(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/menezmethod/openclaw-cursor/internal/config"
+	"github.com/menezmethod/openclaw-cursor/internal/models"
+	"github.com/menezmethod/openclaw-cursor/internal/routing"
+	"github.com/menezmethod/openclaw-cursor/internal/tools"
+	"github.com/menezmethod/openclaw-cursor/internal/translator"
+)
+
+// promptTemplates holds the configured prompt templates. nil entries render
+// the built-in format.
+type promptTemplates struct {
+	def    *translator.Template
+	models map[string]*translator.Template
+	names  []string // keys of models, sorted
+}
+
+// loadTemplates parses the configured templates. A template that fails to
+// load is logged and left to the built-in one.
+func loadTemplates(cfg config.PromptTemplates, log *slog.Logger) promptTemplates {
+	var p promptTemplates
+	if cfg.Default != "" {
+		t, err := translator.LoadTemplate(cfg.Default)
+		if err != nil {
+			log.Error("invalid default prompt template, using the built-in one", "err", err)
+		}
+		p.def = t
+	}
+	p.models = make(map[string]*translator.Template)
+	for name, path := range cfg.Models {
+		t, err := translator.LoadTemplate(path)
+		if err != nil {
+			log.Error("invalid prompt template, using the default", "model", name, "err", err)
+			continue
+		}
+		name = models.StripPrefix(name)
+		p.models[name] = t
+		p.names = append(p.names, name)
+	}
+	sort.Strings(p.names)
+	return p
+}
+
+// pick returns the template for a request: by resolved model id, by the
+// requested name, by an alias of the model, then by family.
+func (p promptTemplates) pick(requested, modelID string) *translator.Template {
+	if t, ok := p.models[modelID]; ok {
+		return t
+	}
+	if t, ok := p.models[models.StripPrefix(requested)]; ok {
+		return t
+	}
+	for _, name := range p.names {
+		if id, err := models.Resolve(name); err == nil && id == modelID {
+			return p.models[name]
+		}
+	}
+	if m, ok := models.Get(modelID); ok && m.Family != "" {
+		if t, ok := p.models[m.Family]; ok {
+			return t
+		}
+	}
+	return p.def
+}
+
+// renderPrompt renders req with the template for the model and adds the
+// loop guard's instruction when it tripped.
+func (s *Server) renderPrompt(req translator.ChatCompletionRequest, requested, modelID string, loop tools.LoopVerdict) (string, error) {
+	prompt, err := s.templates.pick(requested, modelID).Render(req)
+	if err != nil {
+		return "", err
+	}
+	if loop.Stop {
+		prompt = translator.AppendMessage(prompt, "system", tools.LoopStopInstruction)
+	}
+	return prompt, nil
+}
+
+// PreviewPrompt returns the model a request would run on and the prompt
+// cursor-agent would receive for it in wsPath: routing, system prompts,
+// context fitting, tool result spilling, the prompt template and the loop
+// guard all apply, but attachments and spilled tool results are not saved.
+func (s *Server) PreviewPrompt(req translator.ChatCompletionRequest, wsPath string) (modelID, prompt string, err error) {
+	full, err := translator.BuildPrompt(req)
+	if err != nil {
+		return "", "", err
+	}
+	route := s.router.Route(routing.Request{
+		Model:       req.Model,
+		HasTools:    len(req.Tools) > 0,
+		PromptChars: len(full),
+		Now:         time.Now(),
+	})
+	if modelID, err = models.Resolve(route.Model); err != nil {
+		return "", "", err
+	}
+	modelID = models.Variant(modelID, req.Effort(), req.ThinkingToggle())
+	req = translator.WithSystemPrompt(req, s.systemPrompt(req.Model, modelID, wsPath))
+	loop := tools.CheckMessages(req.Messages, s.cfg.MaxToolCallRepeats, s.cfg.MaxToolLoopIterations)
+	req, _ = translator.SpillToolResults(req, s.spillOptions("req-preview"))
+	fitted, _, err := translator.FitContext(req, s.contextOptions(req, modelID))
+	if err != nil {
+		return modelID, "", err
+	}
+	prompt, err = s.renderPrompt(fitted, req.Model, modelID, loop)
+	if err != nil {
+		return modelID, "", fmt.Errorf("%s: %w", modelID, err)
+	}
+	return modelID, prompt, nil
+}
@@ -1,17 +1,19 @@
 package server
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -19,23 +21,86 @@ import (
 	"github.com/menezmethod/openclaw-cursor/internal/auth"
 	"github.com/menezmethod/openclaw-cursor/internal/config"
 	"github.com/menezmethod/openclaw-cursor/internal/errors"
+	"github.com/menezmethod/openclaw-cursor/internal/metrics"
 	"github.com/menezmethod/openclaw-cursor/internal/models"
+	"github.com/menezmethod/openclaw-cursor/internal/policy"
+	"github.com/menezmethod/openclaw-cursor/internal/routing"
+	"github.com/menezmethod/openclaw-cursor/internal/snapshot"
 	"github.com/menezmethod/openclaw-cursor/internal/streaming"
+	"github.com/menezmethod/openclaw-cursor/internal/structured"
+	"github.com/menezmethod/openclaw-cursor/internal/tools"
 	"github.com/menezmethod/openclaw-cursor/internal/translator"
+	"github.com/menezmethod/openclaw-cursor/internal/workspace"
 )
 
 // Server is the HTTP proxy server.
 type Server struct {
-	cfg     *config.Config
-	log     *slog.Logger
-	mux     *http.ServeMux
-	server  *http.Server
-	version string
+	cfg       *config.Config
+	log       *slog.Logger
+	mux       *http.ServeMux
+	server    *http.Server
+	version   string
+	policy    *policy.Engine
+	isolator  *workspace.Isolator
+	locks     *workspace.LockManager
+	archive   *snapshot.Archive
+	router    *routing.Router
+	templates promptTemplates
+	// agents caps concurrent cursor-agent processes (max_concurrent_agents).
+	agents *agent.Limiter
+	// metrics are served at /metrics.
+	metrics metrics.Registry
+	// scratchRoots are the directories with session tool result files.
+	scratchRoots sync.Map
 }
 
 // New creates a new server. version is logged on boot (e.g. "1.0.0" or "dev").
 func New(cfg *config.Config, log *slog.Logger, version string) *Server {
 	s := &Server{cfg: cfg, log: log, mux: http.NewServeMux(), version: version}
+	pol, err := policy.New(cfg.CommandPolicy)
+	if err != nil {
+		// Fail closed: a broken policy must not silently allow everything.
+		log.Error("invalid command policy, denying all commands", "err", err)
+		pol, _ = policy.New(config.CommandPolicy{Mode: policy.ModeEnforce, DefaultAction: string(policy.Deny)})
+	}
+	s.policy = pol
+	s.agents = agent.NewLimiter(cfg.MaxConcurrentAgents)
+	if m := cfg.Isolation.Mode; m != "" && m != workspace.IsolationOff {
+		maxAge := time.Duration(cfg.Isolation.MaxAgeMinutes) * time.Minute
+		s.isolator = workspace.NewIsolator(cfg.Isolation.Dir, maxAge)
+		s.isolator.MaxCopyFiles = cfg.Isolation.MaxCopyFiles
+		s.isolator.MaxCopyBytes = cfg.Isolation.MaxCopyBytes
+	}
+	locks, err := workspace.NewLockManager(cfg.WorkspaceLock)
+	if err != nil {
+		log.Error("invalid workspace lock policy, serializing", "err", err)
+		locks, _ = workspace.NewLockManager(workspace.LockSerialize)
+	}
+	s.locks = locks
+	if cfg.Snapshots.Enabled {
+		if s.archive, err = snapshot.OpenConfigured(cfg, s.snapshotOptions()); err != nil {
+			log.Error("snapshots disabled", "err", err)
+		}
+	}
+	if s.router, err = routing.New(cfg.ModelRoutes); err != nil {
+		log.Error("invalid model routes, routing disabled", "err", err)
+	}
+	if cfg.ModelDiscovery {
+		if err := models.LoadCache(models.DefaultCachePath()); err != nil && !os.IsNotExist(err) {
+			log.Warn("ignoring model cache", "err", err)
+		}
+	}
+	if !validContextStrategy(cfg.ContextWindow.Strategy) {
+		log.Error("invalid context window strategy, not checking prompt size", "strategy", cfg.ContextWindow.Strategy)
+		cfg.ContextWindow.Strategy = translator.ContextOff
+	}
+	s.templates = loadTemplates(cfg.PromptTemplates, log)
+	models.SetAliases(cfg.ModelAliases)
+	for name := range cfg.ModelAliases {
+		if _, err := models.Resolve(name); err != nil {
+			log.Warn("model alias target not known yet", "alias", name, "target", cfg.ModelAliases[name])
+		}
+	}
 	s.routes()
 	return s
 }
@@ -43,7 +108,27 @@ func New(cfg *config.Config, log *slog.Logger, version string) *Server {
 func (s *Server) routes() {
 	s.mux.HandleFunc("POST /v1/chat/completions", s.handleChatCompletions)
 	s.mux.HandleFunc("GET /v1/models", s.handleListModels)
+	s.mux.HandleFunc("GET /v1/models/{id...}", s.handleGetModel)
 	s.mux.HandleFunc("GET /health", s.handleHealth)
+	s.mux.HandleFunc("GET /metrics", s.handleMetrics)
+	s.mux.HandleFunc("GET /admin/locks", s.localOnly(s.handleListLocks))
+	s.mux.HandleFunc("GET /admin/snapshots", s.localOnly(s.handleListSnapshots))
+	s.mux.HandleFunc("GET /admin/snapshots/{id}", s.localOnly(s.handleGetSnapshot))
+	s.mux.HandleFunc("POST /admin/snapshots/{id}/restore", s.localOnly(s.handleRestoreSnapshot))
+}
+
+// localOnly serves h to loopback clients only. The proxy has no
+// authentication, and the admin endpoints expose workspace paths and can roll
+// workspaces back.
+func (s *Server) localOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			s.writeError(w, &errors.ParsedError{Type: "admin_forbidden", Message: "admin endpoints are only served to clients on this machine"})
+			return
+		}
+		h(w, r)
+	}
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -68,35 +153,56 @@ func (s *Server) handleListModels(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(list)
 }
 
+// handleGetModel serves GET /v1/models/{id}. The id may carry the cursor/
+// prefix or be an alias; the response always uses the canonical id.
+func (s *Server) handleGetModel(w http.ResponseWriter, r *http.Request) {
+	m, ok := models.Get(r.PathValue("id"))
+	if !ok {
+		s.writeError(w, &errors.ParsedError{
+			Type:       "not_found",
+			Message:    fmt.Sprintf("The model %q does not exist", r.PathValue("id")),
+			Suggestion: "Run 'openclaw-cursor models' for the full list",
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.ToOpenAI(m))
+}
+
 // resolveWorkspace picks the workspace for cursor-agent.
-// Priority: x-openclaw-workspace header → config → home directory (~).
-// This keeps the proxy dynamic: per-request override when OpenClaw passes it,
-// otherwise broad access (home) so the agent can work with any project.
-func resolveWorkspace(r *http.Request, cfg *config.Config) string {
-	if h := r.Header.Get("x-openclaw-workspace"); h != "" {
-		h = strings.TrimSpace(h)
-		if h != "" && h[0] == '~' {
-			if home, err := os.UserHomeDir(); err == nil {
-				if len(h) == 1 {
-					return home
-				}
-				// ~/foo -> home/foo
-				rest := strings.TrimPrefix(h, "~/")
-				return filepath.Join(home, rest)
-			}
-		}
-		if h != "" {
-			return h
+// Priority: x-openclaw-workspace header → config → first workspace root → home directory (~).
+// Header values are canonicalized (~, .., symlinks) and must fall inside
+// workspace_roots when roots are configured.
+func resolveWorkspace(r *http.Request, cfg *config.Config) (string, error) {
+	base := cfg.Workspace
+	if base == "" && len(cfg.WorkspaceRoots) > 0 {
+		base = workspace.ExpandHome(cfg.WorkspaceRoots[0])
+	}
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = "."
 		}
+		base = home
 	}
-	if cfg.Workspace != "" {
-		return cfg.Workspace
+	pol := workspace.Policy{
+		Roots:         cfg.WorkspaceRoots,
+		RequireExists: cfg.RequireWorkspaceExists,
+		RequireGit:    cfg.RequireGitWorkspace,
 	}
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "."
+	if h := strings.TrimSpace(r.Header.Get("x-openclaw-workspace")); h != "" {
+		return pol.Resolve(h, base)
 	}
-	return home
+	// Operator-configured defaults are trusted; only the git/existence checks apply.
+	pol.Roots = nil
+	return pol.Resolve(base, base)
+}
+
+func workspaceError(err error) *errors.ParsedError {
+	if stderrors.Is(err, workspace.ErrForbidden) {
+		return &errors.ParsedError{Type: "workspace_forbidden", Message: err.Error()}
+	}
+	return &errors.ParsedError{Type: "invalid_request", Message: err.Error()}
 }
 
 func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
@@ -112,13 +218,104 @@ func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	modelID, err := models.Resolve(req.Model)
+	if n := req.Choices(); n < 1 || n > max(s.cfg.MaxChoices, 1) {
+		s.writeError(w, &errors.ParsedError{Type: "invalid_request", Message: fmt.Sprintf("n must be between 1 and %d", max(s.cfg.MaxChoices, 1))})
+		return
+	}
+	if req.Choices() > 1 && s.isolator == nil {
+		// Every choice is an agent that may edit files; they need copies of
+		// their own.
+		s.writeError(w, &errors.ParsedError{Type: "invalid_request", Message: "n > 1 requires workspace isolation: set isolation.mode to request or session (OPENCLAW_CURSOR_ISOLATION)"})
+		return
+	}
+
+	prompt, err := translator.BuildPrompt(req)
+	if err != nil {
+		s.log.Error("prompt template failed", "err", err)
+		s.writeError(w, &errors.ParsedError{Type: "prompt_template_error", Message: err.Error()})
+		return
+	}
+
+	route := s.router.Route(routing.Request{
+		Model:       req.Model,
+		HasTools:    len(req.Tools) > 0,
+		PromptChars: len(prompt),
+		Agent:       r.Header.Get("x-openclaw-agent"),
+		Now:         time.Now(),
+	})
+	modelID, err := models.Resolve(route.Model)
+	if err != nil {
+		s.writeError(w, &errors.ParsedError{Type: "model_not_found", Message: err.Error()})
+		return
+	}
+	if e := req.Effort(); e != "" && !slices.Contains(models.Efforts, strings.ToLower(e)) {
+		s.writeError(w, &errors.ParsedError{Type: "invalid_request", Message: fmt.Sprintf("Unknown reasoning_effort %q", e)})
+		return
+	}
+	var format *structured.Format
+	if rf := req.StructuredOutput(); rf != nil {
+		var schema json.RawMessage
+		if rf.JSONSchema != nil {
+			schema = rf.JSONSchema.Schema
+		}
+		if format, err = structured.New(rf.Type, schema); err != nil {
+			s.writeError(w, &errors.ParsedError{Type: "invalid_request", Message: err.Error()})
+			return
+		}
+	}
+	modelID = models.Variant(modelID, req.Effort(), req.ThinkingToggle())
+	if m, ok := models.Get(modelID); ok && !m.SupportsImages && req.HasImages() {
+		s.writeError(w, &errors.ParsedError{Type: "invalid_request", Message: fmt.Sprintf("Model %s does not accept images", modelID)})
+		return
+	}
+	s.log.Info("resolved model", "requested", req.Model, "model", modelID, "route", route.Rule, "effort", req.Effort())
+	w.Header().Set("X-OpenClaw-Cursor-Model", modelID)
+	if route.Rule != "" {
+		w.Header().Set("X-OpenClaw-Cursor-Route", route.Rule)
+	}
+
+	wsPath, err := resolveWorkspace(r, s.cfg)
+	if err != nil {
+		s.log.Warn("rejected workspace", "header", r.Header.Get("x-openclaw-workspace"), "err", err)
+		s.writeError(w, workspaceError(err))
+		return
+	}
+	req = translator.WithSystemPrompt(req, s.systemPrompt(req.Model, modelID, wsPath))
+
+	// Stop runaway tool loops: if the history shows the model repeating itself
+	// (or looping too long), tell it to conclude and stop forwarding tool calls.
+	// This looks at the full history, before spilling or context fitting
+	// rewrite tool results.
+	loop := tools.CheckMessages(req.Messages, s.cfg.MaxToolCallRepeats, s.cfg.MaxToolLoopIterations)
+	if loop.Stop {
+		s.log.Warn("tool loop guard tripped", "reason", loop.Reason, "iterations", loop.Iterations)
+		w.Header().Set("X-OpenClaw-Cursor-Loop-Guard", loop.Reason)
+	}
+
+	// Move large tool results into files the agent can read on demand. They
+	// are written once the workspace is ours.
+	reqID := newRequestID()
+	scratch := scratchName(r, reqID)
+	req, spills := translator.SpillToolResults(req, s.spillOptions(scratch))
+
+	// Keep long sessions within the model's context window instead of letting
+	// cursor-agent fail on them.
+	fitted, fit, err := translator.FitContext(req, s.contextOptions(req, modelID))
+	if fit.Action != "none" {
+		s.log.Info("context window", "model", modelID, "action", fit.Action, "tokens", fit.Tokens, "limit", fit.Limit, "dropped", fit.Dropped, "truncated", fit.Truncated)
+		w.Header().Set("X-OpenClaw-Cursor-Context", fit.Header())
+	}
+	var tooLong *translator.ContextLengthError
+	if stderrors.As(err, &tooLong) {
+		s.writeError(w, &errors.ParsedError{Type: "context_length_exceeded", Message: err.Error()})
+		return
+	}
 	if err != nil {
-		s.writeError(w, &errors.ParsedError{Type: "model_unavailable", Message: err.Error()})
+		s.log.Error("prompt template failed", "model", modelID, "err", err)
+		s.writeError(w, &errors.ParsedError{Type: "prompt_template_error", Message: err.Error()})
 		return
 	}
 
-	prompt := translator.BuildPrompt(req)
 	timeout := time.Duration(s.cfg.TimeoutMs) * time.Millisecond
 
 	// Use Background for non-streaming: request context can be cancelled when client
@@ -129,28 +326,235 @@ func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 	if stream {
 		spawnCtx = r.Context()
 	}
-	workspace := resolveWorkspace(r, s.cfg)
-	proc, err := agent.Spawn(spawnCtx, agent.Options{
-		Model:     modelID,
-		Prompt:    prompt,
-		Workspace: workspace,
-		Timeout:   timeout,
-	})
+	agentDir := wsPath
+	var iso *workspace.Isolated
+	if s.isolator != nil {
+		iso, err = s.isolate(r, wsPath)
+		if err != nil {
+			s.writeError(w, &errors.ParsedError{Type: "workspace_error", Message: err.Error()})
+			return
+		}
+		defer s.releaseIsolated(iso)
+		agentDir = iso.Path
+		w.Header().Set("X-OpenClaw-Cursor-Worktree", iso.Path)
+	}
+	release, err := s.lockWorkspace(r, agentDir, reqID, modelID)
+	if err != nil {
+		s.writeError(w, lockError(err))
+		return
+	}
+	defer release()
+
+	removeSpills, err := s.writeSpills(agentDir, scratch, spills)
+	if err != nil {
+		s.writeError(w, &errors.ParsedError{Type: "workspace_error", Message: err.Error()})
+		return
+	}
+	defer removeSpills()
+	fitted, cleanup, pe := s.saveAttachments(r.Context(), fitted, wsPath, agentDir, reqID)
+	if pe != nil {
+		s.writeError(w, pe)
+		return
+	}
+	defer cleanup()
+	if prompt, err = s.renderPrompt(fitted, req.Model, modelID, loop); err != nil {
+		s.log.Error("prompt template failed", "model", modelID, "err", err)
+		s.writeError(w, &errors.ParsedError{Type: "prompt_template_error", Message: err.Error()})
+		return
+	}
+
+	before := s.snapshotBefore(agentDir)
+	choiceIsos, releaseChoices, err := s.isolateCopies(agentDir, req.Choices())
+	if err != nil {
+		s.writeError(w, &errors.ParsedError{Type: "workspace_error", Message: err.Error()})
+		return
+	}
+	defer releaseChoices()
+
+	opts := agent.Options{Workspace: agentDir, Timeout: timeout}
+	spawn := func(dir, prompt string) (*agent.Process, error) {
+		opts := opts
+		opts.Model, opts.Prompt, opts.Workspace = modelID, prompt, dir
+		return s.agents.Spawn(spawnCtx, opts)
+	}
+	var proc *agent.Process
+	var cands []candidate
+	name, h, hedged := s.hedgeFor(req.Model, modelID)
+	if hedged && req.Choices() == 1 {
+		// Candidates may edit files, so each needs a workspace of its own that
+		// is thrown away with the request.
+		if s.cfg.Isolation.Mode == workspace.IsolationRequest {
+			cands = s.hedgeCandidates(h, req, fitted, loop)
+		} else {
+			s.log.Debug("not hedging without per-request isolation", "alias", name)
+		}
+	}
+	if len(cands) > 1 {
+		var hedgeIsos []*workspace.Isolated
+		var releaseHedges func()
+		hedgeIsos, releaseHedges, err = s.isolateCopies(agentDir, len(cands))
+		if err != nil {
+			s.writeError(w, &errors.ParsedError{Type: "workspace_error", Message: err.Error()})
+			return
+		}
+		defer releaseHedges()
+		befores := []*snapshot.Snapshot{before}
+		cands[0].dir = agentDir
+		for i, hiso := range hedgeIsos {
+			cands[i+1].dir = hiso.Path
+			befores = append(befores, s.snapshotBefore(hiso.Path))
+		}
+		// Race candidates and continue with whichever answers first, in its
+		// workspace; later runs of this request (retries) use its model.
+		var winner int
+		winner, proc, err = s.hedge(spawnCtx, name, h, cands, opts)
+		if err == nil {
+			modelID, prompt = cands[winner].modelID, cands[winner].prompt
+			if winner > 0 {
+				iso, agentDir, before = hedgeIsos[winner-1], cands[winner].dir, befores[winner]
+				w.Header().Set("X-OpenClaw-Cursor-Worktree", agentDir)
+			}
+			w.Header().Set("X-OpenClaw-Cursor-Model", modelID)
+			w.Header().Set("X-OpenClaw-Cursor-Hedge", fmt.Sprintf("alias=%s; winner=%d", name, winner))
+		}
+	} else {
+		proc, err = spawn(agentDir, prompt)
+	}
 	if err != nil {
 		s.writeError(w, errors.Parse(err.Error()))
 		return
 	}
-	// Only kill on early return; once Wait() succeeds the process has exited
-	defer func() { _ = proc.Kill() }()
 
-	if stream {
-		s.handleStreaming(w, r, proc, modelID)
+	t := &turn{id: reqID, modelID: modelID, workspace: agentDir, proc: proc, spawn: spawn, loop: loop, iso: iso, before: before}
+	// Only kill on early return; once Wait() succeeds the process has exited
+	defer func() { _ = t.proc.Kill() }()
+	t.hideReasoning = !s.cfg.EnableThinking || req.ExcludeReasoning()
+	t.prompt = prompt
+	t.includeUsage = req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+	t.format = format
+	t.n = req.Choices()
+	t.choiceIsos = choiceIsos
+	t.prefill = translator.Prefill(req)
+	t.stop = req.Stop
+	t.maxTokens = req.CompletionLimit()
+	if stream && format != nil && req.StructuredOutput().Strict() {
+		// Strict structured output is validated before anything is sent.
+		s.handleBuffered(w, t)
+	} else if stream {
+		s.handleStreaming(w, r, t)
 	} else {
-		s.handleNonStreaming(w, proc, modelID)
+		s.handleNonStreaming(w, t)
+	}
+}
+
+// turn carries per-request state shared by the streaming and non-streaming paths.
+type turn struct {
+	id        string
+	modelID   string
+	workspace string
+	proc      *agent.Process
+	// spawn starts another run with the same model in dir.
+	spawn  func(dir, prompt string) (*agent.Process, error)
+	loop   tools.LoopVerdict
+	iso    *workspace.Isolated
+	before *snapshot.Snapshot
+	// hideReasoning drops reasoning_content from the response.
+	hideReasoning bool
+	// prompt is what cursor-agent was given, for usage estimates.
+	prompt       string
+	includeUsage bool
+	// format is the requested response_format, if any.
+	format *structured.Format
+	// prefill is the assistant text the reply continues, if any.
+	prefill string
+	// stop and maxTokens bound the reply (stop, max_tokens).
+	stop      []string
+	maxTokens int
+	// n is how many choices to generate, one run each.
+	n int
+	// choiceIsos are the workspace copies of choices 1..n-1.
+	choiceIsos []*workspace.Isolated
+}
+
+// continuation returns a fresh filter for one run's text, or nil if the
+// reply is not a continuation.
+func (t *turn) continuation() *streaming.Continuation {
+	return streaming.NewContinuation(t.prefill)
+}
+
+// limiter returns a fresh limiter for one run, or nil if the request sets
+// no bounds.
+func (t *turn) limiter() *streaming.Limiter {
+	return streaming.NewLimiter(t.stop, t.maxTokens)
+}
+
+// usage returns what cursor-agent reported, or an estimate over the prompt
+// and the generated output when it reported nothing.
+func usage(prompt string, reported *streaming.Usage, completion, reasoning string) *streaming.Usage {
+	if reported != nil {
+		return reported
+	}
+	return streaming.EstimateUsage(prompt, completion, reasoning)
+}
+
+// extensions returns the openclaw_* fields reported once the agent has exited:
+// response fields for non-streaming, trailing SSE events for streaming.
+func (s *Server) extensions(t *turn) map[string]interface{} {
+	ext := make(map[string]interface{})
+	if t.iso != nil {
+		ext["openclaw_workspace"] = s.isolationReport(t.iso)
+	}
+	if t.before != nil {
+		s.changeExtensions(t, ext)
+	}
+	return ext
+}
+
+// writeExtensionEvents emits extensions as named SSE events
+// (openclaw_workspace -> "event: openclaw.workspace"). OpenAI clients skip
+// named events, so they don't disturb chunk parsing.
+func writeExtensionEvents(w io.Writer, ext map[string]interface{}) {
+	for name, v := range ext {
+		b, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", strings.Replace(name, "_", ".", 1), b)
 	}
 }
 
-func (s *Server) handleStreaming(w http.ResponseWriter, r *http.Request, proc *agent.Process, modelID string) {
+// checkCommand runs shell tool calls through the command policy. It returns
+// the decision and the intercepted call when the turn has to stop.
+func (s *Server) checkCommand(t *turn, event *streaming.StreamEvent) (*policy.Decision, *tools.OpenAIToolCall) {
+	if !s.policy.Enabled() || !event.IsToolCall() || event.Subtype == "completed" {
+		return nil, nil
+	}
+	tc, _ := tools.InterceptToolCall(event)
+	if tc == nil || tc.Function.Name != "bash" {
+		return nil, nil
+	}
+	var args struct {
+		Command string `json:"command"`
+	}
+	if json.Unmarshal([]byte(tc.Function.Arguments), &args) != nil || args.Command == "" {
+		return nil, nil
+	}
+	d := s.policy.Check(args.Command, policy.AuditMeta{Workspace: t.workspace, Model: t.modelID, CallID: tc.ID})
+	if !d.Blocks() {
+		return nil, nil
+	}
+	s.log.Warn("command policy stopped turn", "action", d.Action, "rule", d.Rule, "command", args.Command)
+	return &d, tc
+}
+
+func policyError(d *policy.Decision, tc *tools.OpenAIToolCall) *errors.ParsedError {
+	return &errors.ParsedError{
+		Type:    "policy_violation",
+		Message: fmt.Sprintf("Command blocked by policy (%s): %s", d.Rule, tc.Function.Arguments),
+	}
+}
+
+func (s *Server) handleStreaming(w http.ResponseWriter, r *http.Request, t *turn) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
@@ -162,16 +566,52 @@ func (s *Server) handleStreaming(w http.ResponseWriter, r *http.Request, proc *a
 		return
 	}
 
-	conv := streaming.NewConverter(modelID)
-	sc := streaming.NewScanner(proc.Stdout())
+	out := &sseWriter{w: w, flusher: flusher}
+	var mu sync.Mutex
+	total := &streaming.Usage{}
+	s.forEachChoice(t, func(i int, c *turn, pe *errors.ParsedError) {
+		conv := streaming.NewConverter(t.modelID)
+		conv.Index = i
+		if pe != nil {
+			out.write(choiceError(conv, pe)...)
+			return
+		}
+		u := s.streamChoice(r.Context(), out, c, conv)
+		if i > 0 && r.Context().Err() == nil {
+			out.write(choiceExtensions(i, s.extensions(c)))
+		}
+		mu.Lock()
+		total.Add(u)
+		mu.Unlock()
+	})
+	if r.Context().Err() != nil {
+		return
+	}
+	conv := streaming.NewConverter(t.modelID)
+	writeExtensionEvents(w, s.extensions(t))
+	if t.includeUsage {
+		w.Write(conv.UsageChunk(total))
+	}
+	w.Write(conv.Done())
+	flusher.Flush()
+}
 
-	go io.Copy(io.Discard, proc.Stderr()) // Drain stderr
+// streamChoice streams one run of t as choice conv.Index, through its
+// finish chunk, and returns its usage.
+func (s *Server) streamChoice(ctx context.Context, out *sseWriter, t *turn, conv *streaming.Converter) *streaming.Usage {
+	conv.DropToolCalls = t.loop.Stop
+	conv.DropReasoning = t.hideReasoning
+	conv.Continue = t.continuation()
+	conv.Limit = t.limiter()
+	sc := streaming.NewScanner(t.proc.Stdout())
 
+	go io.Copy(io.Discard, t.proc.Stderr()) // Drain stderr
+
+	var reported *streaming.Usage
+	finished := false
 	for sc.Scan() {
-		select {
-		case <-r.Context().Done():
-			return
-		default:
+		if ctx.Err() != nil {
+			return nil
 		}
 		event, err := sc.Event()
 		if err != nil {
@@ -181,91 +621,338 @@ func (s *Server) handleStreaming(w http.ResponseWriter, r *http.Request, proc *a
 		if event == nil {
 			continue
 		}
+		if u := event.ReportedUsage(); u != nil {
+			reported = u
+		}
+		if d, tc := s.checkCommand(t, event); d != nil {
+			_ = t.proc.Kill()
+			if d.Action == policy.Approve {
+				// Hand the command to OpenClaw so its exec approval decides.
+				conv.DropToolCalls = false
+				chunk, _ := conv.ToSSEChunk(event)
+				out.write(chunk, conv.Finish("tool_calls"))
+			} else if t.n > 1 {
+				out.write(choiceError(conv, policyError(d, tc))...)
+			} else {
+				b, _ := errors.ToOpenAIErrorJSON(policyError(d, tc))
+				out.write([]byte("data: " + string(b) + "\n\n"))
+			}
+			finished = true
+			break
+		}
 		chunk, err := conv.ToSSEChunk(event)
 		if err != nil {
 			continue
 		}
 		if len(chunk) > 0 {
-			w.Write(chunk)
-			flusher.Flush()
+			out.write(chunk)
+		}
+		if conv.Limit.Done() {
+			// A stop sequence or max_tokens ended the reply.
+			_ = t.proc.Kill()
+			break
 		}
 	}
-	w.Write(conv.Done())
-	flusher.Flush()
-	_ = proc.Wait() // Reap process and release context
+	if sc.Err() != nil {
+		s.log.Warn("read cursor-agent output", "err", sc.Err())
+		_ = t.proc.Kill()
+	}
+	go io.Copy(io.Discard, t.proc.Stdout())
+	_ = t.proc.Wait() // Reap process and release context
+	if !finished {
+		out.write(conv.Flush(), conv.Finish(conv.FinishReason()))
+	}
+	text, reasoning := conv.Output()
+	return usage(t.prompt, reported, text, reasoning)
 }
 
-func (s *Server) handleNonStreaming(w http.ResponseWriter, proc *agent.Process, modelID string) {
-	var stdout, stderr []byte
-	var stdoutErr error
-	done := make(chan struct{})
-	go func() {
-		stdout, stdoutErr = io.ReadAll(proc.Stdout())
-		done <- struct{}{}
-	}()
+// runResult is what one cursor-agent run produced.
+type runResult struct {
+	content, reasoning string
+	finishReason       string
+	// hidden is reasoning left out of the response, still counted in usage.
+	hidden string
+	usage  *streaming.Usage
+	// blocked is set when the command policy stopped the run at blockedCall
+	// (from blockedEvent).
+	blocked      *policy.Decision
+	blockedCall  *tools.OpenAIToolCall
+	blockedEvent *streaming.StreamEvent
+}
+
+// collect reads t.proc to completion. Events are parsed as they arrive so
+// policy decisions can stop the run early.
+func (s *Server) collect(t *turn, prompt string) (*runResult, *errors.ParsedError) {
+	var stderr []byte
+	stderrDone := make(chan struct{})
 	go func() {
-		stderr, _ = io.ReadAll(proc.Stderr())
-		done <- struct{}{}
+		stderr, _ = io.ReadAll(t.proc.Stderr())
+		close(stderrDone)
 	}()
-	<-done
-	<-done
-	if stdoutErr != nil {
-		s.writeError(w, errors.Parse(stdoutErr.Error()))
-		return
-	}
-	if err := proc.Wait(); err != nil {
-		pe := errors.Parse(string(stderr))
-		if pe.Type == "unknown" {
-			pe.Message = err.Error()
-		}
-		s.writeError(w, pe)
-		return
-	}
 
-	// Parse all events and assemble response
-	var content, reasoning string
-	sc := streaming.NewScanner(bytes.NewReader(stdout))
+	res := &runResult{}
+	cont := t.continuation()
+	limit := t.limiter()
+	var reported *streaming.Usage
+	sc := streaming.NewScanner(t.proc.Stdout())
 	for sc.Scan() {
 		event, _ := sc.Event()
 		if event == nil {
 			continue
 		}
+		if u := event.ReportedUsage(); u != nil {
+			reported = u
+		}
+		if d, tc := s.checkCommand(t, event); d != nil {
+			res.blocked, res.blockedCall, res.blockedEvent = d, tc, event
+			_ = t.proc.Kill()
+			break
+		}
 		if event.IsAssistantText() {
-			content += event.ExtractText()
+			text := cont.Next(event.ExtractText())
+			if limit != nil {
+				text = limit.Next(text)
+			}
+			res.content += text
 		}
 		if event.IsThinking() {
-			reasoning += event.ExtractThinking()
+			if t.hideReasoning {
+				res.hidden += event.ExtractThinking()
+			} else {
+				res.reasoning += event.ExtractThinking()
+			}
+		}
+		if limit.Done() {
+			_ = t.proc.Kill()
+			break
+		}
+	}
+	if sc.Err() != nil {
+		// A line too long to parse; the rest of the run is no use.
+		_ = t.proc.Kill()
+	}
+	// Whatever ended the loop early, keep stdout drained so the agent
+	// can't block on a full pipe while Wait waits for it.
+	go io.Copy(io.Discard, t.proc.Stdout())
+	<-stderrDone
+	waitErr := t.proc.Wait()
+	if text := cont.Flush(); limit != nil {
+		res.content += limit.Next(text) + limit.Flush()
+	} else {
+		res.content += text
+	}
+	res.finishReason = "stop"
+	if r := limit.Reason(); r != "" {
+		res.finishReason = r
+	}
+
+	if res.blocked != nil && res.blocked.Action == policy.Deny {
+		return nil, policyError(res.blocked, res.blockedCall)
+	}
+	if res.blocked == nil && !limit.Done() {
+		if err := sc.Err(); err != nil {
+			return nil, errors.Parse(err.Error())
+		}
+		if waitErr != nil {
+			pe := errors.Parse(string(stderr))
+			if pe.Type == "unknown" {
+				pe.Message = waitErr.Error()
+			}
+			return nil, pe
 		}
 	}
+	completion := res.content
+	if res.blocked != nil {
+		completion += res.blockedCall.Function.Name + res.blockedCall.Function.Arguments
+		res.finishReason = "tool_calls"
+	}
+	res.usage = usage(prompt, reported, completion, res.reasoning+res.hidden)
+	return res, nil
+}
 
-	msg := map[string]interface{}{"role": "assistant", "content": content}
-	if reasoning != "" {
-		msg["reasoning_content"] = reasoning
+// conform enforces t.format: the reply is reduced to its JSON value, and a
+// reply that doesn't validate is sent back to the model with the problems
+// until it does or the retries run out. Usage covers every run.
+func (s *Server) conform(t *turn, res *runResult) (*runResult, *errors.ParsedError) {
+	if t.format == nil || res.blocked != nil {
+		return res, nil
+	}
+	total := *res.usage
+	prompt := t.prompt
+	for attempt := 1; ; attempt++ {
+		raw, err := t.format.Check(res.content)
+		if err == nil {
+			res.content = string(raw)
+			res.usage = &total
+			return res, nil
+		}
+		if attempt > s.cfg.StructuredOutputRetries {
+			return nil, &errors.ParsedError{
+				Type:    "invalid_response_format",
+				Message: fmt.Sprintf("Model output did not match response_format after %d attempts: %v", attempt, err),
+			}
+		}
+		s.log.Info("reply did not match response_format, re-prompting", "attempt", attempt, "err", err)
+		prompt = translator.FormatRetry(prompt, res.content, err.Error())
+		// The retry asks for the whole reply again, on a turn of its own so
+		// t stays as the other choices copied it.
+		retry := *t
+		retry.prefill = ""
+		if retry.proc, err = t.spawn(t.workspace, prompt); err != nil {
+			return nil, errors.Parse(err.Error())
+		}
+		next, pe := s.collect(&retry, prompt)
+		_ = retry.proc.Kill()
+		if pe != nil {
+			return nil, pe
+		}
+		total.Add(next.usage)
+		res = next
+		if res.blocked != nil {
+			res.usage = &total
+			return res, nil
+		}
+	}
+}
+
+func (s *Server) handleNonStreaming(w http.ResponseWriter, t *turn) {
+	results := s.runChoices(t)
+	if pe := allFailed(results); pe != nil {
+		s.writeError(w, pe)
+		return
+	}
+
+	choices := make([]map[string]interface{}, len(results))
+	total := &streaming.Usage{}
+	for i, c := range results {
+		if c.err != nil {
+			choices[i] = failedChoice(i, c.err)
+			for k, v := range c.ext {
+				choices[i][k] = v
+			}
+			continue
+		}
+		res := c.res
+		msg := map[string]interface{}{"role": "assistant", "content": res.content}
+		if res.reasoning != "" {
+			msg["reasoning_content"] = res.reasoning
+		}
+		if res.blocked != nil {
+			msg["tool_calls"] = []*tools.OpenAIToolCall{res.blockedCall}
+		}
+		choices[i] = map[string]interface{}{"index": i, "message": msg, "finish_reason": res.finishReason}
+		for k, v := range c.ext {
+			choices[i][k] = v
+		}
+		total.Add(res.usage)
 	}
 	resp := map[string]interface{}{
 		"id":      "openclaw-cursor-1",
 		"object":  "chat.completion",
 		"created": time.Now().Unix(),
-		"model":   modelID,
-		"choices": []map[string]interface{}{
-			{"index": 0, "message": msg, "finish_reason": "stop"},
-		},
+		"model":   t.modelID,
+		"choices": choices,
+		"usage":   total,
+	}
+	for k, v := range s.extensions(t) {
+		resp[k] = v
+	}
+	if t.loop.Stop {
+		resp["openclaw_loop_guard"] = map[string]interface{}{
+			"stopped":    true,
+			"reason":     t.loop.Reason,
+			"iterations": t.loop.Iterations,
+		}
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
+// handleBuffered streams a reply that has to be complete before any of it
+// can be sent (strict structured output). Errors still get a proper status
+// because nothing has been written yet.
+func (s *Server) handleBuffered(w http.ResponseWriter, t *turn) {
+	results := s.runChoices(t)
+	if pe := allFailed(results); pe != nil {
+		s.writeError(w, pe)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	total := &streaming.Usage{}
+	for i, c := range results {
+		conv := streaming.NewConverter(t.modelID)
+		conv.Index = i
+		if c.err != nil {
+			for _, chunk := range choiceError(conv, c.err) {
+				w.Write(chunk)
+			}
+			w.Write(choiceExtensions(i, c.ext))
+			continue
+		}
+		res := c.res
+		if res.reasoning != "" {
+			chunk, _ := conv.Chunk(streaming.OpenAIDelta{ReasoningContent: res.reasoning})
+			w.Write(chunk)
+		}
+		if res.blocked != nil {
+			// An approve decision: hand the command to OpenClaw.
+			if chunk, err := conv.ToSSEChunk(res.blockedEvent); err == nil && len(chunk) > 0 {
+				w.Write(chunk)
+			}
+		} else if res.content != "" {
+			chunk, _ := conv.Chunk(streaming.OpenAIDelta{Content: res.content})
+			w.Write(chunk)
+		}
+		w.Write(conv.Finish(res.finishReason))
+		w.Write(choiceExtensions(i, c.ext))
+		total.Add(res.usage)
+	}
+	conv := streaming.NewConverter(t.modelID)
+	writeExtensionEvents(w, s.extensions(t))
+	if t.includeUsage {
+		w.Write(conv.UsageChunk(total))
+	}
+	w.Write(conv.Done())
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func (s *Server) writeError(w http.ResponseWriter, pe *errors.ParsedError) {
 	w.Header().Set("Content-Type", "application/json")
-	// Return 429 for quota/rate limit errors so OpenClaw's fallback triggers
-	if pe.Type == "quota_exceeded" || pe.Type == "rate_limit" {
-		w.WriteHeader(http.StatusTooManyRequests)
-	} else {
-		w.WriteHeader(http.StatusTooManyRequests)
-	}
+	w.WriteHeader(statusFor(pe))
 	json.NewEncoder(w).Encode(errors.ToOpenAIError(pe))
 }
 
+// statusFor maps an error type to its HTTP status.
+// cursor-agent failures (quota, rate limit, auth, network, a model it
+// refuses and anything unrecognized) return 429 so OpenClaw's model
+// fallback triggers; only errors the proxy diagnosed itself get a more
+// specific status.
+func statusFor(pe *errors.ParsedError) int {
+	switch pe.Type {
+	case "quota_exceeded", "rate_limit", "auth_failed", "network_error", "model_unavailable", "unknown":
+		return http.StatusTooManyRequests
+	case "invalid_request", "model_not_found", "context_length_exceeded":
+		return http.StatusBadRequest
+	case "workspace_busy":
+		return http.StatusConflict
+	case "not_found":
+		return http.StatusNotFound
+	case "invalid_response_format":
+		return http.StatusBadGateway
+	case "policy_violation", "workspace_forbidden", "admin_forbidden":
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // Start runs the server with graceful shutdown.
 func (s *Server) Start() error {
 	addr := fmt.Sprintf(":%d", s.cfg.Port)
@@ -277,6 +964,14 @@ func (s *Server) Start() error {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	if s.isolator != nil {
+		go s.cleanupIsolated(ctx)
+	}
+	if s.cfg.ModelDiscovery {
+		go s.refreshModels(ctx)
+	}
+	go s.cleanupSessionScratch(ctx)
+
 	go func() {
 		v := s.version
 		if v == "" {
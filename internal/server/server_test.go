@@ -2,13 +2,24 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/menezmethod/openclaw-cursor/internal/config"
+	"github.com/menezmethod/openclaw-cursor/internal/errors"
 	"github.com/menezmethod/openclaw-cursor/internal/logger"
+	"github.com/menezmethod/openclaw-cursor/internal/models"
+	"github.com/menezmethod/openclaw-cursor/internal/streaming"
+	"github.com/menezmethod/openclaw-cursor/internal/translator"
+	"github.com/menezmethod/openclaw-cursor/internal/workspace"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -16,7 +27,7 @@ import (
 func TestServer_Health(t *testing.T) {
 	cfg := config.Default()
 	log := logger.New("info")
-	srv := New(cfg, log)
+	srv := New(cfg, log, "test")
 	req := httptest.NewRequest("GET", "/health", nil)
 	w := httptest.NewRecorder()
 	srv.handleHealth(w, req)
@@ -29,7 +40,7 @@ func TestServer_Health(t *testing.T) {
 func TestServer_ListModels(t *testing.T) {
 	cfg := config.Default()
 	log := logger.New("info")
-	srv := New(cfg, log)
+	srv := New(cfg, log, "test")
 	req := httptest.NewRequest("GET", "/v1/models", nil)
 	w := httptest.NewRecorder()
 	srv.handleListModels(w, req)
@@ -42,10 +53,30 @@ func TestServer_ListModels(t *testing.T) {
 	assert.GreaterOrEqual(t, len(data), 30)
 }
 
+func TestServer_GetModel(t *testing.T) {
+	srv := New(config.Default(), logger.New("info"), "test")
+	for _, path := range []string{"/v1/models/sonnet-4.5-thinking", "/v1/models/cursor/sonnet-4.5-thinking"} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		srv.mux.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, path)
+		var m map[string]interface{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&m))
+		assert.Equal(t, "sonnet-4.5-thinking", m["id"])
+		assert.Equal(t, true, m["openclaw_reasoning"])
+		assert.EqualValues(t, 200000, m["openclaw_context_window"])
+	}
+
+	req := httptest.NewRequest("GET", "/v1/models/no-such-model", nil)
+	w := httptest.NewRecorder()
+	srv.mux.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
 func TestServer_ChatCompletions_InvalidModel(t *testing.T) {
 	cfg := config.Default()
 	log := logger.New("info")
-	srv := New(cfg, log)
+	srv := New(cfg, log, "test")
 	body := []byte(`{"model":"cursor/invalid-model","messages":[{"role":"user","content":"hi"}]}`)
 	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
@@ -56,3 +87,776 @@ func TestServer_ChatCompletions_InvalidModel(t *testing.T) {
 	require.NoError(t, json.NewDecoder(w.Body).Decode(&m))
 	assert.Contains(t, m, "error")
 }
+
+func TestServer_ChatCompletions_WorkspaceOutsideRoots(t *testing.T) {
+	cfg := config.Default()
+	cfg.WorkspaceRoots = []string{t.TempDir()}
+	log := logger.New("info")
+	srv := New(cfg, log, "test")
+	body := []byte(`{"model":"cursor/auto","messages":[{"role":"user","content":"hi"}]}`)
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body))
+	req.Header.Set("x-openclaw-workspace", "/")
+	w := httptest.NewRecorder()
+	srv.handleChatCompletions(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	var m map[string]interface{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&m))
+	assert.Contains(t, m, "error")
+}
+
+func TestServer_ChatCompletions_ModelRouting(t *testing.T) {
+	t.Cleanup(func() { models.SetAliases(nil) })
+	cfg := config.Default()
+	cfg.WorkspaceRoots = []string{t.TempDir()}
+	cfg.ModelAliases = map[string]string{"fast": "composer-1"}
+	cfg.ModelRoutes = []config.ModelRoute{{Name: "reviewers", Target: "opus-4.6", Agents: []string{"reviewer"}}}
+	srv := New(cfg, logger.New("info"), "test")
+
+	send := func(agent string) *httptest.ResponseRecorder {
+		body := []byte(`{"model":"cursor/fast","messages":[{"role":"user","content":"hi"}]}`)
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body))
+		// Stop before spawning cursor-agent; the model is resolved by then.
+		req.Header.Set("x-openclaw-workspace", "/")
+		req.Header.Set("x-openclaw-agent", agent)
+		w := httptest.NewRecorder()
+		srv.handleChatCompletions(w, req)
+		return w
+	}
+	w := send("main")
+	assert.Equal(t, "composer-1", w.Header().Get("X-OpenClaw-Cursor-Model"))
+	assert.Empty(t, w.Header().Get("X-OpenClaw-Cursor-Route"))
+
+	w = send("reviewer")
+	assert.Equal(t, "opus-4.6", w.Header().Get("X-OpenClaw-Cursor-Model"))
+	assert.Equal(t, "reviewers", w.Header().Get("X-OpenClaw-Cursor-Route"))
+}
+
+func TestServer_ChatCompletions_ReasoningEffort(t *testing.T) {
+	cfg := config.Default()
+	cfg.WorkspaceRoots = []string{t.TempDir()}
+	srv := New(cfg, logger.New("info"), "test")
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(body)))
+		req.Header.Set("x-openclaw-workspace", "/")
+		w := httptest.NewRecorder()
+		srv.handleChatCompletions(w, req)
+		return w
+	}
+	w := send(`{"model":"cursor/gpt-5.3-codex","reasoning_effort":"high","messages":[{"role":"user","content":"hi"}]}`)
+	assert.Equal(t, "gpt-5.3-codex-high", w.Header().Get("X-OpenClaw-Cursor-Model"))
+	w = send(`{"model":"cursor/opus-4.6","thinking":{"type":"enabled"},"messages":[{"role":"user","content":"hi"}]}`)
+	assert.Equal(t, "opus-4.6-thinking", w.Header().Get("X-OpenClaw-Cursor-Model"))
+	w = send(`{"model":"cursor/auto","reasoning_effort":"turbo","messages":[{"role":"user","content":"hi"}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestServer_ChatCompletions_WorkspaceBusy(t *testing.T) {
+	cfg := config.Default()
+	cfg.Workspace = t.TempDir()
+	cfg.WorkspaceLock = "reject"
+	log := logger.New("info")
+	srv := New(cfg, log, "test")
+
+	dir, err := resolveWorkspace(httptest.NewRequest("GET", "/", nil), cfg)
+	require.NoError(t, err)
+	release, err := srv.locks.Acquire(context.Background(), dir, workspace.Holder{ID: "other", Model: "auto"})
+	require.NoError(t, err)
+	defer release()
+
+	body := []byte(`{"model":"cursor/auto","messages":[{"role":"user","content":"hi"}]}`)
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	srv.handleChatCompletions(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	req = httptest.NewRequest("GET", "/admin/locks", nil)
+	w = httptest.NewRecorder()
+	srv.handleListLocks(w, req)
+	var m struct {
+		Policy string               `json:"policy"`
+		Locks  []workspace.LockInfo `json:"locks"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&m))
+	assert.Equal(t, "reject", m.Policy)
+	require.Len(t, m.Locks, 1)
+	assert.Equal(t, dir, m.Locks[0].Workspace)
+	assert.Equal(t, "other", m.Locks[0].Holders[0].ID)
+}
+
+func TestServer_Snapshots_Disabled(t *testing.T) {
+	srv := New(config.Default(), logger.New("info"), "test")
+	req := httptest.NewRequest("GET", "/admin/snapshots", nil)
+	req.RemoteAddr = "127.0.0.1:40000"
+	w := httptest.NewRecorder()
+	srv.mux.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestServer_Admin_LoopbackOnly(t *testing.T) {
+	srv := New(config.Default(), logger.New("info"), "test")
+	for addr, code := range map[string]int{
+		"127.0.0.1:40000":   http.StatusOK,
+		"[::1]:40000":       http.StatusOK,
+		"192.0.2.1:40000":   http.StatusForbidden,
+		"[2001:db8::1]:443": http.StatusForbidden,
+	} {
+		req := httptest.NewRequest("GET", "/admin/locks", nil)
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		srv.mux.ServeHTTP(w, req)
+		assert.Equal(t, code, w.Code, addr)
+	}
+}
+
+// fakeAgent puts a cursor-agent on PATH that prints events (NDJSON lines)
+// and records its stdin and arguments in the returned directory.
+func fakeAgent(t *testing.T, events ...string) string {
+	return fakeAgentRuns(t, events)
+}
+
+// fakeAgentRuns is fakeAgent for several runs: run n prints runs[n-1] (the
+// last entry repeats) and leaves its stdin in prompt.<n> as well as prompt.
+func fakeAgentRuns(t *testing.T, runs ...[]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for i, events := range runs {
+		out := filepath.Join(dir, fmt.Sprintf("events.%d.ndjson", i+1))
+		require.NoError(t, os.WriteFile(out, []byte(strings.Join(events, "\n")+"\n"), 0644))
+	}
+	script := fmt.Sprintf(`#!/bin/sh
+cd %[1]q
+n=$(cat count 2>/dev/null || echo 0); n=$((n+1)); echo $n > count
+echo "$@" > args
+cat > prompt.$n
+cp prompt.$n prompt
+f=events.$n.ndjson; [ -f "$f" ] || f=events.%[2]d.ndjson
+cat "$f"
+`, dir, len(runs))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cursor-agent"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func chat(t *testing.T, srv *Server, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(body)))
+	w := httptest.NewRecorder()
+	srv.mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestServer_ChatCompletions_Usage(t *testing.T) {
+	cfg := config.Default()
+	cfg.Workspace = t.TempDir()
+	srv := New(cfg, logger.New("info"), "test")
+
+	fakeAgent(t,
+		`{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Hello there"}]}}`,
+		`{"type":"result","subtype":"success","usage":{"inputTokens":120,"outputTokens":4}}`,
+	)
+	w := chat(t, srv, `{"model":"cursor/auto","messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Usage streaming.Usage `json:"usage"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, streaming.Usage{PromptTokens: 120, CompletionTokens: 4, TotalTokens: 124, CompletionTokensDetails: &streaming.CompletionTokensDetails{}}, resp.Usage)
+
+	// Without reported usage the proxy estimates, and streams it on request.
+	fakeAgent(t, `{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Hello there"}]}}`)
+	w = chat(t, srv, `{"model":"cursor/auto","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	require.True(t, strings.HasSuffix(body, "data: [DONE]\n\n"), body)
+	lines := strings.Split(strings.TrimSpace(body), "\n\n")
+	last := strings.TrimPrefix(lines[len(lines)-2], "data: ")
+	var chunk struct {
+		Choices []any            `json:"choices"`
+		Usage   *streaming.Usage `json:"usage"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(last), &chunk))
+	assert.Empty(t, chunk.Choices)
+	require.NotNil(t, chunk.Usage)
+	assert.True(t, chunk.Usage.Estimated)
+	assert.Equal(t, 2, chunk.Usage.CompletionTokens)
+	assert.Positive(t, chunk.Usage.PromptTokens)
+
+	w = chat(t, srv, `{"model":"cursor/auto","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	assert.NotContains(t, w.Body.String(), `"usage"`)
+}
+
+func TestServer_ChatCompletions_ContextWindow(t *testing.T) {
+	auto, ok := models.Get("auto")
+	require.True(t, ok)
+	cfg := config.Default()
+	cfg.Workspace = t.TempDir()
+	// Leave room for roughly 300 tokens of prompt.
+	cfg.ContextWindow.ReserveTokens = auto.ContextWindow - 300
+	cfg.ContextWindow.Strategy = "reject"
+	srv := New(cfg, logger.New("info"), "test")
+
+	old := strings.Repeat("an old and rather long message ", 100)
+	body := `{"model":"cursor/auto","messages":[` +
+		`{"role":"system","content":"Be brief."},` +
+		`{"role":"user","content":"` + old + `"},` +
+		`{"role":"assistant","content":"ok"},` +
+		`{"role":"user","content":"what now?"}]}`
+
+	w := chat(t, srv, body)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"context_length_exceeded"`)
+	assert.Contains(t, w.Header().Get("X-OpenClaw-Cursor-Context"), "action=rejected;")
+
+	cfg.ContextWindow.Strategy = "drop_oldest"
+	cfg.ContextWindow.KeepRecent = 2
+	dir := fakeAgent(t, `{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"done"}]}}`)
+	w = chat(t, srv, body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Header().Get("X-OpenClaw-Cursor-Context"), "action=dropped_oldest; dropped=1;")
+	prompt, err := os.ReadFile(filepath.Join(dir, "prompt"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(prompt), "an old and rather long message")
+	assert.Contains(t, string(prompt), " SYSTEM>>>\nBe brief.")
+	assert.Contains(t, string(prompt), " USER>>>\nwhat now?")
+}
+
+func assistantText(text string) string {
+	b, _ := json.Marshal(text)
+	return `{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":` + string(b) + `}]}}`
+}
+
+const labelFormat = `"response_format":{"type":"json_schema","json_schema":{"name":"label","strict":true,"schema":{"type":"object","properties":{"label":{"enum":["bug","feature"]}},"required":["label"],"additionalProperties":false}}}`
+
+func TestServer_ChatCompletions_StructuredOutput(t *testing.T) {
+	cfg := config.Default()
+	cfg.Workspace = t.TempDir()
+	srv := New(cfg, logger.New("info"), "test")
+	body := `{"model":"cursor/auto",` + labelFormat + `,"messages":[{"role":"user","content":"crash on save"}]}`
+
+	dir := fakeAgentRuns(t,
+		[]string{assistantText("I think this is a {\"label\": \"defect\"}")},
+		[]string{assistantText("```json\n{\"label\": \"bug\"}\n```")},
+	)
+	w := chat(t, srv, body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage streaming.Usage `json:"usage"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, `{"label":"bug"}`, resp.Choices[0].Message.Content)
+
+	first, err := os.ReadFile(filepath.Join(dir, "prompt.1"))
+	require.NoError(t, err)
+	assert.Contains(t, string(first), "conforms to the JSON Schema below")
+	assert.Contains(t, string(first), `"additionalProperties": false`)
+	retry, err := os.ReadFile(filepath.Join(dir, "prompt.2"))
+	require.NoError(t, err)
+	assert.Contains(t, string(retry), " ASSISTANT>>>\nI think this is a")
+	assert.Contains(t, string(retry), `$.label: must be one of ["bug","feature"]`)
+	assert.Greater(t, resp.Usage.PromptTokens, 2*tokensIn(string(first))-1, "usage covers both runs")
+
+	// Strict streaming buffers, so a final failure is still a plain error.
+	fakeAgent(t, assistantText("no idea"))
+	w = chat(t, srv, `{"model":"cursor/auto","stream":true,`+labelFormat+`,"messages":[{"role":"user","content":"?"}]}`)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "after 3 attempts")
+
+	fakeAgent(t, assistantText(`{"label":"feature"}`))
+	w = chat(t, srv, `{"model":"cursor/auto","stream":true,`+labelFormat+`,"messages":[{"role":"user","content":"?"}]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"content":"{\"label\":\"feature\"}"`)
+	assert.Contains(t, w.Body.String(), `"finish_reason":"stop"`)
+
+	w = chat(t, srv, `{"model":"cursor/auto","response_format":{"type":"json_schema","json_schema":{"name":"x"}},"messages":[{"role":"user","content":"?"}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// markerOf returns the marker line that starts a block of role in prompt.
+func markerOf(prompt, role string) string {
+	token := prompt[strings.Index(prompt, "<<<")+3:]
+	return "<<<" + token[:strings.IndexByte(token, ' ')] + " " + role + ">>>"
+}
+
+func tokensIn(s string) int {
+	return streaming.EstimateUsage(s, "", "").PromptTokens
+}
+
+func TestServer_ChatCompletions_StopAndMaxTokens(t *testing.T) {
+	cfg := config.Default()
+	cfg.Workspace = t.TempDir()
+	srv := New(cfg, logger.New("info"), "test")
+	fakeAgent(t, assistantText("Answer: 42\nE"), assistantText("ND of answer"), assistantText(" trailing"))
+
+	w := chat(t, srv, `{"model":"cursor/auto","stream":true,"stop":"\nEND","messages":[{"role":"user","content":"?"}]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `"content":"Answer: 42"`)
+	assert.NotContains(t, body, "ND of")
+	assert.Contains(t, body, `"finish_reason":"stop"`)
+
+	w = chat(t, srv, `{"model":"cursor/auto","max_tokens":2,"messages":[{"role":"user","content":"?"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "Answer:", resp.Choices[0].Message.Content)
+	assert.Equal(t, "length", resp.Choices[0].FinishReason)
+
+	w = chat(t, srv, `{"model":"cursor/auto","stop":["zzz"],"messages":[{"role":"user","content":"?"}]}`)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "Answer: 42\nEND of answer trailing", resp.Choices[0].Message.Content)
+	assert.Equal(t, "stop", resp.Choices[0].FinishReason)
+}
+
+func TestServer_ChatCompletions_Attachments(t *testing.T) {
+	cfg := config.Default()
+	cfg.Workspace = t.TempDir()
+	srv := New(cfg, logger.New("info"), "test")
+	image := `{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBORw0KGgo="}}`
+
+	dir := fakeAgent(t, assistantText("a cat"))
+	w := chat(t, srv, `{"model":"cursor/sonnet-4.5","messages":[{"role":"user","content":[{"type":"text","text":"what is this?"},`+image+`]}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	prompt, err := os.ReadFile(filepath.Join(dir, "prompt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(prompt), "[Image attached: .openclaw-cursor/req-")
+	assert.NotContains(t, string(prompt), "iVBORw0KGgo")
+	_, err = os.Stat(filepath.Join(cfg.Workspace, ".openclaw-cursor"))
+	assert.True(t, os.IsNotExist(err), "scratch files are removed after the run")
+
+	w = chat(t, srv, `{"model":"cursor/auto","messages":[{"role":"user","content":[`+image+`]}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "does not accept images")
+
+	w = chat(t, srv, `{"model":"cursor/sonnet-4.5","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"/etc/passwd"}}]}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "outside the allowed attachment roots")
+}
+
+func TestServer_ChatCompletions_Choices(t *testing.T) {
+	cfg := config.Default()
+	cfg.Workspace = t.TempDir()
+	cfg.MaxConcurrentAgents = 1
+
+	// Without isolation the choices would share one workspace.
+	w := chat(t, New(cfg, logger.New("info"), "test"), `{"model":"cursor/auto","n":2,"messages":[{"role":"user","content":"hi"}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "requires workspace isolation")
+
+	cfg.Isolation.Mode = "request"
+	cfg.Isolation.Dir = t.TempDir()
+	srv := New(cfg, logger.New("info"), "test")
+	// Each run leaves a file behind in the workspace it ran in.
+	agentDir := t.TempDir()
+	script := fmt.Sprintf("#!/bin/sh\ncat > /dev/null\n"+
+		"while [ $# -gt 0 ]; do [ \"$1\" = --workspace ] && ws=$2; shift; done\n"+
+		"echo run > \"$ws/ran-here.txt\"\necho '%s'\n", assistantText("candidate"))
+	require.NoError(t, os.WriteFile(filepath.Join(agentDir, "cursor-agent"), []byte(script), 0755))
+	t.Setenv("PATH", agentDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	var resp struct {
+		Choices []struct {
+			Index   int `json:"index"`
+			Message struct {
+				Content *string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+			Error        *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+			Workspace *struct {
+				Path string `json:"path"`
+				Diff string `json:"diff"`
+			} `json:"openclaw_workspace"`
+		} `json:"choices"`
+		Workspace struct {
+			Path string `json:"path"`
+		} `json:"openclaw_workspace"`
+		Usage streaming.Usage `json:"usage"`
+	}
+
+	w = chat(t, srv, `{"model":"cursor/auto","n":3,"messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Choices, 3)
+	paths := map[string]bool{resp.Workspace.Path: true}
+	for i, c := range resp.Choices {
+		assert.Equal(t, i, c.Index)
+		assert.Equal(t, "candidate", *c.Message.Content)
+		assert.Equal(t, "stop", c.FinishReason)
+		if i > 0 {
+			require.NotNil(t, c.Workspace, "choice %d reports its own workspace", i)
+			assert.Contains(t, c.Workspace.Diff, "ran-here.txt")
+			paths[c.Workspace.Path] = true
+		}
+	}
+	assert.Len(t, paths, 3, "every choice ran in a copy of its own")
+	assert.NoFileExists(t, filepath.Join(cfg.Workspace, "ran-here.txt"))
+	assert.Equal(t, 3*tokensIn("candidate"), resp.Usage.CompletionTokens, "usage covers every run")
+	assert.Equal(t, 0, srv.agents.InUse())
+	entries, err := os.ReadDir(cfg.Isolation.Dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "choice copies are removed")
+
+	w = chat(t, srv, `{"model":"cursor/auto","n":2,"stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	for _, i := range []string{"0", "1"} {
+		assert.Contains(t, body, `{"index":`+i+`,"delta":{"content":"candidate"},"finish_reason":null}`)
+		assert.Contains(t, body, `{"index":`+i+`,"delta":{},"finish_reason":"stop"}`)
+	}
+	assert.Contains(t, body, "event: openclaw.choice\ndata: {\"index\":1,")
+	assert.Equal(t, 1, strings.Count(body, "data: [DONE]"))
+
+	w = chat(t, srv, `{"model":"cursor/auto","n":5,"messages":[{"role":"user","content":"hi"}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "n must be between 1 and 4")
+
+	// One of two runs fails: the other is still returned.
+	dir := t.TempDir()
+	script = fmt.Sprintf("#!/bin/sh\ncat > /dev/null\nif mkdir %q 2>/dev/null; then echo boom >&2; exit 1; fi\necho '%s'\n",
+		filepath.Join(dir, "failed"), assistantText("survivor"))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cursor-agent"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	w = chat(t, srv, `{"model":"cursor/auto","n":2,"messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	resp.Choices = nil
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Choices, 2)
+	var reasons []string
+	for _, c := range resp.Choices {
+		reasons = append(reasons, c.FinishReason)
+		if c.FinishReason == "error" {
+			assert.Nil(t, c.Message.Content)
+			require.NotNil(t, c.Error)
+		} else {
+			assert.Equal(t, "survivor", *c.Message.Content)
+		}
+	}
+	assert.ElementsMatch(t, []string{"stop", "error"}, reasons)
+}
+
+func TestServer_ChatCompletions_ChoicesFormatRetry(t *testing.T) {
+	cfg := config.Default()
+	cfg.Workspace = t.TempDir()
+	cfg.Isolation.Mode = "request"
+	cfg.Isolation.Dir = t.TempDir()
+	srv := New(cfg, logger.New("info"), "test")
+	// Every choice first answers in prose, then with JSON when re-prompted.
+	dir := t.TempDir()
+	script := fmt.Sprintf("#!/bin/sh\nif grep -q 'not valid for the required response format'; then echo '%s'; else echo '%s'; fi\n",
+		assistantText(`{"ok":true}`), assistantText("sure thing"))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cursor-agent"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	w := chat(t, srv, `{"model":"cursor/auto","n":3,"response_format":{"type":"json_object"},"messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Choices, 3)
+	for _, c := range resp.Choices {
+		assert.JSONEq(t, `{"ok":true}`, c.Message.Content)
+	}
+}
+
+func TestServer_ChatCompletions_ChoicesSessionWorkspace(t *testing.T) {
+	cfg := config.Default()
+	cfg.Workspace = t.TempDir()
+	cfg.Isolation.Mode = "session"
+	cfg.Isolation.Dir = t.TempDir()
+	srv := New(cfg, logger.New("info"), "test")
+	agentDir := t.TempDir()
+	script := fmt.Sprintf("#!/bin/sh\ncat > /dev/null\n"+
+		"while [ $# -gt 0 ]; do [ \"$1\" = --workspace ] && ws=$2; shift; done\n"+
+		"echo run >> \"$ws/log.txt\"\necho '%s'\n", assistantText("ok"))
+	require.NoError(t, os.WriteFile(filepath.Join(agentDir, "cursor-agent"), []byte(script), 0755))
+	t.Setenv("PATH", agentDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("x-openclaw-session-id", "s1")
+		w := httptest.NewRecorder()
+		srv.mux.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		return w
+	}
+
+	send(`{"model":"cursor/auto","messages":[{"role":"user","content":"hi"}]}`)
+	w := send(`{"model":"cursor/auto","n":2,"messages":[{"role":"user","content":"again"}]}`)
+	var resp struct {
+		Choices []struct {
+			Workspace *struct {
+				Diff string `json:"diff"`
+			} `json:"openclaw_workspace"`
+		} `json:"choices"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Choices, 2)
+	require.NotNil(t, resp.Choices[1].Workspace)
+	// The extra choice starts from the session's copy, which already has
+	// the first turn's log.
+	diff := resp.Choices[1].Workspace.Diff
+	assert.Contains(t, diff, "log.txt")
+	assert.NotContains(t, diff, "new file")
+}
+
+func TestServer_ChatCompletions_Hedge(t *testing.T) {
+	cfg := config.Default()
+	cfg.Workspace = t.TempDir()
+	cfg.Hedges = map[string]config.Hedge{"auto": {Models: []string{"auto", "sonnet-4.5"}, DelayMs: 20}}
+	cfg.Isolation.Mode = "request"
+	cfg.Isolation.Dir = t.TempDir()
+	cfg.Isolation.KeepWorktree = true
+	srv := New(cfg, logger.New("info"), "test")
+	// auto is slow to answer, so the sonnet hedge wins. Each candidate writes
+	// its model into its workspace.
+	dir := t.TempDir()
+	script := fmt.Sprintf("#!/bin/sh\ncat > /dev/null\nwhile [ $# -gt 0 ]; do [ \"$1\" = --workspace ] && ws=$2; [ \"$1\" = --model ] && m=$2; shift; done\n"+
+		"echo \"$m\" > \"$ws/ran.txt\"\ncase \"$m\" in auto) sleep 2; echo '%s';; *) echo '%s';; esac\n",
+		assistantText("from auto"), assistantText("from hedge"))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cursor-agent"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	start := time.Now()
+	w := chat(t, srv, `{"model":"cursor/auto","messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Less(t, time.Since(start), 2*time.Second, "the loser is not waited for")
+	assert.Contains(t, w.Body.String(), `"content":"from hedge"`)
+	model := w.Header().Get("X-OpenClaw-Cursor-Model")
+	assert.Contains(t, model, "sonnet")
+	assert.Equal(t, "alias=auto; winner=1", w.Header().Get("X-OpenClaw-Cursor-Hedge"))
+	ran, err := os.ReadFile(filepath.Join(w.Header().Get("X-OpenClaw-Cursor-Worktree"), "ran.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, model+"\n", string(ran), "the response reports the winner's own workspace")
+	assert.NoFileExists(t, filepath.Join(cfg.Workspace, "ran.txt"))
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w = httptest.NewRecorder()
+	srv.mux.ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), `openclaw_cursor_hedged_requests_total{alias="auto"} 1`)
+	assert.Contains(t, w.Body.String(), `openclaw_cursor_hedge_wins_total{alias="auto",candidate="1",model="`+model+`"} 1`)
+
+	// Models without a hedges entry run once.
+	w = chat(t, srv, `{"model":"cursor/sonnet-4.5","messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Empty(t, w.Header().Get("X-OpenClaw-Cursor-Hedge"))
+
+	// Without per-request isolation candidates would share files, so the
+	// request runs once.
+	cfg.Isolation.Mode = "off"
+	srv = New(cfg, logger.New("info"), "test")
+	w = chat(t, srv, `{"model":"cursor/auto","messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Empty(t, w.Header().Get("X-OpenClaw-Cursor-Hedge"))
+	assert.Contains(t, w.Body.String(), `"content":"from auto"`)
+}
+
+func TestServer_ChatCompletions_Prefill(t *testing.T) {
+	cfg := config.Default()
+	cfg.Workspace = t.TempDir()
+	srv := New(cfg, logger.New("info"), "test")
+	dir := fakeAgent(t, assistantText("Roses are red,\nviolets"), assistantText(" are blue."))
+	body := `"messages":[{"role":"user","content":"A poem"},{"role":"assistant","content":"Roses are red,"}]}`
+
+	w := chat(t, srv, `{"model":"cursor/auto",`+body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"content":"\nviolets are blue."`)
+	prompt, err := os.ReadFile(filepath.Join(dir, "prompt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(prompt), "The last ASSISTANT message is unfinished.")
+
+	w = chat(t, srv, `{"model":"cursor/auto","stream":true,`+body)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "Roses")
+	assert.Contains(t, w.Body.String(), `"content":"\nviolets"`)
+	assert.Contains(t, w.Body.String(), `"content":" are blue."`)
+}
+
+func TestServer_ChatCompletions_SpillToolResults(t *testing.T) {
+	cfg := config.Default()
+	cfg.Workspace = t.TempDir()
+	cfg.ToolResults.SpillTokens = 100
+	srv := New(cfg, logger.New("info"), "test")
+	dir := fakeAgent(t, assistantText("ok"))
+	output := strings.Repeat("a line of build output\n", 100)
+	body := `{"model":"cursor/auto","messages":[{"role":"user","content":"build it"},` +
+		`{"role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":"exec","arguments":"{}"}}]},` +
+		`{"role":"tool","tool_call_id":"call_1","content":"` + strings.ReplaceAll(output, "\n", `\n`) + `"}]}`
+	scratch := filepath.Join(cfg.Workspace, ".openclaw-cursor")
+
+	w := chat(t, srv, body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	prompt, err := os.ReadFile(filepath.Join(dir, "prompt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(prompt), "saved to .openclaw-cursor/req-")
+	assert.NotContains(t, string(prompt), output)
+	_, err = os.Stat(scratch)
+	assert.True(t, os.IsNotExist(err), "request files are removed after the run")
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("x-openclaw-session-id", "s1")
+	w = httptest.NewRecorder()
+	srv.mux.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	prompt, err = os.ReadFile(filepath.Join(dir, "prompt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(prompt), "saved to .openclaw-cursor/session-s1/tool-call_1.txt")
+	saved, err := os.ReadFile(filepath.Join(scratch, "session-s1", "tool-call_1.txt"))
+	require.NoError(t, err, "session files stay for later turns")
+	assert.Equal(t, output, string(saved))
+
+	// The preview shows the same excerpt without writing anything.
+	require.NoError(t, os.RemoveAll(scratch))
+	var preq translator.ChatCompletionRequest
+	require.NoError(t, json.Unmarshal([]byte(body), &preq))
+	_, preview, err := srv.PreviewPrompt(preq, cfg.Workspace)
+	require.NoError(t, err)
+	assert.Contains(t, preview, "saved to .openclaw-cursor/req-preview/tool-call_1.txt")
+	assert.NotContains(t, preview, output)
+	_, err = os.Stat(scratch)
+	assert.True(t, os.IsNotExist(err), "previews don't write tool results")
+
+	// Spilled results get per-call file names; the loop guard still sees
+	// the same large output coming back.
+	var rounds strings.Builder
+	for i := 1; i <= cfg.MaxToolCallRepeats+1; i++ {
+		fmt.Fprintf(&rounds, `,{"role":"assistant","tool_calls":[{"id":"call_%d","type":"function","function":{"name":"exec","arguments":"{}"}}]},`+
+			`{"role":"tool","tool_call_id":"call_%d","content":"%s"}`, i, i, strings.ReplaceAll(output, "\n", `\n`))
+	}
+	w = chat(t, srv, `{"model":"cursor/auto","messages":[{"role":"user","content":"build it"}`+rounds.String()+`]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Header().Get("X-OpenClaw-Cursor-Loop-Guard"), "repeated more than")
+}
+
+func TestServer_ChatCompletions_SystemPrompts(t *testing.T) {
+	cfg := config.Default()
+	cfg.Workspace = t.TempDir()
+	cfg.SystemPrompt = "Never push to remote branches."
+	cfg.SystemPrompts = []config.SystemPromptRule{
+		{Models: []string{"claude"}, Prompt: "Prefer small diffs."},
+		{Models: []string{"codex"}, Prompt: "Codex only."},
+		{Workspaces: []string{cfg.Workspace}, Prompt: "This repo uses tabs."},
+		{Workspaces: []string{t.TempDir()}, Prompt: "Other repo."},
+	}
+	srv := New(cfg, logger.New("info"), "test")
+	dir := fakeAgent(t, assistantText("ok"))
+
+	w := chat(t, srv, `{"model":"cursor/sonnet-4.5","messages":[{"role":"user","content":"hi"},{"role":"developer","content":"Be terse."}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	prompt, err := os.ReadFile(filepath.Join(dir, "prompt"))
+	require.NoError(t, err)
+	p := string(prompt)
+	assert.True(t, strings.HasSuffix(p, markerOf(p, "SYSTEM")+"\nNever push to remote branches.\n\nPrefer small diffs.\n\nThis repo uses tabs.\n\n"+
+		markerOf(p, "DEVELOPER")+"\nBe terse.\n\n"+markerOf(p, "USER")+"\nhi"), p)
+	assert.NotContains(t, string(prompt), "Codex only.")
+	assert.NotContains(t, string(prompt), "Other repo.")
+}
+
+func TestServer_PromptTemplates(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, text string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(text), 0644))
+		return path
+	}
+	cfg := config.Default()
+	cfg.Workspace = t.TempDir()
+	cfg.PromptTemplates = config.PromptTemplates{
+		Default: write("default.tmpl", `{{.Preamble}} default{{range .Messages}} {{.Content}}{{end}}`),
+		Models: map[string]string{
+			"claude":     write("claude.tmpl", `{{.Preamble}} claude`),
+			"codex":      write("codex.tmpl", `{{.Preamble}} codex`),
+			"composer-1": write("broken.tmpl", `{{.Preamble`),
+		},
+	}
+	srv := New(cfg, logger.New("info"), "test")
+	user := []translator.Message{{Role: "user", Content: json.RawMessage(`"hi"`)}}
+
+	for model, want := range map[string]string{
+		"cursor/sonnet-4.5":    " claude",
+		"cursor/gpt-5.3-codex": " codex",
+		"cursor/auto":          " default hi",
+	} {
+		_, prompt, err := srv.PreviewPrompt(translator.ChatCompletionRequest{Model: model, Messages: user}, cfg.Workspace)
+		require.NoError(t, err, model)
+		assert.True(t, strings.HasSuffix(prompt, want), "%s: %s", model, prompt)
+	}
+	// A template that doesn't parse leaves the model on the default.
+	_, prompt, err := srv.PreviewPrompt(translator.ChatCompletionRequest{Model: "cursor/composer-1", Messages: user}, cfg.Workspace)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(prompt, " default hi"), prompt)
+
+	agentDir := fakeAgent(t, assistantText("ok"))
+	w := chat(t, srv, `{"model":"cursor/sonnet-4.5","messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	sent, err := os.ReadFile(filepath.Join(agentDir, "prompt"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(sent), " claude"), string(sent))
+}
+
+func TestStatusFor_FallbackErrors(t *testing.T) {
+	// cursor-agent failures keep 429 so OpenClaw falls back to another model.
+	for _, typ := range []string{"quota_exceeded", "rate_limit", "auth_failed", "network_error", "model_unavailable", "unknown"} {
+		assert.Equal(t, http.StatusTooManyRequests, statusFor(&errors.ParsedError{Type: typ}), typ)
+	}
+	assert.Equal(t, http.StatusBadRequest, statusFor(&errors.ParsedError{Type: "invalid_request"}))
+	assert.Equal(t, http.StatusInternalServerError, statusFor(&errors.ParsedError{Type: "snapshot_error"}), "the proxy's own failures are not fallbacks")
+}
+
+func TestServer_ChatCompletions_ModelErrors(t *testing.T) {
+	cfg := config.Default()
+	cfg.Workspace = t.TempDir()
+	srv := New(cfg, logger.New("info"), "test")
+
+	// A model the proxy can't resolve is the client's mistake.
+	w := chat(t, srv, `{"model":"cursor/no-such-model","messages":[{"role":"user","content":"hi"}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"model_not_found"`)
+
+	// cursor-agent refusing the model keeps 429, so OpenClaw falls back.
+	dir := t.TempDir()
+	script := "#!/bin/sh\ncat > /dev/null\necho 'Cannot use this model: auto' >&2\nexit 1\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cursor-agent"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	w = chat(t, srv, `{"model":"cursor/auto","messages":[{"role":"user","content":"hi"}]}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"model_unavailable"`)
+}
+
+func TestServer_ChatCompletions_OversizedLine(t *testing.T) {
+	cfg := config.Default()
+	cfg.Workspace = t.TempDir()
+	cfg.TimeoutMs = 20000
+	srv := New(cfg, logger.New("info"), "test")
+	// A line over the scanner's 1MB limit, then more output than a pipe
+	// holds: the agent must not be left blocked writing it.
+	dir := t.TempDir()
+	script := "#!/bin/sh\ncat > /dev/null\nhead -c 1200000 /dev/zero | tr '\\0' x\necho\nhead -c 500000 /dev/zero | tr '\\0' y\necho\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cursor-agent"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	for _, stream := range []string{"false", "true"} {
+		start := time.Now()
+		w := chat(t, srv, `{"model":"cursor/auto","stream":`+stream+`,"messages":[{"role":"user","content":"hi"}]}`)
+		assert.Less(t, time.Since(start), 10*time.Second, "stream=%s", stream)
+		if stream == "false" {
+			assert.Contains(t, w.Body.String(), "token too long")
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/menezmethod/openclaw-cursor/internal/translator"
+	"github.com/menezmethod/openclaw-cursor/internal/workspace"
+)
+
+// scratchName names the scratch directory for a request's tool results: one
+// per OpenClaw session, so later turns find the files again, otherwise the
+// request's own (shared with its attachments).
+func scratchName(r *http.Request, reqID string) string {
+	if id := strings.TrimSpace(r.Header.Get("x-openclaw-session-id")); id != "" {
+		return "session-" + id
+	}
+	return "req-" + reqID
+}
+
+func (s *Server) spillOptions(name string) translator.SpillOptions {
+	return translator.SpillOptions{
+		Dir:           workspace.ScratchPath(name),
+		MinTokens:     s.cfg.ToolResults.SpillTokens,
+		ExcerptTokens: s.cfg.ToolResults.ExcerptTokens,
+	}
+}
+
+// writeSpills writes spilled tool results into agentDir. The returned
+// cleanup removes per-request files; session files stay until the session
+// goes idle (see pruneSessionScratch).
+func (s *Server) writeSpills(agentDir, name string, spills []translator.Spill) (func(), error) {
+	if len(spills) == 0 {
+		return func() {}, nil
+	}
+	scratch, err := workspace.NewScratch(agentDir, name)
+	if err != nil {
+		return nil, err
+	}
+	for _, sp := range spills {
+		if _, err := scratch.Put(filepath.Base(sp.Path), []byte(sp.Content)); err != nil {
+			_ = scratch.Remove()
+			return nil, err
+		}
+	}
+	s.log.Debug("spilled tool results", "dir", scratch.Dir, "count", len(spills))
+	if !strings.HasPrefix(name, "session-") {
+		return func() {
+			if err := scratch.Remove(); err != nil {
+				s.log.Warn("remove tool results", "dir", scratch.Dir, "err", err)
+			}
+		}, nil
+	}
+	s.scratchRoots.Store(agentDir, struct{}{})
+	s.pruneSessionScratch(agentDir)
+	return func() {}, nil
+}
+
+// pruneSessionScratch removes the tool result files of sessions that have
+// been idle longer than session_ttl_minutes.
+func (s *Server) pruneSessionScratch(dir string) {
+	ttl := time.Duration(s.cfg.ToolResults.SessionTTLMinutes) * time.Minute
+	if ttl <= 0 {
+		return
+	}
+	if n, err := workspace.PruneScratch(dir, "session-", ttl); err != nil {
+		s.log.Warn("prune session scratch", "workspace", dir, "err", err)
+	} else if n > 0 {
+		s.log.Info("removed idle session scratch", "workspace", dir, "count", n)
+	}
+}
+
+// cleanupSessionScratch prunes idle session files in every workspace that
+// has had some, hourly.
+func (s *Server) cleanupSessionScratch(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.scratchRoots.Range(func(k, _ any) bool {
+			s.pruneSessionScratch(k.(string))
+			return true
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package snapshot
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Retention limits for archived snapshots. Zero disables a limit.
+type Retention struct {
+	MaxSnapshots  int
+	MaxAge        time.Duration
+	MaxStoreBytes int64
+}
+
+// Manifest is an archived snapshot: the file list of a workspace before a
+// run, with contents in the archive's blob store.
+type Manifest struct {
+	ID        string    `json:"id"`
+	RequestID string    `json:"request_id,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Workspace string    `json:"workspace"`
+	Created   time.Time `json:"created"`
+	Git       bool      `json:"git"`
+	Truncated bool      `json:"truncated,omitempty"`
+	FileCount int       `json:"file_count"`
+	Bytes     int64     `json:"bytes"`
+	// Files is omitted from listings.
+	Files map[string]File `json:"files,omitempty"`
+}
+
+// RestoreResult lists what a restore did (or would do, in dry-run).
+type RestoreResult struct {
+	Snapshot string   `json:"snapshot"`
+	Backup   string   `json:"backup,omitempty"`
+	Restored []string `json:"restored"`
+	Deleted  []string `json:"deleted"`
+	Skipped  []string `json:"skipped"`
+}
+
+// Archive persists snapshots on disk so a workspace can be rolled back.
+//
+//	<dir>/blobs/<hash[:2]>/<hash>   file contents
+//	<dir>/manifests/<id>.json       one per snapshot
+type Archive struct {
+	dir       string
+	store     *DiskStore
+	opts      Options
+	retention Retention
+}
+
+// DefaultArchiveDir returns ~/.openclaw/cursor-snapshots.
+func DefaultArchiveDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "openclaw-cursor-snapshots")
+	}
+	return filepath.Join(home, ".openclaw", "cursor-snapshots")
+}
+
+// OpenArchive opens (creating if needed) the archive at dir.
+func OpenArchive(dir string, opts Options, retention Retention) (*Archive, error) {
+	if dir == "" {
+		dir = DefaultArchiveDir()
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "manifests"), 0700); err != nil {
+		return nil, fmt.Errorf("snapshot archive: %w", err)
+	}
+	return &Archive{
+		dir:       dir,
+		store:     NewDiskStore(filepath.Join(dir, "blobs")),
+		opts:      opts.withDefaults(),
+		retention: retention,
+	}, nil
+}
+
+// Take captures a workspace with contents written straight to the archive's
+// blob store, so the snapshot can be saved without copying.
+func (a *Archive) Take(root string) (*Snapshot, error) {
+	return Take(root, a.store, a.opts)
+}
+
+func newID(t time.Time) string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return t.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
+
+// Save records snap as a manifest and applies retention. Snapshots named in
+// keep survive the prune.
+func (a *Archive) Save(snap *Snapshot, meta Manifest, keep ...string) (*Manifest, error) {
+	if snap.store != Store(a.store) {
+		return nil, fmt.Errorf("snapshot of %s was not taken by this archive", snap.Root)
+	}
+	m := meta
+	m.ID = newID(snap.Taken)
+	m.Workspace = snap.Root
+	m.Created = snap.Taken
+	m.Git = snap.Git
+	m.Truncated = snap.Truncated
+	m.FileCount = len(snap.Files)
+	m.Bytes = snap.Bytes
+	m.Files = snap.Files
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(a.manifestPath(m.ID), b, 0600); err != nil {
+		return nil, fmt.Errorf("save snapshot: %w", err)
+	}
+	if err := a.Prune(keep...); err != nil {
+		return &m, fmt.Errorf("prune snapshots: %w", err)
+	}
+	return &m, nil
+}
+
+func (a *Archive) manifestPath(id string) string {
+	return filepath.Join(a.dir, "manifests", id+".json")
+}
+
+// Load returns the full manifest for id.
+func (a *Archive) Load(id string) (*Manifest, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		return nil, fmt.Errorf("invalid snapshot id %q", id)
+	}
+	b, err := os.ReadFile(a.manifestPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("snapshot %s not found", id)
+		}
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", id, err)
+	}
+	return &m, nil
+}
+
+// List returns manifests (without file lists), newest first. A non-empty
+// workspace filters to that workspace.
+func (a *Archive) List(workspace string) ([]Manifest, error) {
+	all, err := a.loadAll()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Manifest, 0, len(all))
+	for _, m := range all {
+		if workspace != "" && m.Workspace != workspace {
+			continue
+		}
+		m.Files = nil
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func (a *Archive) loadAll() ([]Manifest, error) {
+	entries, err := os.ReadDir(filepath.Join(a.dir, "manifests"))
+	if err != nil {
+		return nil, err
+	}
+	var out []Manifest
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		m, err := a.Load(strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			continue
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.After(out[j].Created) })
+	return out, nil
+}
+
+// Restore rolls the snapshot's workspace back to the captured state: files
+// are rewritten from the blob store and files created since are removed
+// (unless the snapshot was truncated). The current state is archived first so
+// the restore itself can be undone. Large files without stored content are
+// skipped.
+func (a *Archive) Restore(id string, dryRun bool) (*RestoreResult, error) {
+	m, err := a.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	current, err := a.Take(m.Workspace)
+	if err != nil {
+		return nil, fmt.Errorf("scan %s: %w", m.Workspace, err)
+	}
+	res := &RestoreResult{Snapshot: id, Restored: []string{}, Deleted: []string{}, Skipped: []string{}}
+
+	var paths []string
+	for p := range m.Files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		f := m.Files[p]
+		cur, ok := current.Files[p]
+		if ok && cur.Hash == f.Hash && cur.Mode == f.Mode {
+			continue
+		}
+		if f.Large {
+			res.Skipped = append(res.Skipped, p)
+			continue
+		}
+		res.Restored = append(res.Restored, p)
+	}
+	if !m.Truncated && !current.Truncated {
+		for p := range current.Files {
+			if _, ok := m.Files[p]; !ok {
+				res.Deleted = append(res.Deleted, p)
+			}
+		}
+		sort.Strings(res.Deleted)
+	}
+	if dryRun || (len(res.Restored) == 0 && len(res.Deleted) == 0) {
+		return res, nil
+	}
+
+	// Read the contents before the backup is saved: its prune must not take
+	// the snapshot being restored (or its blobs) with it.
+	contents := make(map[string][]byte, len(res.Restored))
+	for _, p := range res.Restored {
+		data, err := a.store.Get(m.Files[p].Hash)
+		if err != nil {
+			return nil, fmt.Errorf("restore %s: %w", p, err)
+		}
+		contents[p] = data
+	}
+
+	backup, err := a.Save(current, Manifest{Reason: "before restore of " + id}, id)
+	if backup != nil {
+		res.Backup = backup.ID
+	}
+	if err != nil && backup == nil {
+		return nil, err
+	}
+
+	for _, p := range res.Restored {
+		f := m.Files[p]
+		data := contents[p]
+		abs := filepath.Join(m.Workspace, p)
+		if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+			return res, err
+		}
+		if err := writeFileAtomic(abs, data, f.Mode); err != nil {
+			return res, fmt.Errorf("restore %s: %w", p, err)
+		}
+	}
+	for _, p := range res.Deleted {
+		if err := os.Remove(filepath.Join(m.Workspace, p)); err != nil && !os.IsNotExist(err) {
+			return res, fmt.Errorf("remove %s: %w", p, err)
+		}
+	}
+	return res, nil
+}
+
+// Prune drops manifests beyond the retention limits (oldest first), except
+// the ids in keep, and removes blobs no manifest references any more.
+func (a *Archive) Prune(keep ...string) error {
+	all, err := a.loadAll()
+	if err != nil {
+		return err
+	}
+	pinned := make(map[string]bool, len(keep))
+	for _, id := range keep {
+		pinned[id] = true
+	}
+	kept := all[:0]
+	var total int64
+	for i, m := range all {
+		drop := (a.retention.MaxSnapshots > 0 && i >= a.retention.MaxSnapshots) ||
+			(a.retention.MaxAge > 0 && time.Since(m.Created) > a.retention.MaxAge) ||
+			(a.retention.MaxStoreBytes > 0 && total+m.Bytes > a.retention.MaxStoreBytes && i > 0)
+		if drop && !pinned[m.ID] {
+			os.Remove(a.manifestPath(m.ID))
+			continue
+		}
+		total += m.Bytes
+		kept = append(kept, m)
+	}
+	referenced := make(map[string]bool)
+	for _, m := range kept {
+		for _, f := range m.Files {
+			referenced[f.Hash] = true
+		}
+	}
+	return a.store.retain(referenced)
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,135 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchive_SaveListRestore(t *testing.T) {
+	ws := t.TempDir()
+	write(t, ws, "main.go", "package main\n")
+	write(t, ws, "docs/readme.md", "hello\n")
+
+	a, err := OpenArchive(t.TempDir(), Options{}, Retention{})
+	require.NoError(t, err)
+	snap, err := a.Take(ws)
+	require.NoError(t, err)
+	m, err := a.Save(snap, Manifest{RequestID: "req-1", Model: "auto"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, m.FileCount)
+
+	// A bad agent turn.
+	write(t, ws, "main.go", "package broken\n")
+	write(t, ws, "junk.txt", "junk\n")
+	require.NoError(t, os.Remove(filepath.Join(ws, "docs", "readme.md")))
+
+	list, err := a.List(ws)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, m.ID, list[0].ID)
+	assert.Equal(t, "req-1", list[0].RequestID)
+	assert.Nil(t, list[0].Files)
+
+	dry, err := a.Restore(m.ID, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join("docs", "readme.md"), "main.go"}, dry.Restored)
+	assert.Equal(t, []string{"junk.txt"}, dry.Deleted)
+	got, _ := os.ReadFile(filepath.Join(ws, "main.go"))
+	assert.Equal(t, "package broken\n", string(got), "dry run must not touch files")
+
+	res, err := a.Restore(m.ID, false)
+	require.NoError(t, err)
+	assert.NotEmpty(t, res.Backup)
+	got, _ = os.ReadFile(filepath.Join(ws, "main.go"))
+	assert.Equal(t, "package main\n", string(got))
+	got, _ = os.ReadFile(filepath.Join(ws, "docs", "readme.md"))
+	assert.Equal(t, "hello\n", string(got))
+	assert.NoFileExists(t, filepath.Join(ws, "junk.txt"))
+
+	// The pre-restore state was archived, so the restore can be undone.
+	_, err = a.Restore(res.Backup, false)
+	require.NoError(t, err)
+	got, _ = os.ReadFile(filepath.Join(ws, "junk.txt"))
+	assert.Equal(t, "junk\n", string(got))
+}
+
+func TestArchive_Retention(t *testing.T) {
+	ws := t.TempDir()
+	dir := t.TempDir()
+	a, err := OpenArchive(dir, Options{}, Retention{MaxSnapshots: 2})
+	require.NoError(t, err)
+
+	var ids []string
+	for i, content := range []string{"v1\n", "v2\n", "v3\n"} {
+		write(t, ws, "f.txt", content)
+		snap, err := a.Take(ws)
+		require.NoError(t, err)
+		snap.Taken = snap.Taken.Add(time.Duration(i) * time.Second)
+		m, err := a.Save(snap, Manifest{})
+		require.NoError(t, err)
+		ids = append(ids, m.ID)
+	}
+	list, err := a.List("")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, ids[2], list[0].ID)
+	assert.Equal(t, ids[1], list[1].ID)
+	_, err = a.Load(ids[0])
+	assert.Error(t, err)
+
+	// Unreferenced blobs are collected once they're past the grace period.
+	v1 := hashBytes([]byte("v1\n"))
+	old := time.Now().Add(-2 * blobGrace)
+	require.NoError(t, os.Chtimes(a.store.path(v1), old, old))
+	require.NoError(t, a.Prune())
+	_, err = a.store.Get(v1)
+	assert.Error(t, err)
+	_, err = a.store.Get(hashBytes([]byte("v3\n")))
+	assert.NoError(t, err)
+}
+
+func TestArchive_RestoreOldestAtCap(t *testing.T) {
+	ws := t.TempDir()
+	a, err := OpenArchive(t.TempDir(), Options{}, Retention{MaxSnapshots: 2})
+	require.NoError(t, err)
+
+	var ids []string
+	for i, content := range []string{"v1\n", "v2\n"} {
+		write(t, ws, "f.txt", content)
+		snap, err := a.Take(ws)
+		require.NoError(t, err)
+		snap.Taken = snap.Taken.Add(time.Duration(i-2) * time.Second)
+		m, err := a.Save(snap, Manifest{})
+		require.NoError(t, err)
+		ids = append(ids, m.ID)
+	}
+	write(t, ws, "f.txt", "v3\n")
+	old := time.Now().Add(-2 * blobGrace)
+	for _, v := range []string{"v1\n", "v2\n"} {
+		require.NoError(t, os.Chtimes(a.store.path(hashBytes([]byte(v))), old, old))
+	}
+
+	// Saving the backup pushes the oldest snapshot past the cap; restoring it
+	// must still work and must not lose it.
+	res, err := a.Restore(ids[0], false)
+	require.NoError(t, err)
+	assert.NotEmpty(t, res.Backup)
+	got, _ := os.ReadFile(filepath.Join(ws, "f.txt"))
+	assert.Equal(t, "v1\n", string(got))
+	_, err = a.Load(ids[0])
+	assert.NoError(t, err)
+	_, err = a.store.Get(hashBytes([]byte("v1\n")))
+	assert.NoError(t, err)
+}
+
+func TestArchive_LoadRejectsPathIDs(t *testing.T) {
+	a, err := OpenArchive(t.TempDir(), Options{}, Retention{})
+	require.NoError(t, err)
+	_, err = a.Load("../../etc/passwd")
+	assert.Error(t, err)
+}
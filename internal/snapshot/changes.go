@@ -0,0 +1,144 @@
+package snapshot
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Change statuses.
+const (
+	Created  = "created"
+	Modified = "modified"
+	Deleted  = "deleted"
+)
+
+// Change is one file touched between two snapshots.
+type Change struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Diff   string `json:"diff,omitempty"`
+	Binary bool   `json:"binary,omitempty"`
+	// Large files are compared by size and mtime; no diff is available.
+	Large bool `json:"large,omitempty"`
+}
+
+// Report summarizes what changed in a workspace during an agent run.
+type Report struct {
+	Created  []string `json:"created"`
+	Modified []string `json:"modified"`
+	Deleted  []string `json:"deleted"`
+	Changes  []Change `json:"changes"`
+	// Truncated is set when either snapshot was partial or diffs hit the size cap.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Empty reports whether nothing changed.
+func (r *Report) Empty() bool {
+	return len(r.Changes) == 0
+}
+
+// Compare diffs two snapshots of the same workspace. Diffs are unified diffs
+// with 3 lines of context; once maxDiffBytes of diff text has been produced
+// the remaining changes are listed without a diff.
+func Compare(before, after *Snapshot, maxDiffBytes int) *Report {
+	r := &Report{
+		Created:   []string{},
+		Modified:  []string{},
+		Deleted:   []string{},
+		Changes:   []Change{},
+		Truncated: before.Truncated || after.Truncated,
+	}
+	var paths []string
+	for p := range before.Files {
+		paths = append(paths, p)
+	}
+	for p := range after.Files {
+		if _, ok := before.Files[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	budget := maxDiffBytes
+	for _, p := range paths {
+		old, hadOld := before.Files[p]
+		cur, hasCur := after.Files[p]
+		var c Change
+		switch {
+		case hadOld && !hasCur:
+			// A file beyond the cap in a truncated rescan isn't a deletion.
+			if after.Truncated {
+				continue
+			}
+			c = Change{Path: p, Status: Deleted}
+			r.Deleted = append(r.Deleted, p)
+		case !hadOld && hasCur:
+			if before.Truncated {
+				continue
+			}
+			c = Change{Path: p, Status: Created}
+			r.Created = append(r.Created, p)
+		case old.Hash != cur.Hash || old.Mode != cur.Mode:
+			c = Change{Path: p, Status: Modified}
+			r.Modified = append(r.Modified, p)
+		default:
+			continue
+		}
+		c.Large = old.Large || cur.Large
+		if !c.Large {
+			var a, b []byte
+			if hadOld {
+				a, _ = before.store.Get(old.Hash)
+			}
+			if hasCur {
+				b, _ = after.store.Get(cur.Hash)
+			}
+			if isBinary(a) || isBinary(b) {
+				c.Binary = true
+			} else if budget > 0 || maxDiffBytes <= 0 {
+				c.Diff = unifiedDiff(p, a, b, hadOld, hasCur)
+				if maxDiffBytes > 0 {
+					if len(c.Diff) > budget {
+						c.Diff = c.Diff[:budget] + "\n... diff truncated ...\n"
+						r.Truncated = true
+					}
+					budget -= len(c.Diff)
+				}
+			} else {
+				r.Truncated = true
+			}
+		}
+		r.Changes = append(r.Changes, c)
+	}
+	return r
+}
+
+func isBinary(b []byte) bool {
+	if len(b) > 8000 {
+		b = b[:8000]
+	}
+	return bytes.IndexByte(b, 0) >= 0
+}
+
+func unifiedDiff(path string, a, b []byte, hadOld, hasCur bool) string {
+	from, to := "a/"+path, "b/"+path
+	if !hadOld {
+		from = "/dev/null"
+	}
+	if !hasCur {
+		to = "/dev/null"
+	}
+	out, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(a)),
+		B:        difflib.SplitLines(string(b)),
+		FromFile: from,
+		ToFile:   to,
+		Context:  3,
+	})
+	if err != nil {
+		return ""
+	}
+	return out
+}
@@ -0,0 +1,26 @@
+package snapshot
+
+import (
+	"time"
+
+	"github.com/menezmethod/openclaw-cursor/internal/config"
+)
+
+// OptionsFromConfig returns the capture limits configured under change_report.
+func OptionsFromConfig(cfg *config.Config) Options {
+	return Options{
+		MaxFiles:      cfg.ChangeReport.MaxFiles,
+		MaxFileBytes:  cfg.ChangeReport.MaxFileBytes,
+		MaxTotalBytes: cfg.ChangeReport.MaxTotalBytes,
+	}
+}
+
+// OpenConfigured opens the archive described by cfg.Snapshots, capturing
+// with opts.
+func OpenConfigured(cfg *config.Config, opts Options) (*Archive, error) {
+	return OpenArchive(cfg.Snapshots.Dir, opts, Retention{
+		MaxSnapshots:  cfg.Snapshots.MaxSnapshots,
+		MaxAge:        time.Duration(cfg.Snapshots.MaxAgeHours) * time.Hour,
+		MaxStoreBytes: cfg.Snapshots.MaxStoreBytes,
+	})
+}
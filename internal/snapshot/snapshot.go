@@ -0,0 +1,205 @@
+package snapshot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/menezmethod/openclaw-cursor/internal/workspace"
+)
+
+// Options caps how much of a workspace is captured.
+type Options struct {
+	MaxFiles      int
+	MaxFileBytes  int64
+	MaxTotalBytes int64
+	// SkipDirs are canonical directories left out of every capture, such as
+	// the snapshot archive and isolation copies when they live inside the
+	// workspace.
+	SkipDirs []string
+}
+
+// DefaultOptions are used for zero fields.
+var DefaultOptions = Options{
+	MaxFiles:      5000,
+	MaxFileBytes:  1 << 20,
+	MaxTotalBytes: 64 << 20,
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxFiles <= 0 {
+		o.MaxFiles = DefaultOptions.MaxFiles
+	}
+	if o.MaxFileBytes <= 0 {
+		o.MaxFileBytes = DefaultOptions.MaxFileBytes
+	}
+	if o.MaxTotalBytes <= 0 {
+		o.MaxTotalBytes = DefaultOptions.MaxTotalBytes
+	}
+	return o
+}
+
+// File is the captured state of one file.
+type File struct {
+	Size    int64       `json:"size"`
+	Mode    fs.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mod_time"`
+	Hash    string      `json:"hash"`
+	// Large files are tracked by size and mtime only; their content isn't kept.
+	Large bool `json:"large,omitempty"`
+}
+
+// Snapshot is the state of a workspace at one point in time. File contents
+// live in the Store, addressed by hash.
+type Snapshot struct {
+	Root  string          `json:"root"`
+	Taken time.Time       `json:"taken"`
+	Git   bool            `json:"git"`
+	Files map[string]File `json:"files"`
+	// Truncated means the workspace exceeded the caps and the file set is partial.
+	Truncated bool  `json:"truncated,omitempty"`
+	Bytes     int64 `json:"bytes"`
+
+	store Store
+	opts  Options
+}
+
+// skipDirs are never descended into when walking a non-git workspace.
+// In git work trees the proxy's scratch directory ignores itself.
+var skipDirs = map[string]bool{".git": true, "node_modules": true, workspace.ScratchDir: true}
+
+// Take captures root. In git work trees only tracked and untracked,
+// non-ignored files are considered; elsewhere the tree is walked.
+func Take(root string, store Store, opts Options) (*Snapshot, error) {
+	return take(root, store, opts.withDefaults(), nil)
+}
+
+// Rescan captures the workspace again, reusing hashes of files whose size and
+// mtime are unchanged.
+func (s *Snapshot) Rescan() (*Snapshot, error) {
+	return take(s.Root, s.store, s.opts, s)
+}
+
+// Store returns the content store backing the snapshot.
+func (s *Snapshot) Store() Store {
+	return s.store
+}
+
+func take(root string, store Store, opts Options, prev *Snapshot) (*Snapshot, error) {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	snap := &Snapshot{Root: root, Taken: time.Now().UTC(), Files: make(map[string]File), store: store, opts: opts}
+	paths, git, truncated, err := listFiles(root, opts.MaxFiles, opts.SkipDirs)
+	if err != nil {
+		return nil, err
+	}
+	snap.Git = git
+	snap.Truncated = truncated
+	for _, rel := range paths {
+		abs := filepath.Join(root, rel)
+		info, err := os.Lstat(abs)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		f := File{Size: info.Size(), Mode: info.Mode().Perm(), ModTime: info.ModTime().UTC()}
+		if prev != nil {
+			if old, ok := prev.Files[rel]; ok && old.Size == f.Size && old.ModTime.Equal(f.ModTime) && old.Mode == f.Mode {
+				snap.Files[rel] = old
+				if !old.Large {
+					snap.Bytes += old.Size
+				}
+				continue
+			}
+		}
+		if f.Size > opts.MaxFileBytes {
+			f.Large = true
+			f.Hash = fmt.Sprintf("large:%d:%d", f.Size, f.ModTime.UnixNano())
+			snap.Files[rel] = f
+			continue
+		}
+		if snap.Bytes+f.Size > opts.MaxTotalBytes {
+			snap.Truncated = true
+			break
+		}
+		data, err := os.ReadFile(abs)
+		if err != nil {
+			continue
+		}
+		f.Hash = hashBytes(data)
+		if err := store.Put(f.Hash, data); err != nil {
+			return nil, fmt.Errorf("store %s: %w", rel, err)
+		}
+		snap.Bytes += f.Size
+		snap.Files[rel] = f
+	}
+	return snap, nil
+}
+
+func hashBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// skipped reports whether p lies in one of the skip directories.
+func skipped(p string, skip []string) bool {
+	for _, dir := range skip {
+		if workspace.Within(p, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// listFiles returns workspace-relative paths to capture.
+func listFiles(root string, maxFiles int, skip []string) (paths []string, git, truncated bool, err error) {
+	cmd := exec.Command("git", "-C", root, "ls-files", "-z", "--cached", "--others", "--exclude-standard")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if cmd.Run() == nil {
+		seen := make(map[string]bool)
+		for _, p := range strings.Split(stdout.String(), "\x00") {
+			if p == "" || seen[p] || skipped(filepath.Join(root, filepath.FromSlash(p)), skip) {
+				continue
+			}
+			if len(paths) >= maxFiles {
+				return paths, true, true, nil
+			}
+			seen[p] = true
+			paths = append(paths, filepath.FromSlash(p))
+		}
+		return paths, true, false, nil
+	}
+
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if p != root && (skipDirs[d.Name()] || skipped(p, skip)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(paths) >= maxFiles {
+			truncated = true
+			return filepath.SkipAll
+		}
+		rel, err := filepath.Rel(root, p)
+		if err == nil {
+			paths = append(paths, rel)
+		}
+		return nil
+	})
+	return paths, false, truncated, err
+}
@@ -0,0 +1,158 @@
+package snapshot
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func write(t *testing.T, dir, name, content string) {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+	require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	// Bump mtime so the rescan can't reuse the previous entry by accident.
+	future := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(p, future, future))
+}
+
+func TestCompare_PlainDirectory(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "keep.txt", "same\n")
+	write(t, dir, "edit.txt", "one\ntwo\nthree\n")
+	write(t, dir, "gone.txt", "bye\n")
+	write(t, dir, "node_modules/dep/index.js", "ignored\n")
+
+	before, err := Take(dir, nil, Options{})
+	require.NoError(t, err)
+	assert.False(t, before.Git)
+	assert.NotContains(t, before.Files, filepath.Join("node_modules", "dep", "index.js"))
+
+	write(t, dir, "edit.txt", "one\nTWO\nthree\n")
+	write(t, dir, "sub/new.txt", "hello\n")
+	require.NoError(t, os.Remove(filepath.Join(dir, "gone.txt")))
+
+	after, err := before.Rescan()
+	require.NoError(t, err)
+	r := Compare(before, after, 0)
+
+	assert.Equal(t, []string{filepath.Join("sub", "new.txt")}, r.Created)
+	assert.Equal(t, []string{"edit.txt"}, r.Modified)
+	assert.Equal(t, []string{"gone.txt"}, r.Deleted)
+	require.Len(t, r.Changes, 3)
+	for _, c := range r.Changes {
+		switch c.Status {
+		case Modified:
+			assert.Contains(t, c.Diff, "--- a/edit.txt")
+			assert.Contains(t, c.Diff, "-two")
+			assert.Contains(t, c.Diff, "+TWO")
+		case Created:
+			assert.Contains(t, c.Diff, "--- /dev/null")
+			assert.Contains(t, c.Diff, "+hello")
+		case Deleted:
+			assert.Contains(t, c.Diff, "+++ /dev/null")
+		}
+	}
+	assert.False(t, r.Truncated)
+}
+
+func TestCompare_GitRespectsIgnore(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	require.NoError(t, exec.Command("git", "-C", dir, "init", "-q").Run())
+	write(t, dir, ".gitignore", "build/\n")
+	write(t, dir, "main.go", "package main\n")
+
+	before, err := Take(dir, nil, Options{})
+	require.NoError(t, err)
+	assert.True(t, before.Git)
+
+	write(t, dir, "build/out.bin", "artifact")
+	write(t, dir, "main.go", "package main\n\nfunc main() {}\n")
+
+	after, err := before.Rescan()
+	require.NoError(t, err)
+	r := Compare(before, after, 0)
+	assert.Empty(t, r.Created)
+	assert.Equal(t, []string{"main.go"}, r.Modified)
+}
+
+func TestCompare_BinaryAndDiffCap(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "a.txt", "a\n")
+	write(t, dir, "b.txt", "b\n")
+	before, err := Take(dir, nil, Options{})
+	require.NoError(t, err)
+
+	write(t, dir, "a.txt", "a changed with a fairly long line of text\n")
+	write(t, dir, "b.txt", "b changed\n")
+	write(t, dir, "img.png", "\x89PNG\x00\x00data")
+	after, err := before.Rescan()
+	require.NoError(t, err)
+
+	r := Compare(before, after, 40)
+	assert.True(t, r.Truncated)
+	require.Len(t, r.Changes, 3)
+	assert.Contains(t, r.Changes[0].Diff, "diff truncated")
+	assert.Empty(t, r.Changes[1].Diff)
+	assert.True(t, r.Changes[2].Binary)
+}
+
+func TestTake_Caps(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "big.log", string(make([]byte, 2048)))
+	write(t, dir, "a.txt", "a")
+	write(t, dir, "b.txt", "b")
+
+	snap, err := Take(dir, nil, Options{MaxFileBytes: 1024})
+	require.NoError(t, err)
+	assert.True(t, snap.Files["big.log"].Large)
+	assert.False(t, snap.Truncated)
+
+	snap, err = Take(dir, nil, Options{MaxFiles: 2})
+	require.NoError(t, err)
+	assert.True(t, snap.Truncated)
+	assert.Len(t, snap.Files, 2)
+}
+
+func TestTake_SkipDirs(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	write(t, dir, "main.go", "package main\n")
+	write(t, dir, ".openclaw/cursor-snapshots/blobs/ab", "blob")
+	write(t, dir, ".openclaw/cursor-worktrees/x/main.go", "copy")
+	write(t, dir, ".openclaw/notes.md", "kept")
+	opts := Options{SkipDirs: []string{
+		filepath.Join(dir, ".openclaw", "cursor-snapshots"),
+		filepath.Join(dir, ".openclaw", "cursor-worktrees"),
+	}}
+	want := []string{"main.go", filepath.Join(".openclaw", "notes.md")}
+
+	snap, err := Take(dir, nil, opts)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, want, keys(snap.Files))
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	require.NoError(t, exec.Command("git", "-C", dir, "init", "-q").Run())
+	snap, err = Take(dir, nil, opts)
+	require.NoError(t, err)
+	assert.True(t, snap.Git)
+	assert.ElementsMatch(t, want, keys(snap.Files))
+}
+
+func keys(files map[string]File) []string {
+	out := make([]string, 0, len(files))
+	for k := range files {
+		out = append(out, k)
+	}
+	return out
+}
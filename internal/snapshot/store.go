@@ -0,0 +1,117 @@
+package snapshot
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store holds file contents addressed by their sha256.
+type Store interface {
+	Put(hash string, data []byte) error
+	Get(hash string) ([]byte, error)
+}
+
+// MemoryStore keeps contents in memory for the lifetime of a request.
+type MemoryStore struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{blobs: make(map[string][]byte)}
+}
+
+// Put stores data under hash.
+func (m *MemoryStore) Put(hash string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.blobs[hash]; !ok {
+		m.blobs[hash] = data
+	}
+	return nil
+}
+
+// Get returns the content stored under hash.
+func (m *MemoryStore) Get(hash string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.blobs[hash]
+	if !ok {
+		return nil, fmt.Errorf("blob %s not found", hash)
+	}
+	return b, nil
+}
+
+// DiskStore keeps contents as files under dir/<hash[:2]>/<hash>.
+type DiskStore struct {
+	dir string
+}
+
+// NewDiskStore creates a store rooted at dir.
+func NewDiskStore(dir string) *DiskStore {
+	return &DiskStore{dir: dir}
+}
+
+func (d *DiskStore) path(hash string) string {
+	if len(hash) < 2 {
+		return filepath.Join(d.dir, "_", hash)
+	}
+	return filepath.Join(d.dir, hash[:2], hash)
+}
+
+// blobGrace protects blobs of snapshots that have been taken but not saved
+// yet (the agent is still running) from being collected.
+const blobGrace = 6 * time.Hour
+
+// Put writes data unless a blob with that hash already exists, in which case
+// the blob's mtime is refreshed so retain doesn't collect it mid-run.
+func (d *DiskStore) Put(hash string, data []byte) error {
+	p := d.path(hash)
+	if _, err := os.Stat(p); err == nil {
+		now := time.Now()
+		os.Chtimes(p, now, now)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(p, data, 0600)
+}
+
+// Get reads the blob stored under hash.
+func (d *DiskStore) Get(hash string) ([]byte, error) {
+	b, err := os.ReadFile(d.path(hash))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("blob %s not found", hash)
+	}
+	return b, err
+}
+
+// retain deletes every blob not in keep that is older than blobGrace.
+func (d *DiskStore) retain(keep map[string]bool) error {
+	cutoff := time.Now().Add(-blobGrace)
+	return filepath.WalkDir(d.dir, func(p string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".tmp-") {
+			return nil
+		}
+		if keep[e.Name()] {
+			return nil
+		}
+		if info, err := e.Info(); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(p)
+		}
+		return nil
+	})
+}
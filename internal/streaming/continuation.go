@@ -0,0 +1,57 @@
+package streaming
+
+import "strings"
+
+// Continuation removes a repeat of the prefilled assistant text from the
+// start of a continuation. Models asked to continue a message often restate
+// it first; the client already has it. Output is held back while it still
+// matches the prefill.
+type Continuation struct {
+	prefill string
+	pending string
+	decided bool
+}
+
+// NewContinuation returns a Continuation for the given prefill, or nil when
+// there is none.
+func NewContinuation(prefill string) *Continuation {
+	prefill = strings.TrimSpace(prefill)
+	if prefill == "" {
+		return nil
+	}
+	return &Continuation{prefill: prefill}
+}
+
+// Next takes the next piece of generated text and returns what may be sent
+// now.
+func (c *Continuation) Next(delta string) string {
+	if c == nil || c.decided {
+		return delta
+	}
+	c.pending += delta
+	buf := strings.TrimLeft(c.pending, " \t\r\n")
+	switch {
+	case len(buf) < len(c.prefill) && strings.HasPrefix(c.prefill, buf):
+		// Could still be a repeat; wait for more.
+		return ""
+	case strings.HasPrefix(buf, c.prefill):
+		buf = buf[len(c.prefill):]
+	default:
+		buf = c.pending
+	}
+	c.decided = true
+	c.pending = ""
+	return buf
+}
+
+// Flush returns held-back text once generation has ended: output that
+// stopped partway through restating the prefill is sent as it is.
+func (c *Continuation) Flush() string {
+	if c == nil || c.decided {
+		return ""
+	}
+	c.decided = true
+	out := c.pending
+	c.pending = ""
+	return out
+}
@@ -0,0 +1,38 @@
+package streaming
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// resume runs deltas through c and returns everything it let out.
+func resume(c *Continuation, deltas ...string) string {
+	var out strings.Builder
+	for _, d := range deltas {
+		out.WriteString(c.Next(d))
+	}
+	out.WriteString(c.Flush())
+	return out.String()
+}
+
+func TestContinuation(t *testing.T) {
+	prefill := "The capital of France is"
+
+	c := NewContinuation(prefill)
+	assert.Equal(t, "", c.Next("The capital"), "a possible repeat is held back")
+	assert.Equal(t, " Paris.", c.Next(" of France is Paris."))
+	assert.Equal(t, " Done", c.Next(" Done"))
+
+	assert.Equal(t, " Paris.", resume(NewContinuation(prefill), "\nThe capital of France is", " Paris."))
+	assert.Equal(t, " Paris.", resume(NewContinuation(prefill), " Paris."), "no repeat")
+	assert.Equal(t, "The capital city", resume(NewContinuation(prefill), "The capital", " city"), "a false start is released")
+	assert.Equal(t, "The capital", resume(NewContinuation(prefill), "The capital"), "a partial repeat is sent at the end")
+	assert.Equal(t, "", resume(NewContinuation(prefill), prefill))
+
+	var none *Continuation
+	assert.Nil(t, NewContinuation("  "))
+	assert.Equal(t, "x", none.Next("x"))
+	assert.Equal(t, "", none.Flush())
+}
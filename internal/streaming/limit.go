@@ -0,0 +1,136 @@
+package streaming
+
+import (
+	"strings"
+
+	"github.com/menezmethod/openclaw-cursor/internal/tokens"
+)
+
+// Limiter applies stop sequences and a completion token cap to text as it
+// is generated. Text that could be the start of a stop sequence is held
+// back until the following delta shows whether it is.
+type Limiter struct {
+	stop      []string
+	maxTokens int
+	pending   string
+	used      int
+	reason    string
+}
+
+// NewLimiter returns a limiter for the given stop sequences and token cap
+// (0 for none), or nil when there is nothing to enforce.
+func NewLimiter(stop []string, maxTokens int) *Limiter {
+	var seqs []string
+	for _, s := range stop {
+		if s != "" {
+			seqs = append(seqs, s)
+		}
+	}
+	if len(seqs) == 0 && maxTokens <= 0 {
+		return nil
+	}
+	return &Limiter{stop: seqs, maxTokens: maxTokens}
+}
+
+// Next takes the next piece of generated text and returns what may be sent
+// now. Once the limiter is done it returns "".
+func (l *Limiter) Next(delta string) string {
+	if l.reason != "" {
+		return ""
+	}
+	buf := l.pending + delta
+	l.pending = ""
+	stopped := false
+	if i := l.firstStop(buf); i >= 0 {
+		buf, stopped = buf[:i], true
+	} else if h := l.holdback(buf); h > 0 {
+		buf, l.pending = buf[:len(buf)-h], buf[len(buf)-h:]
+	}
+	out := l.budget(buf)
+	if stopped && l.reason == "" {
+		l.reason = "stop"
+		l.pending = ""
+	}
+	return out
+}
+
+// Flush returns held-back text once generation has ended.
+func (l *Limiter) Flush() string {
+	if l.reason != "" {
+		return ""
+	}
+	out := l.budget(l.pending)
+	l.pending = ""
+	return out
+}
+
+// Done reports whether a stop sequence or the token cap ended the output;
+// the agent can be stopped.
+func (l *Limiter) Done() bool {
+	return l != nil && l.reason != ""
+}
+
+// Reason is the finish_reason the limiter imposed: "stop" for a stop
+// sequence, "length" for the token cap, or "" if neither was hit.
+func (l *Limiter) Reason() string {
+	if l == nil {
+		return ""
+	}
+	return l.reason
+}
+
+func (l *Limiter) firstStop(s string) int {
+	first := -1
+	for _, seq := range l.stop {
+		if i := strings.Index(s, seq); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	return first
+}
+
+// holdback is the length of the longest suffix of s that is a proper prefix
+// of a stop sequence.
+func (l *Limiter) holdback(s string) int {
+	best := 0
+	for _, seq := range l.stop {
+		for k := min(len(seq)-1, len(s)); k > best; k-- {
+			if strings.HasSuffix(s, seq[:k]) {
+				best = k
+				break
+			}
+		}
+	}
+	return best
+}
+
+// budget trims s to the tokens left under the cap and records its use.
+func (l *Limiter) budget(s string) string {
+	if l.maxTokens <= 0 || s == "" {
+		return s
+	}
+	n := tokens.Estimate(s)
+	if l.used+n <= l.maxTokens {
+		l.used += n
+		return s
+	}
+	// Longest prefix, cut at a rune boundary, that still fits.
+	cuts := make([]int, 0, len(s)+1)
+	for i := range s {
+		cuts = append(cuts, i)
+	}
+	cuts = append(cuts, len(s))
+	lo, hi := 0, len(cuts)-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if l.used+tokens.Estimate(s[:cuts[mid]]) <= l.maxTokens {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	l.used = l.maxTokens
+	l.reason = "length"
+	l.pending = ""
+	return s[:cuts[lo]]
+}
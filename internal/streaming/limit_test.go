@@ -0,0 +1,76 @@
+package streaming
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/menezmethod/openclaw-cursor/internal/tokens"
+	"github.com/stretchr/testify/assert"
+)
+
+// feed runs deltas through l and returns everything it let out.
+func feed(l *Limiter, deltas ...string) string {
+	var out strings.Builder
+	for _, d := range deltas {
+		out.WriteString(l.Next(d))
+		if l.Done() {
+			return out.String()
+		}
+	}
+	out.WriteString(l.Flush())
+	return out.String()
+}
+
+func TestLimiter_StopAcrossChunks(t *testing.T) {
+	l := NewLimiter([]string{"", "\nEND", "###"}, 0)
+	assert.Equal(t, "Hello", l.Next("Hello\nE"), "the possible start of a stop is held back")
+	assert.Equal(t, "", l.Next("N"))
+	assert.Equal(t, "", l.Next("D and more"))
+	assert.True(t, l.Done())
+	assert.Equal(t, "stop", l.Reason())
+	assert.Equal(t, "", l.Next("ignored"))
+	assert.Equal(t, "", l.Flush())
+
+	// A false start is released with the next delta.
+	l = NewLimiter([]string{"\nEND"}, 0)
+	assert.Equal(t, "a\nEN", feed(l, "a\n", "EN"))
+	assert.Equal(t, "", l.Reason())
+
+	// The earliest stop wins.
+	l = NewLimiter([]string{"cd", "b"}, 0)
+	assert.Equal(t, "a", feed(l, "abcd"))
+}
+
+func TestLimiter_MaxTokens(t *testing.T) {
+	l := NewLimiter(nil, 5)
+	out := feed(l, "one two ", "three four five six seven")
+	assert.Equal(t, "length", l.Reason())
+	// Counted per delta, so the total may come in slightly under the cap.
+	assert.LessOrEqual(t, tokens.Estimate(out), 5)
+	assert.Equal(t, "one two three four", out)
+
+	l = NewLimiter(nil, 50)
+	assert.Equal(t, "short reply", feed(l, "short ", "reply"))
+	assert.Equal(t, "", l.Reason())
+
+	assert.Nil(t, NewLimiter([]string{""}, 0))
+	var none *Limiter
+	assert.False(t, none.Done())
+}
+
+func TestConverter_Limit(t *testing.T) {
+	c := NewConverter("auto")
+	c.Limit = NewLimiter([]string{"STOP"}, 0)
+	var out strings.Builder
+	for _, text := range []string{"Hi ST", "Hi STOP there"} {
+		chunk, err := c.ToSSEChunk(&StreamEvent{Type: "assistant", Message: &StreamMessage{Content: []StreamContent{{Type: "text", Text: text}}}})
+		assert.NoError(t, err)
+		out.Write(chunk)
+	}
+	out.Write(c.Flush())
+	assert.Equal(t, 1, strings.Count(out.String(), `"content"`))
+	assert.Contains(t, out.String(), `"content":"Hi "`)
+	assert.Equal(t, "stop", c.FinishReason())
+	text, _ := c.Output()
+	assert.Equal(t, "Hi ", text)
+}
@@ -26,7 +26,11 @@ func (s *Scanner) Scan() bool {
 // Event parses the current line as a StreamEvent.
 // Returns nil for empty lines or malformed JSON (caller should skip).
 func (s *Scanner) Event() (*StreamEvent, error) {
-	line := s.scanner.Bytes()
+	return ParseEvent(s.scanner.Bytes())
+}
+
+// ParseEvent parses one line of cursor-agent output, like Scanner.Event.
+func ParseEvent(line []byte) (*StreamEvent, error) {
 	if len(line) == 0 {
 		return nil, nil
 	}
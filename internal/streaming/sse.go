@@ -43,6 +43,20 @@ type Converter struct {
 	Created int64
 	Model   string
 	tracker DeltaTracker
+	// Index is the choice the chunks belong to, for n > 1.
+	Index int
+	// DropToolCalls suppresses tool_call deltas (used once the loop guard trips).
+	DropToolCalls bool
+	// DropReasoning suppresses reasoning_content deltas.
+	DropReasoning bool
+	// Continue, if set, drops a restated prefill from the start of content.
+	Continue *Continuation
+	// Limit, if set, applies stop sequences and max_tokens to content.
+	Limit *Limiter
+	// sawToolCall records that a tool_call delta went out.
+	sawToolCall bool
+	// Everything generated so far, for usage estimates.
+	text, reasoning strings.Builder
 }
 
 // NewConverter creates a new SSE converter.
@@ -57,7 +71,7 @@ func NewConverter(model string) *Converter {
 // ToSSEChunk converts a stream event to an OpenAI SSE chunk bytes.
 // Returns nil if the event should not produce a chunk.
 func (c *Converter) ToSSEChunk(event *StreamEvent) ([]byte, error) {
-	if event == nil {
+	if event == nil || c.Limit.Done() {
 		return nil, nil
 	}
 
@@ -65,33 +79,45 @@ func (c *Converter) ToSSEChunk(event *StreamEvent) ([]byte, error) {
 
 	if event.IsAssistantText() {
 		text := event.ExtractText()
-		d := c.tracker.NextText(text)
+		d := c.Continue.Next(c.tracker.NextText(text))
+		if c.Limit != nil {
+			d = c.Limit.Next(d)
+		}
 		if d == "" {
 			return nil, nil
 		}
 		delta.Content = d
+		c.text.WriteString(d)
 	}
 
 	if event.IsThinking() {
 		thinking := event.ExtractThinking()
 		d := c.tracker.NextThinking(thinking)
-		if d == "" {
+		c.reasoning.WriteString(d)
+		if d == "" || c.DropReasoning {
 			return nil, nil
 		}
 		delta.ReasoningContent = d
 	}
 
-	if event.IsToolCall() {
+	if event.IsToolCall() && !c.DropToolCalls {
 		tc := c.toolCallDelta(event)
 		if tc != nil {
+			c.sawToolCall = true
 			delta.ToolCalls = []OpenAIToolCall{*tc}
+			c.text.WriteString(tc.Function.Name + tc.Function.Arguments)
 		}
 	}
 
 	if delta.Content == "" && delta.ReasoningContent == "" && len(delta.ToolCalls) == 0 {
 		return nil, nil
 	}
+	return c.Chunk(delta)
+}
 
+// Chunk renders a delta as an SSE chunk, for output the proxy assembles
+// itself rather than converting from events.
+func (c *Converter) Chunk(delta OpenAIDelta) ([]byte, error) {
 	chunk := OpenAIChunk{
 		ID:      c.ID,
 		Object:  "chat.completion.chunk",
@@ -102,7 +128,7 @@ func (c *Converter) ToSSEChunk(event *StreamEvent) ([]byte, error) {
 			Delta        OpenAIDelta `json:"delta"`
 			FinishReason interface{} `json:"finish_reason"`
 		}{
-			{Index: 0, Delta: delta, FinishReason: nil},
+			{Index: c.Index, Delta: delta, FinishReason: nil},
 		},
 	}
 	b, err := json.Marshal(chunk)
@@ -174,6 +200,58 @@ func inferToolName(event *StreamEvent) string {
 	return ""
 }
 
+// Output returns the text (including tool call arguments) and reasoning the
+// converter has seen, for usage estimates.
+func (c *Converter) Output() (text, reasoning string) {
+	return c.text.String(), c.reasoning.String()
+}
+
+// Flush returns a chunk with content the continuation or the limiter held
+// back, or nil.
+func (c *Converter) Flush() []byte {
+	d := c.Continue.Flush()
+	if c.Limit != nil {
+		d = c.Limit.Next(d) + c.Limit.Flush()
+	}
+	if d == "" {
+		return nil
+	}
+	c.text.WriteString(d)
+	b, _ := c.Chunk(OpenAIDelta{Content: d})
+	return b
+}
+
+// FinishReason is "stop" or "length" when the limiter ended the output,
+// "tool_calls" when tool calls were sent, and "stop" otherwise.
+func (c *Converter) FinishReason() string {
+	if r := c.Limit.Reason(); r != "" {
+		return r
+	}
+	if c.sawToolCall {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// Finish returns a chunk with an empty delta carrying the finish reason.
+func (c *Converter) Finish(reason string) []byte {
+	chunk := OpenAIChunk{
+		ID:      c.ID,
+		Object:  "chat.completion.chunk",
+		Created: c.Created,
+		Model:   c.Model,
+		Choices: []struct {
+			Index        int         `json:"index"`
+			Delta        OpenAIDelta `json:"delta"`
+			FinishReason interface{} `json:"finish_reason"`
+		}{
+			{Index: c.Index, FinishReason: reason},
+		},
+	}
+	b, _ := json.Marshal(chunk)
+	return []byte("data: " + string(b) + "\n\n")
+}
+
 // Done returns the SSE [DONE] chunk.
 func (c *Converter) Done() []byte {
 	return []byte("data: [DONE]\n\n")
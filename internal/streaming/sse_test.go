@@ -1,6 +1,7 @@
 package streaming
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 
@@ -37,3 +38,57 @@ func TestConverter_Done(t *testing.T) {
 	done := c.Done()
 	assert.Equal(t, "data: [DONE]\n\n", string(done))
 }
+
+func TestConverter_DropReasoning(t *testing.T) {
+	e := &StreamEvent{Type: "thinking", Text: "hmm"}
+	c := NewConverter("opus-4.6-thinking")
+	chunk, err := c.ToSSEChunk(e)
+	require.NoError(t, err)
+	assert.Contains(t, string(chunk), `"reasoning_content":"hmm"`)
+
+	c = NewConverter("opus-4.6-thinking")
+	c.DropReasoning = true
+	chunk, err = c.ToSSEChunk(e)
+	require.NoError(t, err)
+	assert.Nil(t, chunk)
+}
+
+func TestReportedUsage(t *testing.T) {
+	var e StreamEvent
+	require.NoError(t, json.Unmarshal([]byte(`{"type":"result","subtype":"success","usage":{"inputTokens":100,"outputTokens":20,"cacheReadTokens":50,"reasoningTokens":5}}`), &e))
+	u := e.ReportedUsage()
+	require.NotNil(t, u)
+	assert.Equal(t, 150, u.PromptTokens)
+	assert.Equal(t, 20, u.CompletionTokens)
+	assert.Equal(t, 170, u.TotalTokens)
+	assert.Equal(t, 50, u.PromptTokensDetails.CachedTokens)
+	assert.Equal(t, 5, u.CompletionTokensDetails.ReasoningTokens)
+	assert.False(t, u.Estimated)
+
+	var e2 StreamEvent
+	require.NoError(t, json.Unmarshal([]byte(`{"type":"result","usage":{"input_tokens":7,"output_tokens":3}}`), &e2))
+	assert.Equal(t, 10, e2.ReportedUsage().TotalTokens)
+
+	assert.Nil(t, (&StreamEvent{Type: "result"}).ReportedUsage())
+}
+
+func TestConverter_UsageChunk(t *testing.T) {
+	c := NewConverter("auto")
+	c.ToSSEChunk(&StreamEvent{Type: "assistant", Message: &StreamMessage{Content: []StreamContent{{Type: "text", Text: "Hello world"}}}})
+	c.DropReasoning = true
+	c.ToSSEChunk(&StreamEvent{Type: "thinking", Text: "hmm"})
+	text, reasoning := c.Output()
+	assert.Equal(t, "Hello world", text)
+	assert.Equal(t, "hmm", reasoning, "dropped reasoning still counts")
+
+	u := EstimateUsage("USER: hi there", text, reasoning)
+	assert.True(t, u.Estimated)
+	assert.Equal(t, 3, u.CompletionTokens)
+	assert.Equal(t, 1, u.CompletionTokensDetails.ReasoningTokens)
+	assert.Equal(t, u.PromptTokens+u.CompletionTokens, u.TotalTokens)
+
+	chunk := string(c.UsageChunk(u))
+	assert.True(t, strings.HasPrefix(chunk, "data: "))
+	assert.Contains(t, chunk, `"choices":[]`)
+	assert.Contains(t, chunk, `"completion_tokens":3`)
+}
@@ -11,6 +11,8 @@ type StreamEvent struct {
 	Message *StreamMessage  `json:"message,omitempty"`
 	ToolCall *StreamToolCall `json:"tool_call,omitempty"`
 	CallID  string          `json:"call_id,omitempty"`
+	// Usage is set on result events by cursor-agent versions that report it.
+	Usage map[string]json.RawMessage `json:"usage,omitempty"`
 }
 
 // StreamMessage is the message content in assistant events.
@@ -0,0 +1,123 @@
+package streaming
+
+import (
+	"encoding/json"
+
+	"github.com/menezmethod/openclaw-cursor/internal/tokens"
+)
+
+// Usage is the OpenAI usage object.
+type Usage struct {
+	PromptTokens            int                      `json:"prompt_tokens"`
+	CompletionTokens        int                      `json:"completion_tokens"`
+	TotalTokens             int                      `json:"total_tokens"`
+	PromptTokensDetails     *PromptTokensDetails     `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+	// Estimated is set when the counts come from the local tokenizer because
+	// cursor-agent didn't report usage.
+	Estimated bool `json:"openclaw_estimated,omitempty"`
+}
+
+// PromptTokensDetails breaks down prompt tokens.
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+// CompletionTokensDetails breaks down completion tokens.
+type CompletionTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// usageKeys lists the spellings cursor-agent versions use for each count.
+var usageKeys = struct {
+	input, output, reasoning, cacheRead, cacheWrite []string
+}{
+	input:      []string{"input_tokens", "inputTokens", "prompt_tokens"},
+	output:     []string{"output_tokens", "outputTokens", "completion_tokens"},
+	reasoning:  []string{"reasoning_tokens", "reasoningTokens"},
+	cacheRead:  []string{"cache_read_input_tokens", "cacheReadTokens", "cache_read_tokens"},
+	cacheWrite: []string{"cache_creation_input_tokens", "cacheWriteTokens", "cache_write_tokens"},
+}
+
+// ReportedUsage returns the usage cursor-agent put on a result event, or nil.
+func (e *StreamEvent) ReportedUsage() *Usage {
+	if !e.IsResult() || len(e.Usage) == 0 {
+		return nil
+	}
+	get := func(keys []string) (int, bool) {
+		for _, k := range keys {
+			var n int
+			if raw, ok := e.Usage[k]; ok && json.Unmarshal(raw, &n) == nil {
+				return n, true
+			}
+		}
+		return 0, false
+	}
+	in, okIn := get(usageKeys.input)
+	out, okOut := get(usageKeys.output)
+	if !okIn && !okOut {
+		return nil
+	}
+	cached, _ := get(usageKeys.cacheRead)
+	written, _ := get(usageKeys.cacheWrite)
+	reasoning, _ := get(usageKeys.reasoning)
+	u := &Usage{PromptTokens: in + cached + written, CompletionTokens: out}
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	if cached > 0 {
+		u.PromptTokensDetails = &PromptTokensDetails{CachedTokens: cached}
+	}
+	u.CompletionTokensDetails = &CompletionTokensDetails{ReasoningTokens: reasoning}
+	return u
+}
+
+// EstimateUsage counts tokens in the rendered prompt and the output locally.
+// Reasoning counts towards completion tokens, as with OpenAI models.
+func EstimateUsage(prompt, completion, reasoning string) *Usage {
+	r := tokens.Estimate(reasoning)
+	u := &Usage{
+		PromptTokens:            tokens.Estimate(prompt),
+		CompletionTokens:        tokens.Estimate(completion) + r,
+		CompletionTokensDetails: &CompletionTokensDetails{ReasoningTokens: r},
+		Estimated:               true,
+	}
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	return u
+}
+
+// UsageChunk returns the final chunk sent when stream_options.include_usage
+// is set: no choices, just usage.
+func (c *Converter) UsageChunk(u *Usage) []byte {
+	chunk := struct {
+		ID      string   `json:"id"`
+		Object  string   `json:"object"`
+		Created int64    `json:"created"`
+		Model   string   `json:"model"`
+		Choices []string `json:"choices"`
+		Usage   *Usage   `json:"usage"`
+	}{c.ID, "chat.completion.chunk", c.Created, c.Model, []string{}, u}
+	b, _ := json.Marshal(chunk)
+	return []byte("data: " + string(b) + "\n\n")
+}
+
+// Add folds o into u, for requests that took several cursor-agent runs.
+func (u *Usage) Add(o *Usage) {
+	if o == nil {
+		return
+	}
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.TotalTokens += o.TotalTokens
+	if o.PromptTokensDetails != nil {
+		if u.PromptTokensDetails == nil {
+			u.PromptTokensDetails = &PromptTokensDetails{}
+		}
+		u.PromptTokensDetails.CachedTokens += o.PromptTokensDetails.CachedTokens
+	}
+	if o.CompletionTokensDetails != nil {
+		if u.CompletionTokensDetails == nil {
+			u.CompletionTokensDetails = &CompletionTokensDetails{}
+		}
+		u.CompletionTokensDetails.ReasoningTokens += o.CompletionTokensDetails.ReasoningTokens
+	}
+	u.Estimated = u.Estimated || o.Estimated
+}
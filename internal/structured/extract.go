@@ -0,0 +1,57 @@
+package structured
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// maxCandidates and maxDecodes bound the search for embedded JSON in long
+// replies. Each decode may read to the end of the reply, so without a cap a
+// reply full of unclosed brackets would take quadratic time.
+const (
+	maxCandidates = 20
+	maxDecodes    = 64
+)
+
+var fence = regexp.MustCompile("(?s)```[a-zA-Z0-9_-]*[ \t]*\r?\n(.*?)```")
+
+// Candidates returns the JSON values in a model reply, most likely first:
+// the whole reply, the contents of Markdown code fences, then objects and
+// arrays embedded in surrounding prose (up to maxDecodes attempts).
+func Candidates(reply string) []json.RawMessage {
+	var out []json.RawMessage
+	seen := make(map[string]bool)
+	add := func(raw []byte) {
+		var buf bytes.Buffer
+		if json.Compact(&buf, raw) != nil || seen[buf.String()] {
+			return
+		}
+		seen[buf.String()] = true
+		out = append(out, buf.Bytes())
+	}
+
+	if s := strings.TrimSpace(reply); json.Valid([]byte(s)) {
+		add([]byte(s))
+	}
+	for _, m := range fence.FindAllStringSubmatch(reply, -1) {
+		if s := strings.TrimSpace(m[1]); json.Valid([]byte(s)) {
+			add([]byte(s))
+		}
+	}
+	decodes := 0
+	for i := 0; i < len(reply) && len(out) < maxCandidates && decodes < maxDecodes; i++ {
+		if reply[i] != '{' && reply[i] != '[' {
+			continue
+		}
+		decodes++
+		dec := json.NewDecoder(strings.NewReader(reply[i:]))
+		var raw json.RawMessage
+		if dec.Decode(&raw) == nil {
+			add(raw)
+			i += int(dec.InputOffset()) - 1
+		}
+	}
+	return out
+}
@@ -0,0 +1,373 @@
+// Package structured implements response_format for cursor-agent output:
+// pulling the JSON value out of a model reply and validating it against the
+// subset of JSON Schema that OpenAI structured outputs accept.
+package structured
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxProblems caps how many validation problems are reported, so a retry
+// prompt stays short.
+const maxProblems = 10
+
+// Schema is a compiled JSON Schema.
+type Schema struct {
+	root     any
+	patterns map[string]*regexp.Regexp
+}
+
+// ValidationError lists where a value departs from the schema.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// Compile parses a JSON Schema. It checks that $refs resolve and patterns
+// compile, so a broken schema is reported before the model runs.
+func Compile(raw json.RawMessage) (*Schema, error) {
+	var root any
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return nil, fmt.Errorf("schema is not valid JSON: %w", err)
+	}
+	switch root.(type) {
+	case map[string]any, bool:
+	default:
+		return nil, fmt.Errorf("schema must be an object")
+	}
+	s := &Schema{root: root, patterns: make(map[string]*regexp.Regexp)}
+	if err := s.check(root, "#"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Schema) check(node any, path string) error {
+	m, ok := node.(map[string]any)
+	if !ok {
+		return nil
+	}
+	if ref, ok := m["$ref"].(string); ok {
+		if _, err := s.resolve(ref); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if p, ok := m["pattern"].(string); ok {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern: %w", path, err)
+		}
+		s.patterns[p] = re
+	}
+	for k, v := range m {
+		switch k {
+		case "enum", "const", "required", "examples", "default":
+			continue
+		}
+		switch v := v.(type) {
+		case map[string]any:
+			if err := s.check(v, path+"/"+k); err != nil {
+				return err
+			}
+		case []any:
+			for i, item := range v {
+				if err := s.check(item, fmt.Sprintf("%s/%s/%d", path, k, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// resolve follows a local reference such as "#/$defs/step".
+func (s *Schema) resolve(ref string) (any, error) {
+	if ref == "#" {
+		return s.root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("only local $refs are supported: %q", ref)
+	}
+	node := s.root
+	for _, part := range strings.Split(ref[2:], "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		if node, ok = m[part]; !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+	}
+	return node, nil
+}
+
+// Validate checks a decoded JSON value (as produced by json.Unmarshal into
+// any) and returns a *ValidationError describing the mismatches.
+func (s *Schema) Validate(v any) error {
+	var problems []string
+	s.validate(s.root, v, "$", &problems, 0)
+	if len(problems) == 0 {
+		return nil
+	}
+	if len(problems) > maxProblems {
+		problems = append(problems[:maxProblems], fmt.Sprintf("and %d more", len(problems)-maxProblems))
+	}
+	return &ValidationError{Problems: problems}
+}
+
+// matches reports whether v validates against node, without collecting
+// problems (for anyOf/oneOf/not).
+func (s *Schema) matches(node, v any, depth int) bool {
+	var problems []string
+	s.validate(node, v, "$", &problems, depth)
+	return len(problems) == 0
+}
+
+func (s *Schema) validate(node, v any, path string, problems *[]string, depth int) {
+	fail := func(format string, args ...any) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+	if depth > 64 {
+		fail("schema nesting too deep")
+		return
+	}
+	switch n := node.(type) {
+	case bool:
+		if !n {
+			fail("not allowed")
+		}
+		return
+	case map[string]any:
+		node = n
+	default:
+		return
+	}
+	m := node.(map[string]any)
+
+	if ref, ok := m["$ref"].(string); ok {
+		if target, err := s.resolve(ref); err == nil {
+			s.validate(target, v, path, problems, depth+1)
+		}
+	}
+	if t, ok := m["type"]; ok && !typeMatches(t, v) {
+		fail("expected %s, got %s", typeNames(t), typeOf(v))
+		return
+	}
+	if enum, ok := m["enum"].([]any); ok && !containsValue(enum, v) {
+		fail("must be one of %s", compact(enum))
+	}
+	if c, ok := m["const"]; ok && !equal(c, v) {
+		fail("must be %s", compact(c))
+	}
+	for _, sub := range list(m["allOf"]) {
+		s.validate(sub, v, path, problems, depth+1)
+	}
+	if subs := list(m["anyOf"]); len(subs) > 0 {
+		ok := false
+		for _, sub := range subs {
+			if s.matches(sub, v, depth+1) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			fail("does not match any of the allowed schemas")
+		}
+	}
+	if subs := list(m["oneOf"]); len(subs) > 0 {
+		n := 0
+		for _, sub := range subs {
+			if s.matches(sub, v, depth+1) {
+				n++
+			}
+		}
+		if n != 1 {
+			fail("must match exactly one of the allowed schemas (matched %d)", n)
+		}
+	}
+	if not, ok := m["not"]; ok && s.matches(not, v, depth+1) {
+		fail("matches a schema it must not match")
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		s.validateObject(m, v, path, problems, depth)
+	case []any:
+		if items, ok := m["items"]; ok {
+			for i, item := range v {
+				s.validate(items, item, fmt.Sprintf("%s[%d]", path, i), problems, depth+1)
+			}
+		}
+		if n, ok := number(m["minItems"]); ok && float64(len(v)) < n {
+			fail("must have at least %v items", n)
+		}
+		if n, ok := number(m["maxItems"]); ok && float64(len(v)) > n {
+			fail("must have at most %v items", n)
+		}
+	case string:
+		l := float64(utf8.RuneCountInString(v))
+		if n, ok := number(m["minLength"]); ok && l < n {
+			fail("must be at least %v characters", n)
+		}
+		if n, ok := number(m["maxLength"]); ok && l > n {
+			fail("must be at most %v characters", n)
+		}
+		if p, ok := m["pattern"].(string); ok {
+			if re := s.patterns[p]; re != nil && !re.MatchString(v) {
+				fail("must match pattern %q", p)
+			}
+		}
+	case float64:
+		if n, ok := number(m["minimum"]); ok && v < n {
+			fail("must be >= %v", n)
+		}
+		if n, ok := number(m["maximum"]); ok && v > n {
+			fail("must be <= %v", n)
+		}
+		if n, ok := number(m["exclusiveMinimum"]); ok && v <= n {
+			fail("must be > %v", n)
+		}
+		if n, ok := number(m["exclusiveMaximum"]); ok && v >= n {
+			fail("must be < %v", n)
+		}
+		if n, ok := number(m["multipleOf"]); ok && n > 0 {
+			if q := v / n; math.Abs(q-math.Round(q)) > 1e-9 {
+				fail("must be a multiple of %v", n)
+			}
+		}
+	}
+}
+
+func (s *Schema) validateObject(m map[string]any, v map[string]any, path string, problems *[]string, depth int) {
+	props, _ := m["properties"].(map[string]any)
+	for _, r := range list(m["required"]) {
+		if name, ok := r.(string); ok {
+			if _, present := v[name]; !present {
+				*problems = append(*problems, fmt.Sprintf("%s: missing required property %q", path, name))
+			}
+		}
+	}
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		child := path + "." + k
+		if sub, ok := props[k]; ok {
+			s.validate(sub, v[k], child, problems, depth+1)
+			continue
+		}
+		switch extra := m["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				*problems = append(*problems, fmt.Sprintf("%s: property %q is not allowed", path, k))
+			}
+		case map[string]any:
+			s.validate(extra, v[k], child, problems, depth+1)
+		}
+	}
+	if n, ok := number(m["minProperties"]); ok && float64(len(v)) < n {
+		*problems = append(*problems, fmt.Sprintf("%s: must have at least %v properties", path, n))
+	}
+	if n, ok := number(m["maxProperties"]); ok && float64(len(v)) > n {
+		*problems = append(*problems, fmt.Sprintf("%s: must have at most %v properties", path, n))
+	}
+}
+
+func typeMatches(t, v any) bool {
+	switch t := t.(type) {
+	case string:
+		return isType(t, v)
+	case []any:
+		for _, x := range t {
+			if name, ok := x.(string); ok && isType(name, v) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func isType(name string, v any) bool {
+	switch name {
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	default:
+		return typeOf(v) == name
+	}
+}
+
+func typeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func typeNames(t any) string {
+	if l, ok := t.([]any); ok {
+		var names []string
+		for _, x := range l {
+			names = append(names, fmt.Sprint(x))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func list(v any) []any {
+	l, _ := v.([]any)
+	return l
+}
+
+func number(v any) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
+
+func containsValue(l []any, v any) bool {
+	for _, x := range l {
+		if equal(x, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func equal(a, b any) bool {
+	return compact(a) == compact(b)
+}
+
+// compact renders v as JSON; maps marshal with sorted keys, so equal values
+// render identically.
+func compact(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
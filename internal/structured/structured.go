@@ -0,0 +1,68 @@
+package structured
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNoJSON means the reply contained no JSON value at all.
+var ErrNoJSON = errors.New("the reply contains no JSON value")
+
+// Format is a compiled response_format.
+type Format struct {
+	// Schema is nil for json_object, which accepts any object.
+	Schema *Schema
+}
+
+// New compiles a response_format of type json_object or json_schema.
+func New(kind string, schema json.RawMessage) (*Format, error) {
+	switch kind {
+	case "json_object":
+		return &Format{}, nil
+	case "json_schema":
+		if len(schema) == 0 {
+			return nil, fmt.Errorf("response_format.json_schema.schema is required")
+		}
+		s, err := Compile(schema)
+		if err != nil {
+			return nil, fmt.Errorf("response_format.json_schema.schema: %w", err)
+		}
+		return &Format{Schema: s}, nil
+	}
+	return nil, fmt.Errorf("unsupported response_format type %q", kind)
+}
+
+// Check returns the first JSON value in reply that satisfies the format, in
+// compact form. Otherwise the error describes what is wrong with the most
+// likely candidate.
+func (f *Format) Check(reply string) (json.RawMessage, error) {
+	var first error
+	for _, raw := range Candidates(reply) {
+		var v any
+		if err := json.Unmarshal(raw, &v); err != nil {
+			continue
+		}
+		err := f.validate(v)
+		if err == nil {
+			return raw, nil
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	if first == nil {
+		return nil, ErrNoJSON
+	}
+	return nil, first
+}
+
+func (f *Format) validate(v any) error {
+	if f.Schema != nil {
+		return f.Schema.Validate(v)
+	}
+	if _, ok := v.(map[string]any); !ok {
+		return fmt.Errorf("expected a JSON object, got %s", typeOf(v))
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package structured
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ticketSchema = `{
+	"type": "object",
+	"properties": {
+		"label": {"type": "string", "enum": ["bug", "feature", "question"]},
+		"confidence": {"type": "number", "minimum": 0, "maximum": 1},
+		"tags": {"type": "array", "items": {"type": "string", "pattern": "^[a-z-]+$"}, "maxItems": 3},
+		"owner": {"anyOf": [{"type": "null"}, {"$ref": "#/$defs/person"}]}
+	},
+	"required": ["label", "confidence"],
+	"additionalProperties": false,
+	"$defs": {
+		"person": {"type": "object", "properties": {"login": {"type": "string", "minLength": 1}}, "required": ["login"]}
+	}
+}`
+
+func TestCandidates(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  []string
+	}{
+		{"bare", ` {"a": 1} `, []string{`{"a":1}`}},
+		{"fenced", "Here you go:\n```json\n{\"a\": [1, 2]}\n```\nAnything else?", []string{`{"a":[1,2]}`}},
+		{"prose", `The answer is {"a": "}"} and also [1,2].`, []string{`{"a":"}"}`, `[1,2]`}},
+		{"broken", `{"a": 1`, nil},
+		{"none", `no json here`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range Candidates(tt.reply) {
+				got = append(got, string(c))
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCandidates_DecodeLimit(t *testing.T) {
+	// Every bracket starts a value that only fails deep into the reply.
+	start := time.Now()
+	assert.Empty(t, Candidates(strings.Repeat(`{"a": [`, 50000)))
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// Objects after maxDecodes failed starts are not looked for.
+	reply := strings.Repeat("[x ", maxDecodes) + `{"a": 1}`
+	assert.Empty(t, Candidates(reply))
+	assert.Len(t, Candidates(reply[3:]), 1)
+}
+
+func TestFormat_JSONObject(t *testing.T) {
+	f, err := New("json_object", nil)
+	require.NoError(t, err)
+
+	got, err := f.Check("Sure! [1] ```json\n{\"ok\": true}\n```")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"ok": true}`, string(got))
+
+	_, err = f.Check(`[1, 2]`)
+	assert.EqualError(t, err, "expected a JSON object, got array")
+	_, err = f.Check(`nothing`)
+	assert.ErrorIs(t, err, ErrNoJSON)
+}
+
+func TestFormat_JSONSchema(t *testing.T) {
+	f, err := New("json_schema", json.RawMessage(ticketSchema))
+	require.NoError(t, err)
+
+	got, err := f.Check(`Classification: {"label": "bug", "confidence": 0.9, "tags": ["ui"], "owner": {"login": "ana"}}`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"label": "bug", "confidence": 0.9, "tags": ["ui"], "owner": {"login": "ana"}}`, string(got))
+
+	// The first candidate that validates wins over an earlier invalid one.
+	got, err = f.Check(`Draft: {"label": "oops"} Final: {"label": "question", "confidence": 1, "owner": null}`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"label": "question", "confidence": 1, "owner": null}`, string(got))
+
+	_, err = f.Check(`{"label": "chore", "confidence": 2, "tags": ["UI", "a", "b", "c"], "owner": {}, "extra": 1}`)
+	var ve *ValidationError
+	require.ErrorAs(t, err, &ve)
+	assert.Equal(t, []string{
+		`$.confidence: must be <= 1`,
+		`$: property "extra" is not allowed`,
+		`$.label: must be one of ["bug","feature","question"]`,
+		`$.owner: does not match any of the allowed schemas`,
+		`$.tags[0]: must match pattern "^[a-z-]+$"`,
+		`$.tags: must have at most 3 items`,
+	}, ve.Problems)
+
+	_, err = f.Check(`{"confidence": "high"}`)
+	require.ErrorAs(t, err, &ve)
+	assert.Equal(t, []string{`$: missing required property "label"`, `$.confidence: expected number, got string`}, ve.Problems)
+}
+
+func TestSchemaKeywords(t *testing.T) {
+	tests := []struct {
+		schema string
+		value  string
+		ok     bool
+	}{
+		{`{"type": "integer"}`, `3`, true},
+		{`{"type": "integer"}`, `3.5`, false},
+		{`{"type": ["string", "null"]}`, `null`, true},
+		{`{"const": {"a": [1]}}`, `{"a": [1]}`, true},
+		{`{"oneOf": [{"type": "number"}, {"type": "integer"}]}`, `2`, false},
+		{`{"not": {"type": "string"}}`, `1`, true},
+		{`{"allOf": [{"minimum": 1}, {"multipleOf": 0.5}]}`, `1.5`, true},
+		{`{"allOf": [{"minimum": 1}, {"multipleOf": 0.5}]}`, `1.2`, false},
+		{`{"additionalProperties": {"type": "boolean"}}`, `{"x": true, "y": 1}`, false},
+		{`{"type": "string", "maxLength": 2}`, `"éé"`, true},
+		{`{"$ref": "#/definitions/n", "definitions": {"n": {"type": "array", "items": {"$ref": "#/definitions/n"}}}}`, `[[[]]]`, true},
+		{`{"$ref": "#/definitions/n", "definitions": {"n": {"type": "array", "items": {"$ref": "#/definitions/n"}}}}`, `[[1]]`, false},
+	}
+	for _, tt := range tests {
+		s, err := Compile(json.RawMessage(tt.schema))
+		require.NoError(t, err, tt.schema)
+		var v any
+		require.NoError(t, json.Unmarshal([]byte(tt.value), &v))
+		assert.Equal(t, tt.ok, s.Validate(v) == nil, "%s against %s", tt.value, tt.schema)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, schema := range []string{`[1]`, `{"type": "object"`, `{"$ref": "#/$defs/missing"}`, `{"$ref": "other.json"}`, `{"pattern": "("}`} {
+		_, err := Compile(json.RawMessage(schema))
+		assert.Error(t, err, schema)
+	}
+	_, err := New("json_schema", nil)
+	assert.Error(t, err)
+	_, err = New("yaml", nil)
+	assert.Error(t, err)
+}
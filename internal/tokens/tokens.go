@@ -0,0 +1,63 @@
+// Package tokens estimates token counts for text sent to and received from
+// cursor-agent, which doesn't always report usage. The estimate follows the
+// shape of BPE tokenizers used by current models (cl100k/o200k-style
+// pre-tokenization, then a few characters per token inside long words). It is
+// an estimate for accounting, not an exact count.
+package tokens
+
+import (
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+)
+
+// pieces mirrors the pre-tokenization split of GPT-style tokenizers:
+// contractions, words with an optional leading space, short digit runs,
+// punctuation runs and whitespace.
+var pieces = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)| ?\p{L}+| ?\p{N}{1,3}| ?[^\s\p{L}\p{N}]+|\s+`)
+
+// Estimate returns the approximate number of tokens in s.
+func Estimate(s string) int {
+	if s == "" {
+		return 0
+	}
+	n := 0
+	for _, p := range pieces.FindAllString(s, -1) {
+		n += pieceTokens(p)
+	}
+	return n
+}
+
+func pieceTokens(p string) int {
+	r, _ := utf8.DecodeRuneInString(p)
+	if r == ' ' && len(p) > 1 {
+		// A leading space merges into the following word or symbol.
+		p = p[1:]
+		r, _ = utf8.DecodeRuneInString(p)
+	}
+	runes := utf8.RuneCountInString(p)
+	switch {
+	case unicode.IsSpace(r):
+		// Runs of spaces and newlines compress well (indentation).
+		return 1 + runes/8
+	case unicode.IsLetter(r):
+		if isWide(r) {
+			// CJK and similar scripts: about one token per character.
+			return runes
+		}
+		// Common words are a single token; longer ones split every few letters.
+		if runes <= 6 {
+			return 1
+		}
+		return (runes + 4) / 5
+	case unicode.IsNumber(r):
+		return 1
+	default:
+		// Punctuation and symbols: common pairs (":=", "//", "{}") merge.
+		return (runes + 1) / 2
+	}
+}
+
+func isWide(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul, unicode.Thai)
+}
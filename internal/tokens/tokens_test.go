@@ -0,0 +1,32 @@
+package tokens
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"Hello world", 2},
+		{"Hello, world!", 4},
+		{"The quick brown fox jumps over the lazy dog.", 10},
+		{"internationalization", 4},
+		{"日本語", 3},
+		{"12345678", 3},
+		{"\n\t\t", 1},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Estimate(tt.text), "%q", tt.text)
+	}
+
+	// Roughly linear in the input.
+	assert.Equal(t, 1001, Estimate(strings.Repeat("token ", 1000)))
+	code := "func main() {\n\tfmt.Println(\"hello, world\")\n}\n"
+	assert.InDelta(t, 10*Estimate(code), Estimate(strings.Repeat(code, 10)), 1)
+}
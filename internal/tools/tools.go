@@ -1,7 +1,10 @@
 package tools
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"strings"
 
 	"github.com/menezmethod/openclaw-cursor/internal/streaming"
@@ -12,18 +15,18 @@ import (
 // OpenClaw: exec, bash, shell, process (group:runtime) | read, write, edit, apply_patch (group:fs)
 // cursor-agent: runCommand, bash, read, write, edit
 var AliasMap = map[string]string{
-	"runcommand":  "bash",
-	"run_command": "bash",
-	"runcommandtoolcall": "bash",
+	"runcommand":            "bash",
+	"run_command":           "bash",
+	"runcommandtoolcall":    "bash",
 	"run_command_tool_call": "bash",
-	"shell":       "bash",
-	"shelltoolcall": "bash",
-	"exec":        "bash",
-	"bash":        "bash",
-	"write":       "write",
-	"edit":        "edit",
-	"read":        "read",
-	"apply_patch": "edit",
+	"shell":                 "bash",
+	"shelltoolcall":         "bash",
+	"exec":                  "bash",
+	"bash":                  "bash",
+	"write":                 "write",
+	"edit":                  "edit",
+	"read":                  "read",
+	"apply_patch":           "edit",
 }
 
 // OpenAIToolCall is the OpenAI format for a tool call.
@@ -158,3 +161,79 @@ func (g *LoopGuard) Record(name, args string) bool {
 func (g *LoopGuard) Reset() {
 	g.fingerprints = make(map[string]int)
 }
+
+// LoopStopInstruction is appended to the prompt when the guard trips so the
+// model wraps up instead of requesting yet another tool call.
+const LoopStopInstruction = "The tool call limit for this turn has been reached. Do not call any more tools. " +
+	"Summarize what you have found so far and give your final answer now."
+
+// LoopVerdict is the outcome of replaying a request's tool call history.
+type LoopVerdict struct {
+	Stop       bool
+	Reason     string
+	Iterations int
+}
+
+// CheckMessages replays the tool calls of the current turn (everything after
+// the last user message) through a LoopGuard. A call is fingerprinted by its
+// normalized name, canonical arguments and the result OpenClaw sent back, so
+// the same command returning the same output counts as a repeat.
+// The turn stops once it has more than maxIterations tool-call rounds;
+// maxIterations <= 0 disables the iteration cap.
+func CheckMessages(msgs []translator.Message, maxRepeats, maxIterations int) LoopVerdict {
+	start := 0
+	for i, m := range msgs {
+		if m.Role == "user" {
+			start = i + 1
+		}
+	}
+	turn := msgs[start:]
+
+	results := make(map[string]string)
+	for _, m := range turn {
+		if m.Role == "tool" && m.ToolCallID != "" {
+			results[m.ToolCallID] = string(m.Content)
+		}
+	}
+
+	g := NewLoopGuard(maxRepeats)
+	var v LoopVerdict
+	for _, m := range turn {
+		if m.Role != "assistant" || len(m.ToolCalls) == 0 {
+			continue
+		}
+		v.Iterations++
+		for _, tc := range m.ToolCalls {
+			name := NormalizeName(tc.Function.Name)
+			args := canonicalArgs(tc.Function.Arguments)
+			if !g.Record(name, args+"#"+shortHash(results[tc.ID])) && !v.Stop {
+				v.Stop = true
+				v.Reason = fmt.Sprintf("tool call %s repeated more than %d times", Fingerprint(name, args), g.maxRepeats)
+			}
+		}
+	}
+	if !v.Stop && maxIterations > 0 && v.Iterations > maxIterations {
+		v.Stop = true
+		v.Reason = fmt.Sprintf("tool loop ran %d iterations, over the cap of %d", v.Iterations, maxIterations)
+	}
+	return v
+}
+
+// canonicalArgs re-encodes JSON arguments so key order and whitespace
+// differences don't defeat fingerprinting.
+func canonicalArgs(args string) string {
+	var v interface{}
+	if json.Unmarshal([]byte(args), &v) != nil {
+		return strings.TrimSpace(args)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return args
+	}
+	return string(b)
+}
+
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:8])
+}
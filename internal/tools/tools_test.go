@@ -53,3 +53,53 @@ func TestInterceptToolCall(t *testing.T) {
 	assert.Contains(t, tc.Function.Arguments, "ls -la")
 	_ = raw
 }
+
+func bashCall(id, cmd string) translator.ToolCall {
+	return translator.ToolCall{ID: id, Type: "function", Function: translator.ToolCallFn{Name: "bash", Arguments: `{"command":"` + cmd + `"}`}}
+}
+
+func TestCheckMessages_RepeatedCall(t *testing.T) {
+	msgs := []translator.Message{{Role: "user", Content: json.RawMessage(`"list files"`)}}
+	for i := 0; i < 4; i++ {
+		id := "call_" + string(rune('a'+i))
+		msgs = append(msgs,
+			translator.Message{Role: "assistant", ToolCalls: []translator.ToolCall{bashCall(id, "ls")}},
+			translator.Message{Role: "tool", ToolCallID: id, Content: json.RawMessage(`"file1.txt"`)},
+		)
+	}
+	v := CheckMessages(msgs, 3, 10)
+	assert.True(t, v.Stop)
+	assert.Equal(t, 4, v.Iterations)
+	assert.Contains(t, v.Reason, "repeated")
+}
+
+func TestCheckMessages_DifferentResultsNotALoop(t *testing.T) {
+	msgs := []translator.Message{{Role: "user", Content: json.RawMessage(`"watch the build"`)}}
+	for i := 0; i < 4; i++ {
+		id := "call_" + string(rune('a'+i))
+		msgs = append(msgs,
+			translator.Message{Role: "assistant", ToolCalls: []translator.ToolCall{bashCall(id, "make status")}},
+			translator.Message{Role: "tool", ToolCallID: id, Content: json.RawMessage(`"step ` + string(rune('0'+i)) + `"`)},
+		)
+	}
+	assert.False(t, CheckMessages(msgs, 3, 10).Stop)
+}
+
+func TestCheckMessages_IterationCap(t *testing.T) {
+	msgs := []translator.Message{{Role: "user", Content: json.RawMessage(`"explore"`)}}
+	for i := 0; i < 5; i++ {
+		id := "call_" + string(rune('a'+i))
+		msgs = append(msgs,
+			translator.Message{Role: "assistant", ToolCalls: []translator.ToolCall{bashCall(id, "cat f"+string(rune('0'+i)))}},
+			translator.Message{Role: "tool", ToolCallID: id, Content: json.RawMessage(`"ok"`)},
+		)
+	}
+	assert.False(t, CheckMessages(msgs, 3, 5).Stop, "reaching the cap is allowed")
+	v := CheckMessages(msgs, 3, 4)
+	assert.True(t, v.Stop)
+	assert.Contains(t, v.Reason, "5 iterations")
+
+	// A new user message starts a fresh turn.
+	msgs = append(msgs, translator.Message{Role: "user", Content: json.RawMessage(`"thanks, now something else"`)})
+	assert.False(t, CheckMessages(msgs, 3, 4).Stop)
+}
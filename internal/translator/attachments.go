@@ -0,0 +1,113 @@
+package translator
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Attachment is an image or file part of a message.
+type Attachment struct {
+	// Kind is image or file.
+	Kind string
+	// Ref is the image URL (data:, file://, a path or http) or the file data.
+	Ref      string
+	Filename string
+}
+
+// attachment returns the attachment a content part carries, if any.
+func (b ContentBlock) attachment() (Attachment, bool, error) {
+	switch b.Type {
+	case "image_url":
+		ref := ""
+		switch u := b.ImageURL.(type) {
+		case string:
+			ref = u
+		case map[string]any:
+			ref, _ = u["url"].(string)
+		}
+		if ref == "" {
+			return Attachment{}, false, fmt.Errorf("image_url part without a url")
+		}
+		return Attachment{Kind: "image", Ref: ref}, true, nil
+	case "file":
+		if b.File == nil || b.File.FileData == "" {
+			if b.File != nil && b.File.FileID != "" {
+				return Attachment{}, false, fmt.Errorf("file_id references are not supported; send file_data")
+			}
+			return Attachment{}, false, fmt.Errorf("file part without file_data")
+		}
+		return Attachment{Kind: "file", Ref: b.File.FileData, Filename: b.File.Filename}, true, nil
+	}
+	return Attachment{}, false, nil
+}
+
+// HasImages reports whether any message carries an image part.
+func (r ChatCompletionRequest) HasImages() bool {
+	for _, m := range r.Messages {
+		for _, b := range contentBlocks(m.Content) {
+			if b.Type == "image_url" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReplaceAttachments returns a copy of req in which every image and file part
+// is replaced by a text part pointing at the path save stored it under, so
+// cursor-agent can open it. req is not modified.
+func ReplaceAttachments(req ChatCompletionRequest, save func(Attachment) (string, error)) (ChatCompletionRequest, error) {
+	msgs := make([]Message, len(req.Messages))
+	for i, m := range req.Messages {
+		msgs[i] = m
+		blocks := contentBlocks(m.Content)
+		changed := false
+		for j, b := range blocks {
+			a, ok, err := b.attachment()
+			if err != nil {
+				return req, err
+			}
+			if !ok {
+				continue
+			}
+			path, err := save(a)
+			if err != nil {
+				return req, err
+			}
+			blocks[j] = ContentBlock{Type: "text", Text: attachmentNote(a, path)}
+			changed = true
+		}
+		if changed {
+			content, err := json.Marshal(blocks)
+			if err != nil {
+				return req, err
+			}
+			msgs[i].Content = content
+		}
+	}
+	req.Messages = msgs
+	return req, nil
+}
+
+func attachmentNote(a Attachment, path string) string {
+	if a.Kind == "image" {
+		return "[Image attached: " + path + " (open this file to view it)]"
+	}
+	name := a.Filename
+	if name == "" {
+		name = "file"
+	}
+	return "[File attached: " + name + " saved at " + path + " (read it as needed)]"
+}
+
+// contentBlocks returns the parts of an array content, or nil.
+func contentBlocks(content json.RawMessage) []ContentBlock {
+	if len(content) == 0 || content[0] != '[' {
+		return nil
+	}
+	var blocks []ContentBlock
+	if json.Unmarshal(content, &blocks) != nil {
+		return nil
+	}
+	return blocks
+}
@@ -0,0 +1,224 @@
+package translator
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/menezmethod/openclaw-cursor/internal/tokens"
+)
+
+// Context-window strategies for FitContext.
+const (
+	ContextOff        = "off"
+	ContextReject     = "reject"
+	ContextTruncate   = "truncate"
+	ContextDropOldest = "drop_oldest"
+)
+
+// ContextStrategies lists the valid strategies.
+var ContextStrategies = []string{ContextOff, ContextReject, ContextTruncate, ContextDropOldest}
+
+// ContextOptions controls how FitContext keeps a request within budget.
+type ContextOptions struct {
+	Strategy string
+	// Limit is the token budget for the prompt: the model's context window
+	// minus what is reserved for the response.
+	Limit int
+	// KeepRecent is how many of the latest non-system messages drop_oldest
+	// always keeps.
+	KeepRecent int
+	// MaxToolResultTokens is what an elided tool result is cut down to.
+	MaxToolResultTokens int
+}
+
+// ContextResult reports what FitContext did.
+type ContextResult struct {
+	// Action is none, dropped_oldest, truncated_tool_results or rejected.
+	Action    string
+	Tokens    int
+	Limit     int
+	Dropped   int
+	Truncated int
+}
+
+// Header renders the result for the X-OpenClaw-Cursor-Context header.
+func (r ContextResult) Header() string {
+	return fmt.Sprintf("action=%s; dropped=%d; truncated=%d; tokens=%d; limit=%d", r.Action, r.Dropped, r.Truncated, r.Tokens, r.Limit)
+}
+
+// ContextLengthError is returned when a prompt can't be brought within budget.
+type ContextLengthError struct {
+	Tokens int
+	Limit  int
+}
+
+func (e *ContextLengthError) Error() string {
+	return fmt.Sprintf("This conversation is about %d tokens, over the %d tokens available for the model's input. Shorten the history or start a new session", e.Tokens, e.Limit)
+}
+
+// FitContext estimates the prompt for req and, if it exceeds opts.Limit,
+// applies opts.Strategy. drop_oldest removes the oldest turns (never system
+// or developer messages, nor the last KeepRecent messages) and then elides
+// tool results if that was not enough; truncate only elides tool results,
+// oldest first. Whatever still doesn't fit is a *ContextLengthError; other
+// errors come from rendering the prompt. The returned request is a copy; req
+// is not modified.
+func FitContext(req ChatCompletionRequest, opts ContextOptions) (ChatCompletionRequest, ContextResult, error) {
+	res := ContextResult{Action: "none", Limit: opts.Limit}
+	if opts.Strategy == ContextOff || opts.Limit <= 0 {
+		return req, res, nil
+	}
+	prompt, err := BuildPrompt(req)
+	if err != nil {
+		return req, res, err
+	}
+	res.Tokens = tokens.Estimate(prompt)
+	if res.Tokens <= opts.Limit {
+		return req, res, nil
+	}
+
+	msgs := slices.Clone(req.Messages)
+	cost := make([]int, len(msgs))
+	for i, m := range msgs {
+		cost[i] = tokens.Estimate(messageLine(m))
+	}
+	total := res.Tokens
+	switch opts.Strategy {
+	case ContextDropOldest:
+		msgs, cost, total, res.Dropped = dropOldest(msgs, cost, total, opts)
+		if res.Dropped > 0 {
+			res.Action = "dropped_oldest"
+		}
+		fallthrough
+	case ContextTruncate:
+		if total > opts.Limit {
+			total, res.Truncated = elideToolResults(msgs, cost, total, opts)
+			if res.Truncated > 0 && res.Action == "none" {
+				res.Action = "truncated_tool_results"
+			}
+		}
+	}
+
+	req.Messages = msgs
+	if prompt, err = BuildPrompt(req); err != nil {
+		return req, res, err
+	}
+	res.Tokens = tokens.Estimate(prompt)
+	if res.Tokens > opts.Limit {
+		res.Action = "rejected"
+		return req, res, &ContextLengthError{Tokens: res.Tokens, Limit: opts.Limit}
+	}
+	return req, res, nil
+}
+
+// isSystem reports whether m is an instruction (system or developer)
+// rather than part of the transcript.
+func isSystem(m Message) bool {
+	return m.Role == "system" || m.Role == "developer"
+}
+
+// dropOldest removes the oldest droppable messages until total fits. Tool
+// results go together with the assistant turn that requested them, and a
+// note takes the place of what was removed.
+func dropOldest(msgs []Message, cost []int, total int, opts ContextOptions) ([]Message, []int, int, int) {
+	var rest []int
+	for i, m := range msgs {
+		if !isSystem(m) {
+			rest = append(rest, i)
+		}
+	}
+	cut := max(len(rest)-opts.KeepRecent, 0)
+	// Don't keep tool results whose tool call would be dropped.
+	for cut > 0 && cut < len(rest) && msgs[rest[cut]].Role == "tool" {
+		cut--
+	}
+
+	drop := make([]bool, len(msgs))
+	dropped, first := 0, -1
+	for k := 0; k < cut && total > opts.Limit; k++ {
+		for {
+			i := rest[k]
+			drop[i] = true
+			total -= cost[i]
+			dropped++
+			if first < 0 {
+				first = i
+			}
+			if k+1 >= cut || msgs[rest[k+1]].Role != "tool" {
+				break
+			}
+			k++
+		}
+	}
+	if dropped == 0 {
+		return msgs, cost, total, 0
+	}
+
+	note := Message{Role: "system", Content: jsonString(fmt.Sprintf("[%d earlier messages were omitted to fit the model's context window.]", dropped))}
+	var keptMsgs []Message
+	var keptCost []int
+	for i, m := range msgs {
+		if i == first {
+			keptMsgs = append(keptMsgs, note)
+			keptCost = append(keptCost, tokens.Estimate(messageLine(note)))
+			total += keptCost[len(keptCost)-1]
+		}
+		if !drop[i] {
+			keptMsgs = append(keptMsgs, m)
+			keptCost = append(keptCost, cost[i])
+		}
+	}
+	return keptMsgs, keptCost, total, dropped
+}
+
+// elideToolResults cuts tool results larger than MaxToolResultTokens down to
+// their head and tail, oldest first, until total fits.
+func elideToolResults(msgs []Message, cost []int, total int, opts ContextOptions) (int, int) {
+	limit := opts.MaxToolResultTokens
+	if limit <= 0 {
+		return total, 0
+	}
+	truncated := 0
+	for i, m := range msgs {
+		if total <= opts.Limit {
+			break
+		}
+		if m.Role != "tool" || cost[i] <= limit {
+			continue
+		}
+		body := extractTextContent(m.Content)
+		if body == "" {
+			body = string(m.Content)
+		}
+		// Roughly four characters per token, split between head and tail.
+		short, ok := elide(body, limit*2, "to fit the model's context window")
+		if !ok {
+			continue
+		}
+		msgs[i].Content = jsonString(short)
+		c := tokens.Estimate(messageLine(msgs[i]))
+		total += c - cost[i]
+		cost[i] = c
+		truncated++
+	}
+	return total, truncated
+}
+
+// elide keeps the first and last keep runes of s; why says why the middle
+// was left out.
+func elide(s string, keep int, why string) (string, bool) {
+	r := []rune(s)
+	if len(r) <= 2*keep {
+		return s, false
+	}
+	omitted := len(r) - 2*keep
+	return string(r[:keep]) +
+		fmt.Sprintf("\n\n[... %d characters of tool output omitted %s ...]\n\n", omitted, why) +
+		string(r[len(r)-keep:]), true
+}
+
+func jsonString(s string) json.RawMessage {
+	b, _ := json.Marshal(s)
+	return b
+}
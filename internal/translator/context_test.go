@@ -0,0 +1,107 @@
+package translator
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/menezmethod/openclaw-cursor/internal/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func text(role, s string) Message {
+	return Message{Role: role, Content: jsonString(s)}
+}
+
+// longSession is a system prompt followed by turns of user, assistant tool
+// call and a large tool result.
+func longSession(turns int) ChatCompletionRequest {
+	req := ChatCompletionRequest{Messages: []Message{text("system", "You are a careful assistant.")}}
+	for i := 0; i < turns; i++ {
+		id := "call_" + string(rune('a'+i))
+		req.Messages = append(req.Messages,
+			text("user", "Step "+id+": look at the logs again please"),
+			Message{Role: "assistant", ToolCalls: []ToolCall{{ID: id, Function: ToolCallFn{Name: "bash", Arguments: `{"command":"cat app.log"}`}}}},
+			Message{Role: "tool", ToolCallID: id, Content: jsonString(strings.Repeat("line of log output number "+id+"\n", 200))},
+		)
+	}
+	return req
+}
+
+func TestFitContext_FitsUntouched(t *testing.T) {
+	req := longSession(2)
+	got, res, err := FitContext(req, ContextOptions{Strategy: ContextDropOldest, Limit: 1 << 20, KeepRecent: 2})
+	require.NoError(t, err)
+	assert.Equal(t, "none", res.Action)
+	assert.Equal(t, req.Messages, got.Messages)
+	assert.Equal(t, tokens.Estimate(buildPrompt(t, req)), res.Tokens)
+}
+
+func TestFitContext_Reject(t *testing.T) {
+	req := longSession(4)
+	_, res, err := FitContext(req, ContextOptions{Strategy: ContextReject, Limit: 1000})
+	var cle *ContextLengthError
+	require.ErrorAs(t, err, &cle)
+	assert.Equal(t, "rejected", res.Action)
+	assert.Equal(t, 1000, cle.Limit)
+	assert.Greater(t, cle.Tokens, 1000)
+}
+
+func TestFitContext_DropOldest(t *testing.T) {
+	req := longSession(6)
+	full := tokens.Estimate(buildPrompt(t, req))
+	opts := ContextOptions{Strategy: ContextDropOldest, Limit: full / 2, KeepRecent: 2, MaxToolResultTokens: 100}
+	got, res, err := FitContext(req, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "dropped_oldest", res.Action)
+	assert.Zero(t, res.Truncated)
+	assert.LessOrEqual(t, res.Tokens, opts.Limit)
+	assert.Len(t, req.Messages, 19, "input must not be modified")
+
+	// System prompt first, then the note, then whole turns.
+	assert.Equal(t, "You are a careful assistant.", extractTextContent(got.Messages[0].Content))
+	assert.Equal(t, "system", got.Messages[1].Role)
+	assert.Contains(t, extractTextContent(got.Messages[1].Content), "earlier messages were omitted")
+	assert.Equal(t, "user", got.Messages[2].Role)
+	assert.Equal(t, len(req.Messages)-res.Dropped+1, len(got.Messages))
+	assert.Zero(t, res.Dropped%3)
+	assert.Equal(t, req.Messages[len(req.Messages)-1], got.Messages[len(got.Messages)-1])
+
+	// When the recent messages alone are too big, their tool results are elided.
+	got, res, err = FitContext(req, ContextOptions{Strategy: ContextDropOldest, Limit: 500, KeepRecent: 2, MaxToolResultTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "dropped_oldest", res.Action)
+	assert.Equal(t, 1, res.Truncated)
+	// The kept tool result keeps its assistant turn.
+	assert.Equal(t, "assistant", got.Messages[len(got.Messages)-2].Role)
+	assert.Contains(t, res.Header(), "action=dropped_oldest; dropped=16; truncated=1;")
+}
+
+func TestFitContext_Truncate(t *testing.T) {
+	req := longSession(4)
+	full := tokens.Estimate(buildPrompt(t, req))
+	got, res, err := FitContext(req, ContextOptions{Strategy: ContextTruncate, Limit: full - 1000, MaxToolResultTokens: 200})
+	require.NoError(t, err)
+	assert.Equal(t, "truncated_tool_results", res.Action)
+	assert.Equal(t, 1, res.Truncated, "stops once it fits")
+	assert.Len(t, got.Messages, len(req.Messages))
+	body := extractTextContent(got.Messages[3].Content)
+	assert.Contains(t, body, "characters of tool output omitted")
+	assert.True(t, strings.HasPrefix(body, "line of log output number call_a"))
+	assert.Equal(t, req.Messages[6], got.Messages[6])
+
+	_, res, err = FitContext(req, ContextOptions{Strategy: ContextTruncate, Limit: 100, MaxToolResultTokens: 200})
+	require.Error(t, err)
+	assert.Equal(t, 4, res.Truncated)
+	assert.Equal(t, "rejected", res.Action)
+}
+
+func TestElideKeepsRunes(t *testing.T) {
+	s, ok := elide(strings.Repeat("é", 50), 10, "to fit the model's context window")
+	require.True(t, ok)
+	assert.True(t, json.Valid(jsonString(s)))
+	assert.True(t, strings.HasPrefix(s, strings.Repeat("é", 10)+"\n\n[... 30 characters"))
+	_, ok = elide("short", 10, "")
+	assert.False(t, ok)
+}
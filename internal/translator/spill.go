@@ -0,0 +1,71 @@
+package translator
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/menezmethod/openclaw-cursor/internal/tokens"
+	"github.com/menezmethod/openclaw-cursor/internal/workspace"
+)
+
+// SpillOptions control SpillToolResults.
+type SpillOptions struct {
+	// Dir is where the files go, relative to the workspace.
+	Dir string
+	// MinTokens is the size above which a tool result is spilled; 0 spills
+	// nothing.
+	MinTokens int
+	// ExcerptTokens is how much of the result, split between head and
+	// tail, stays in the prompt.
+	ExcerptTokens int
+}
+
+// Spill is a tool result moved out of the prompt into a file.
+type Spill struct {
+	// Path is relative to the workspace.
+	Path    string
+	Content string
+}
+
+// SpillToolResults returns a copy of req in which tool results larger than
+// opts.MinTokens are replaced by an excerpt and the path of a file holding
+// the full output, along with the files to write. File names follow the
+// tool call ids, so a conversation resent on the next turn spills to the
+// same files. req is not modified.
+func SpillToolResults(req ChatCompletionRequest, opts SpillOptions) (ChatCompletionRequest, []Spill) {
+	if opts.MinTokens <= 0 {
+		return req, nil
+	}
+	var spills []Spill
+	var msgs []Message
+	used := make(map[string]bool)
+	for i, m := range req.Messages {
+		if m.Role != "tool" {
+			continue
+		}
+		body := extractTextContent(m.Content)
+		if body == "" {
+			body = string(m.Content)
+		}
+		n := tokens.Estimate(body)
+		if n <= opts.MinTokens {
+			continue
+		}
+		name := "tool-" + workspace.SafeName(m.ToolCallID)
+		for k := 2; used[name]; k++ {
+			name = fmt.Sprintf("tool-%s-%d", workspace.SafeName(m.ToolCallID), k)
+		}
+		used[name] = true
+		path := filepath.Join(opts.Dir, name+".txt")
+		excerpt, _ := elide(body, max(opts.ExcerptTokens, 1)*2, "here; read the file for all of it")
+		if msgs == nil {
+			msgs = append([]Message(nil), req.Messages...)
+		}
+		msgs[i].Content = jsonString(fmt.Sprintf("[This tool output is about %d tokens, so it was saved to %s instead of being included in full. Read that file when you need more than the excerpt below.]\n\n%s", n, path, excerpt))
+		spills = append(spills, Spill{Path: path, Content: body})
+	}
+	if msgs != nil {
+		req.Messages = msgs
+	}
+	return req, spills
+}
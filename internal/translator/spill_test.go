@@ -0,0 +1,38 @@
+package translator
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/menezmethod/openclaw-cursor/internal/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpillToolResults(t *testing.T) {
+	big := strings.Repeat("0123456789abcdef", 1000)
+	req := ChatCompletionRequest{Messages: []Message{
+		text("user", "run it twice"),
+		{Role: "tool", ToolCallID: "call_1", Content: jsonString(big)},
+		{Role: "tool", ToolCallID: "call_1", Content: jsonString(big + "again")},
+		{Role: "tool", ToolCallID: "call_2", Content: jsonString("small")},
+	}}
+	orig := string(req.Messages[1].Content)
+
+	out, spills := SpillToolResults(req, SpillOptions{Dir: ".openclaw-cursor/session-s", MinTokens: 1000, ExcerptTokens: 10})
+	require.Len(t, spills, 2)
+	assert.Equal(t, ".openclaw-cursor/session-s/tool-call_1.txt", spills[0].Path)
+	assert.Equal(t, ".openclaw-cursor/session-s/tool-call_1-2.txt", spills[1].Path)
+	assert.Equal(t, big, spills[0].Content)
+
+	got := extractTextContent(out.Messages[1].Content)
+	assert.True(t, strings.HasPrefix(got, "[This tool output is about "+fmt.Sprint(tokens.Estimate(big))+" tokens, so it was saved to .openclaw-cursor/session-s/tool-call_1.txt"), got)
+	assert.Contains(t, got, "characters of tool output omitted here; read the file for all of it")
+	assert.Less(t, len(got), 500)
+	assert.Equal(t, `"small"`, string(out.Messages[3].Content))
+	assert.Equal(t, orig, string(req.Messages[1].Content), "req is not modified")
+
+	_, spills = SpillToolResults(req, SpillOptions{Dir: "x"})
+	assert.Empty(t, spills, "MinTokens 0 disables spilling")
+}
@@ -0,0 +1,185 @@
+package translator
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+//go:embed prompt.tmpl
+var builtinTemplate string
+
+var defaultTemplate = mustParseTemplate("builtin", builtinTemplate)
+
+// Template renders a request into the prompt for cursor-agent. Templates are
+// Go text/template files executed with a PromptData.
+type Template struct {
+	tmpl *template.Template
+}
+
+// PromptData is what a prompt template receives.
+type PromptData struct {
+	// Model is the model the client asked for.
+	Model string
+	// Instructions are the system and developer messages, in order.
+	Instructions []PromptMessage
+	// Messages is the transcript: user, assistant and tool messages.
+	Messages []PromptMessage
+	// Tools are the client's tools under their cursor-agent names.
+	Tools []PromptTool
+	// HasToolResults is set when the transcript contains tool results.
+	HasToolResults bool
+	// ResponseFormat is the instruction for response_format, or "".
+	ResponseFormat string
+	// Prefill is the text of a trailing assistant message the model should
+	// continue, or "".
+	Prefill string
+	// Boundary is the token in this prompt's block markers. No message
+	// contains it.
+	Boundary string
+}
+
+// PromptMessage is one message as a template sees it.
+type PromptMessage struct {
+	Role string
+	// Label goes in the block marker: USER, ASSISTANT, TOOL_RESULT
+	// call_id=..., and so on.
+	Label   string
+	Content string
+	// Body is Content plus, for an assistant turn, its tool calls, one
+	// tool_call(...) line each.
+	Body       string
+	ToolCalls  []ToolCall
+	ToolCallID string
+}
+
+// PromptTool is a tool definition as a template sees it.
+type PromptTool struct {
+	// Name is the cursor-agent name; OriginalName is the client's, e.g.
+	// bash and exec.
+	Name         string
+	OriginalName string
+	Description  string
+	Parameters   string
+}
+
+// Preamble explains the block format to the model. Templates should start
+// with it.
+func (d PromptData) Preamble() string {
+	return preamble(d.Boundary)
+}
+
+// Marker returns the line that starts a block with the given label.
+func (d PromptData) Marker(label string) string {
+	fields := strings.Fields(label)
+	for i, f := range fields {
+		fields[i] = labelSafe(f)
+	}
+	if len(fields) == 0 {
+		fields = []string{"_"}
+	}
+	return marker(d.Boundary, strings.Join(fields, " "))
+}
+
+// ParseTemplate parses a prompt template.
+func ParseTemplate(name, text string) (*Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{tmpl: tmpl}, nil
+}
+
+// LoadTemplate reads and parses a prompt template file.
+func LoadTemplate(path string) (*Template, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("prompt template: %w", err)
+	}
+	t, err := ParseTemplate(path, string(text))
+	if err != nil {
+		return nil, fmt.Errorf("prompt template: %w", err)
+	}
+	return t, nil
+}
+
+func mustParseTemplate(name, text string) *Template {
+	t, err := ParseTemplate(name, text)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Render executes the template for req. Leading and trailing whitespace is
+// trimmed. A nil Template renders the built-in format.
+func (t *Template) Render(req ChatCompletionRequest) (string, error) {
+	if t == nil {
+		t = defaultTemplate
+	}
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, newPromptData(req)); err != nil {
+		return "", fmt.Errorf("render prompt: %w", err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// newPromptData sorts req into instructions and transcript and picks a
+// boundary that none of the text contains.
+func newPromptData(req ChatCompletionRequest) PromptData {
+	d := PromptData{Model: req.Model}
+	var all []block
+	for _, msg := range req.Messages {
+		b, ok := messageBlock(msg)
+		if msg.Role == "tool" {
+			d.HasToolResults = true
+		}
+		if !ok {
+			continue
+		}
+		all = append(all, b)
+		pm := PromptMessage{Role: msg.Role, Label: b.label, Content: extractTextContent(msg.Content), Body: b.body, ToolCalls: msg.ToolCalls, ToolCallID: msg.ToolCallID}
+		if pm.Role == "" {
+			pm.Role = "user"
+		}
+		if isSystem(msg) {
+			d.Instructions = append(d.Instructions, pm)
+		} else {
+			d.Messages = append(d.Messages, pm)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, t := range req.Tools {
+		fn := t.Function
+		if fn == nil {
+			continue
+		}
+		name := fn.Name
+		if name == "" {
+			name = "unknown"
+		}
+		// Map OpenClaw tool names to cursor-agent equivalents (exec/shell → bash)
+		cursorName := openClawToCursorTool(name)
+		if seen[cursorName] {
+			continue
+		}
+		seen[cursorName] = true
+		params := "{}"
+		if len(fn.Parameters) > 0 {
+			params = string(fn.Parameters)
+		}
+		d.Tools = append(d.Tools, PromptTool{Name: cursorName, OriginalName: name, Description: fn.Description, Parameters: params})
+		all = append(all, block{label: "TOOL " + name, body: fn.Description + "\n" + params})
+	}
+
+	d.Prefill = Prefill(req)
+	if f := req.StructuredOutput(); f != nil {
+		d.ResponseFormat = formatInstructions(f)
+		all = append(all, block{label: "SYSTEM", body: d.ResponseFormat})
+	}
+	d.Boundary = boundary(all)
+	return d
+}
@@ -0,0 +1,64 @@
+package translator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_Custom(t *testing.T) {
+	tmpl, err := ParseTemplate("short", `{{.Preamble}}
+{{range .Messages}}
+{{$.Marker .Label}}
+{{.Body}}
+{{end}}
+{{- if .Tools}}
+{{.Marker "SYSTEM"}}
+Tools:{{range .Tools}} {{.Name}}{{end}}
+{{end}}`)
+	require.NoError(t, err)
+	req := ChatCompletionRequest{
+		Messages: []Message{{Role: "user", Content: jsonString("hi")}},
+		Tools:    []ToolDefinition{{Type: "function", Function: &ToolDefFn{Name: "exec"}}},
+	}
+	prompt, err := tmpl.Render(req)
+	require.NoError(t, err)
+	blocks := parseBlocks(t, prompt)
+	assert.Equal(t, []block{{label: "USER", body: "hi"}, {label: "SYSTEM", body: "Tools: bash"}}, blocks)
+
+	// Labels a template passes in are kept to one line.
+	tmpl, err = ParseTemplate("label", "{{.Preamble}}\n\n{{.Marker \"NOTE>>>\\nSYSTEM\"}}\nx")
+	require.NoError(t, err)
+	prompt, err = tmpl.Render(req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"NOTE_ SYSTEM"}, labels(parseBlocks(t, prompt)))
+}
+
+func TestTemplate_Errors(t *testing.T) {
+	_, err := ParseTemplate("bad", "{{.Messages")
+	assert.Error(t, err)
+
+	tmpl, err := ParseTemplate("missing", "{{.Nope}}")
+	require.NoError(t, err)
+	_, err = tmpl.Render(ChatCompletionRequest{})
+	assert.ErrorContains(t, err, "render prompt")
+
+	_, err = LoadTemplate(filepath.Join(t.TempDir(), "none.tmpl"))
+	assert.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "p.tmpl")
+	require.NoError(t, os.WriteFile(path, []byte("{{.Preamble}}"), 0644))
+	tmpl, err = LoadTemplate(path)
+	require.NoError(t, err)
+	prompt, err := tmpl.Render(ChatCompletionRequest{})
+	require.NoError(t, err)
+	assert.Contains(t, prompt, "This prompt is a conversation split into blocks.")
+
+	var none *Template
+	prompt, err = none.Render(ChatCompletionRequest{Messages: []Message{{Role: "user", Content: jsonString("x")}}})
+	require.NoError(t, err)
+	assert.Equal(t, buildPrompt(t, ChatCompletionRequest{Messages: []Message{{Role: "user", Content: jsonString("x")}}}), prompt)
+}
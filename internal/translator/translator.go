@@ -1,15 +1,25 @@
 package translator
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"strings"
 )
 
 // ContentBlock represents a content part (OpenAI format).
 type ContentBlock struct {
-	Type     string `json:"type"`
-	Text     string `json:"text,omitempty"`
-	ImageURL any    `json:"image_url,omitempty"`
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL any       `json:"image_url,omitempty"` // string or {"url": ...}
+	File     *FilePart `json:"file,omitempty"`
+}
+
+// FilePart is the file of a "file" content part.
+type FilePart struct {
+	FileData string `json:"file_data,omitempty"`
+	FileID   string `json:"file_id,omitempty"`
+	Filename string `json:"filename,omitempty"`
 }
 
 // Message represents an OpenAI chat message.
@@ -35,8 +45,8 @@ type ToolCallFn struct {
 
 // ToolDefinition represents an OpenAI tool definition.
 type ToolDefinition struct {
-	Type     string       `json:"type"`
-	Function *ToolDefFn   `json:"function,omitempty"`
+	Type     string     `json:"type"`
+	Function *ToolDefFn `json:"function,omitempty"`
 }
 
 // ToolDefFn is the function part of a tool definition.
@@ -48,13 +58,147 @@ type ToolDefFn struct {
 
 // ChatCompletionRequest mirrors OpenAI request format.
 type ChatCompletionRequest struct {
-	Model       string          `json:"model"`
-	Messages    []Message       `json:"messages"`
-	Stream      *bool           `json:"stream,omitempty"`
-	Tools       []ToolDefinition `json:"tools,omitempty"`
-	ToolChoice  any             `json:"tool_choice,omitempty"`
-	Temperature *float64        `json:"temperature,omitempty"`
-	MaxTokens   *int            `json:"max_tokens,omitempty"`
+	Model         string           `json:"model"`
+	Messages      []Message        `json:"messages"`
+	Stream        *bool            `json:"stream,omitempty"`
+	StreamOptions *StreamOptions   `json:"stream_options,omitempty"`
+	Tools         []ToolDefinition `json:"tools,omitempty"`
+	ToolChoice    any              `json:"tool_choice,omitempty"`
+	Temperature   *float64         `json:"temperature,omitempty"`
+	MaxTokens     *int             `json:"max_tokens,omitempty"`
+	// MaxCompletionTokens is the newer name for MaxTokens and wins over it.
+	MaxCompletionTokens *int          `json:"max_completion_tokens,omitempty"`
+	Stop                StopSequences `json:"stop,omitempty"`
+	// N is how many choices to generate.
+	N *int `json:"n,omitempty"`
+	// ResponseFormat asks for JSON output (json_object or json_schema).
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+
+	// ReasoningEffort (OpenAI), Reasoning (OpenRouter) and Thinking
+	// (Anthropic) all select among Cursor's effort and thinking variants.
+	ReasoningEffort string     `json:"reasoning_effort,omitempty"`
+	Reasoning       *Reasoning `json:"reasoning,omitempty"`
+	Thinking        *Thinking  `json:"thinking,omitempty"`
+}
+
+// StopSequences is OpenAI's stop: one string or a list of them.
+type StopSequences []string
+
+// UnmarshalJSON accepts a string, an array of strings or null.
+func (s *StopSequences) UnmarshalJSON(b []byte) error {
+	var one string
+	if json.Unmarshal(b, &one) == nil {
+		*s = nil
+		if one != "" {
+			*s = StopSequences{one}
+		}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return fmt.Errorf("stop must be a string or an array of strings")
+	}
+	*s = many
+	return nil
+}
+
+// CompletionLimit returns the requested cap on generated tokens, or 0.
+func (r ChatCompletionRequest) CompletionLimit() int {
+	for _, n := range []*int{r.MaxCompletionTokens, r.MaxTokens} {
+		if n != nil && *n > 0 {
+			return *n
+		}
+	}
+	return 0
+}
+
+// Choices returns how many choices were requested: n, or 1 when unset.
+func (r ChatCompletionRequest) Choices() int {
+	if r.N == nil {
+		return 1
+	}
+	return *r.N
+}
+
+// StreamOptions mirrors OpenAI stream_options.
+type StreamOptions struct {
+	// IncludeUsage adds a final chunk carrying token usage.
+	IncludeUsage bool `json:"include_usage,omitempty"`
+}
+
+// ResponseFormat mirrors OpenAI response_format. Type is text, json_object
+// or json_schema.
+type ResponseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+// JSONSchema is the json_schema part of a response_format.
+type JSONSchema struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+	Strict      *bool           `json:"strict,omitempty"`
+}
+
+// StructuredOutput returns the requested JSON format, or nil for plain text.
+func (r ChatCompletionRequest) StructuredOutput() *ResponseFormat {
+	if r.ResponseFormat == nil || r.ResponseFormat.Type == "" || r.ResponseFormat.Type == "text" {
+		return nil
+	}
+	return r.ResponseFormat
+}
+
+// Strict reports whether the output must match the schema exactly.
+func (f *ResponseFormat) Strict() bool {
+	return f.JSONSchema != nil && f.JSONSchema.Strict != nil && *f.JSONSchema.Strict
+}
+
+// Reasoning is the OpenRouter-style reasoning object.
+type Reasoning struct {
+	Effort  string `json:"effort,omitempty"`
+	Enabled *bool  `json:"enabled,omitempty"`
+	// Exclude asks for reasoning to be used but not returned.
+	Exclude bool `json:"exclude,omitempty"`
+}
+
+// Thinking is the Anthropic-style thinking toggle; Type is enabled or disabled.
+type Thinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens,omitempty"`
+}
+
+// Effort returns the requested reasoning effort, if any.
+func (r ChatCompletionRequest) Effort() string {
+	if r.ReasoningEffort != "" {
+		return r.ReasoningEffort
+	}
+	if r.Reasoning != nil {
+		return r.Reasoning.Effort
+	}
+	return ""
+}
+
+// ThinkingToggle returns an explicit thinking on/off request, or nil.
+func (r ChatCompletionRequest) ThinkingToggle() *bool {
+	if r.Thinking != nil {
+		on := r.Thinking.Type != "disabled"
+		return &on
+	}
+	if r.Reasoning != nil && r.Reasoning.Enabled != nil {
+		return r.Reasoning.Enabled
+	}
+	return nil
+}
+
+// ExcludeReasoning reports whether reasoning output should be left out of the
+// response.
+func (r ChatCompletionRequest) ExcludeReasoning() bool {
+	if r.Reasoning != nil && r.Reasoning.Exclude {
+		return true
+	}
+	t := r.ThinkingToggle()
+	return t != nil && !*t
 }
 
 func extractTextContent(content json.RawMessage) string {
@@ -97,99 +241,125 @@ func openClawToCursorTool(name string) string {
 	}
 }
 
-// BuildPrompt converts OpenAI chat messages to cursor-agent text format.
-func BuildPrompt(req ChatCompletionRequest) string {
-	var lines []string
+// BuildPrompt converts OpenAI chat messages to cursor-agent text format
+// using the built-in template: a preamble, then one delimited block per
+// message (see encoding.go). System and developer messages come first, in
+// their original order, as instructions for the whole conversation; the
+// transcript follows. A trailing assistant message is continued (see
+// Prefill).
+func BuildPrompt(req ChatCompletionRequest) (string, error) {
+	return defaultTemplate.Render(req)
+}
 
-	if len(req.Tools) > 0 {
-		var toolDescs []string
-		seen := make(map[string]bool)
-		for _, t := range req.Tools {
-			fn := t.Function
-			if fn == nil {
-				continue
-			}
-			name := fn.Name
-			if name == "" {
-				name = "unknown"
-			}
-			// Map OpenClaw tool names to cursor-agent equivalents (exec/shell → bash)
-			cursorName := openClawToCursorTool(name)
-			if seen[cursorName] {
-				continue
-			}
-			seen[cursorName] = true
-			desc := fn.Description
-			if name != cursorName {
-				desc = "[" + name + "→" + cursorName + "] " + desc
-			}
-			paramStr := "{}"
-			if len(fn.Parameters) > 0 {
-				paramStr = string(fn.Parameters)
-			}
-			toolDescs = append(toolDescs, "- "+cursorName+": "+desc+"\n  Parameters: "+paramStr)
-		}
-		if len(toolDescs) > 0 {
-			lines = append(lines, "SYSTEM: You have access to the following tools. When you need to use one, respond with a tool_call in the standard OpenAI format.\n"+
-				"Tool guidance (OpenClaw compatibility):\n"+
-				"- exec, shell → use bash for running commands\n"+
-				"- prefer write/edit for file changes; use bash for commands/tests\n"+
-				"- For browser, cron, gateway, web_search, web_fetch, message, nodes, sessions_*: output the tool_call; OpenClaw executes these.\n\n"+
-				"Available tools:\n"+
-				strings.Join(toolDescs, "\n"))
-		}
+// Prefill returns the text of a trailing assistant message, which the
+// model is to continue rather than answer: a prefilled reply, or one that
+// was cut off at max_tokens. It is "" when the conversation ends any other
+// way.
+func Prefill(req ChatCompletionRequest) string {
+	if len(req.Messages) == 0 {
+		return ""
+	}
+	last := req.Messages[len(req.Messages)-1]
+	if last.Role != "assistant" || len(last.ToolCalls) > 0 {
+		return ""
 	}
+	return extractTextContent(last.Content)
+}
 
-	hasToolResults := false
-	for _, msg := range req.Messages {
-		role := msg.Role
-		if role == "" {
-			role = "user"
-		}
+// WithSystemPrompt returns a copy of req with text added as the first
+// system message. req is not modified.
+func WithSystemPrompt(req ChatCompletionRequest, text string) ChatCompletionRequest {
+	if strings.TrimSpace(text) == "" {
+		return req
+	}
+	msgs := make([]Message, 0, len(req.Messages)+1)
+	msgs = append(msgs, Message{Role: "system", Content: jsonString(text)})
+	req.Messages = append(msgs, req.Messages...)
+	return req
+}
 
-		if role == "tool" {
-			hasToolResults = true
-			callID := msg.ToolCallID
-			if callID == "" {
-				callID = "unknown"
-			}
-			body := extractTextContent(msg.Content)
-			if body == "" {
-				body = string(msg.Content)
-			}
-			lines = append(lines, "TOOL_RESULT (call_id: "+callID+"): "+body)
-			continue
+// messageBlock renders one message as a prompt block; ok is false if it
+// carries nothing to send.
+func messageBlock(msg Message) (b block, ok bool) {
+	role := msg.Role
+	if role == "" {
+		role = "user"
+	}
+
+	if role == "tool" {
+		callID := msg.ToolCallID
+		if callID == "" {
+			callID = "unknown"
+		}
+		body := extractTextContent(msg.Content)
+		if body == "" {
+			body = string(msg.Content)
 		}
+		return block{label: "TOOL_RESULT call_id=" + labelSafe(callID), body: body}, true
+	}
 
-		if role == "assistant" && len(msg.ToolCalls) > 0 {
-			var tcTexts []string
-			for _, tc := range msg.ToolCalls {
-				fn := tc.Function
-				args := fn.Arguments
-				if args == "" {
-					args = "{}"
-				}
-				tcTexts = append(tcTexts, "tool_call(id: "+tc.ID+", name: "+fn.Name+", args: "+args+")")
-			}
-			text := extractTextContent(msg.Content)
-			assistantLine := "ASSISTANT: "
-			if text != "" {
-				assistantLine += text + "\n"
+	if role == "assistant" && len(msg.ToolCalls) > 0 {
+		var tcTexts []string
+		for _, tc := range msg.ToolCalls {
+			fn := tc.Function
+			args := fn.Arguments
+			if args == "" {
+				args = "{}"
 			}
-			assistantLine += strings.Join(tcTexts, "\n")
-			lines = append(lines, assistantLine)
-			continue
+			tcTexts = append(tcTexts, "tool_call(id: "+tc.ID+", name: "+fn.Name+", args: "+args+")")
 		}
-
-		content := extractTextContent(msg.Content)
-		if content != "" {
-			lines = append(lines, strings.ToUpper(role)+": "+content)
+		body := extractTextContent(msg.Content)
+		if body != "" {
+			body += "\n"
 		}
+		return block{label: "ASSISTANT", body: body + strings.Join(tcTexts, "\n")}, true
 	}
 
-	if hasToolResults {
-		lines = append(lines, "The above tool calls have been executed. Continue your response based on these results.")
+	if content := extractTextContent(msg.Content); content != "" {
+		return block{label: labelSafe(strings.ToUpper(role)), body: content}, true
 	}
+	return block{}, false
+}
+
+// messageLine renders one message as it appears in the prompt, or "" if it
+// carries nothing to send. It is used to estimate a message's share of the
+// prompt.
+func messageLine(msg Message) string {
+	b, ok := messageBlock(msg)
+	if !ok {
+		return ""
+	}
+	return marker(placeholderBoundary, b.label) + "\n" + b.body
+}
+
+// formatInstructions tells the model how to shape its reply for
+// response_format.
+func formatInstructions(f *ResponseFormat) string {
+	if f.Type != "json_schema" || f.JSONSchema == nil {
+		return "Respond with a single JSON object and nothing else: no prose before or after it and no Markdown code fences."
+	}
+	s := f.JSONSchema
+	var b strings.Builder
+	b.WriteString("Respond with a single JSON value that conforms to the JSON Schema below, and nothing else: no prose before or after it and no Markdown code fences. Include every required property and no properties the schema does not allow.")
+	if s.Name != "" {
+		b.WriteString("\nSchema name: " + s.Name)
+	}
+	if s.Description != "" {
+		b.WriteString("\nPurpose: " + s.Description)
+	}
+	schema := string(s.Schema)
+	var indented bytes.Buffer
+	if json.Indent(&indented, s.Schema, "", "  ") == nil {
+		schema = indented.String()
+	}
+	b.WriteString("\nJSON Schema:\n" + schema)
+	return b.String()
+}
 
-	return strings.Join(lines, "\n\n")
+// FormatRetry extends a prompt after a reply failed response_format
+// validation, quoting the reply and what was wrong with it.
+func FormatRetry(prompt, reply, problem string) string {
+	prompt = AppendMessage(prompt, "assistant", reply)
+	return AppendMessage(prompt, "system", "That reply is not valid for the required response format: "+problem+
+		". Respond again with only the corrected JSON.")
 }
@@ -2,11 +2,54 @@ package translator
 
 import (
 	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// TestBuildPrompt_Golden renders each testdata/prompt/<case>.json, a request
+// plus an optional proxy system prompt, and compares it with <case>.txt.
+func TestBuildPrompt_Golden(t *testing.T) {
+	cases, err := filepath.Glob(filepath.Join("testdata", "prompt", "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, cases)
+	for _, path := range cases {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			var c struct {
+				SystemPrompt string                `json:"system_prompt"`
+				Request      ChatCompletionRequest `json:"request"`
+			}
+			require.NoError(t, json.Unmarshal(data, &c))
+			got := buildPrompt(t, WithSystemPrompt(c.Request, c.SystemPrompt)) + "\n"
+			golden := strings.TrimSuffix(path, ".json") + ".txt"
+			if *update {
+				require.NoError(t, os.WriteFile(golden, []byte(got), 0644))
+			}
+			want, err := os.ReadFile(golden)
+			require.NoError(t, err)
+			assert.Equal(t, string(want), got)
+		})
+	}
+}
+
+// buildPrompt is BuildPrompt for requests the built-in template must render.
+func buildPrompt(t *testing.T, req ChatCompletionRequest) string {
+	t.Helper()
+	prompt, err := BuildPrompt(req)
+	require.NoError(t, err)
+	return prompt
+}
+
 func TestBuildPrompt_SimpleMessages(t *testing.T) {
 	req := ChatCompletionRequest{
 		Model: "cursor/auto",
@@ -16,10 +59,10 @@ func TestBuildPrompt_SimpleMessages(t *testing.T) {
 			{Role: "user", Content: json.RawMessage(`"How are you?"`)},
 		},
 	}
-	prompt := BuildPrompt(req)
-	assert.Contains(t, prompt, "USER: Hello")
-	assert.Contains(t, prompt, "ASSISTANT: Hi there!")
-	assert.Contains(t, prompt, "USER: How are you?")
+	prompt := buildPrompt(t, req)
+	assert.Contains(t, prompt, " USER>>>\nHello")
+	assert.Contains(t, prompt, " ASSISTANT>>>\nHi there!")
+	assert.Contains(t, prompt, " USER>>>\nHow are you?")
 }
 
 func TestBuildPrompt_SystemMessage(t *testing.T) {
@@ -29,9 +72,9 @@ func TestBuildPrompt_SystemMessage(t *testing.T) {
 			{Role: "user", Content: json.RawMessage(`"Hi"`)},
 		},
 	}
-	prompt := BuildPrompt(req)
-	assert.Contains(t, prompt, "SYSTEM: You are helpful.")
-	assert.Contains(t, prompt, "USER: Hi")
+	prompt := buildPrompt(t, req)
+	assert.Contains(t, prompt, " SYSTEM>>>\nYou are helpful.")
+	assert.Contains(t, prompt, " USER>>>\nHi")
 }
 
 func TestBuildPrompt_ToolResult(t *testing.T) {
@@ -43,9 +86,9 @@ func TestBuildPrompt_ToolResult(t *testing.T) {
 			{Role: "tool", ToolCallID: "call_1", Content: json.RawMessage(`"file1.txt\nfile2.txt"`)},
 		},
 	}
-	prompt := BuildPrompt(req)
+	prompt := buildPrompt(t, req)
 	assert.Contains(t, prompt, "tool_call(id: call_1, name: bash, args:")
-	assert.Contains(t, prompt, "TOOL_RESULT (call_id: call_1): file1.txt")
+	assert.Contains(t, prompt, " TOOL_RESULT call_id=call_1>>>\nfile1.txt")
 	assert.Contains(t, prompt, "The above tool calls have been executed")
 }
 
@@ -65,7 +108,7 @@ func TestBuildPrompt_WithTools(t *testing.T) {
 			},
 		},
 	}
-	prompt := BuildPrompt(req)
+	prompt := buildPrompt(t, req)
 	assert.Contains(t, prompt, "You have access to the following tools")
 	assert.Contains(t, prompt, "- bash: Run bash command")
 }
@@ -79,3 +122,109 @@ func TestExtractTextContent_Array(t *testing.T) {
 	content := json.RawMessage(`[{"type":"text","text":"part1"},{"type":"text","text":"part2"}]`)
 	assert.Equal(t, "part1\npart2", extractTextContent(content))
 }
+
+func TestReasoningParams(t *testing.T) {
+	tests := []struct {
+		body     string
+		effort   string
+		thinking *bool
+		exclude  bool
+	}{
+		{`{}`, "", nil, false},
+		{`{"reasoning_effort":"high"}`, "high", nil, false},
+		{`{"reasoning":{"effort":"low","exclude":true}}`, "low", nil, true},
+		{`{"reasoning":{"enabled":false}}`, "", boolPtr(false), true},
+		{`{"thinking":{"type":"enabled","budget_tokens":2048}}`, "", boolPtr(true), false},
+		{`{"thinking":{"type":"disabled"}}`, "", boolPtr(false), true},
+	}
+	for _, tt := range tests {
+		var req ChatCompletionRequest
+		assert.NoError(t, json.Unmarshal([]byte(tt.body), &req))
+		assert.Equal(t, tt.effort, req.Effort(), tt.body)
+		assert.Equal(t, tt.thinking, req.ThinkingToggle(), tt.body)
+		assert.Equal(t, tt.exclude, req.ExcludeReasoning(), tt.body)
+	}
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestBuildPrompt_ResponseFormat(t *testing.T) {
+	req := ChatCompletionRequest{
+		Messages:       []Message{{Role: "user", Content: json.RawMessage(`"Classify"`)}},
+		ResponseFormat: &ResponseFormat{Type: "text"},
+	}
+	assert.Nil(t, req.StructuredOutput())
+	assert.True(t, strings.HasSuffix(buildPrompt(t, req), " USER>>>\nClassify"))
+
+	req.ResponseFormat = &ResponseFormat{Type: "json_object"}
+	assert.Contains(t, buildPrompt(t, req), " SYSTEM>>>\nRespond with a single JSON object and nothing else")
+	assert.False(t, req.StructuredOutput().Strict())
+
+	strict := true
+	req.ResponseFormat = &ResponseFormat{Type: "json_schema", JSONSchema: &JSONSchema{Name: "ticket", Schema: json.RawMessage(`{"type":"object"}`), Strict: &strict}}
+	prompt := buildPrompt(t, req)
+	assert.Contains(t, prompt, "Schema name: ticket\nJSON Schema:\n{\n  \"type\": \"object\"\n}")
+	assert.True(t, req.StructuredOutput().Strict())
+}
+
+func TestPrefill(t *testing.T) {
+	req := ChatCompletionRequest{Messages: []Message{text("user", "Write a haiku"), text("assistant", "Autumn moonlight—")}}
+	assert.Equal(t, "Autumn moonlight—", Prefill(req))
+	assert.Contains(t, buildPrompt(t, req), " SYSTEM>>>\nThe last ASSISTANT message is unfinished.")
+
+	req.Messages = append(req.Messages, text("user", "Another"))
+	assert.Equal(t, "", Prefill(req))
+	assert.NotContains(t, buildPrompt(t, req), "unfinished")
+
+	req.Messages = append(req.Messages, Message{Role: "assistant", ToolCalls: []ToolCall{{ID: "c1", Function: ToolCallFn{Name: "read"}}}})
+	assert.Equal(t, "", Prefill(req), "a tool call turn is not a prefill")
+}
+
+func TestStopAndCompletionLimit(t *testing.T) {
+	for body, want := range map[string]StopSequences{
+		`{"stop": "\n\n"}`:     {"\n\n"},
+		`{"stop": ["a", "b"]}`: {"a", "b"},
+		`{"stop": null}`:       nil,
+		`{"stop": ""}`:         nil,
+		`{"messages": []}`:     nil,
+	} {
+		var req ChatCompletionRequest
+		assert.NoError(t, json.Unmarshal([]byte(body), &req), body)
+		assert.Equal(t, want, req.Stop, body)
+	}
+	var req ChatCompletionRequest
+	assert.Error(t, json.Unmarshal([]byte(`{"stop": 3}`), &req))
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"max_tokens": 100, "max_completion_tokens": 50}`), &req))
+	assert.Equal(t, 50, req.CompletionLimit())
+	assert.Equal(t, 0, ChatCompletionRequest{}.CompletionLimit())
+}
+
+func TestReplaceAttachments(t *testing.T) {
+	var req ChatCompletionRequest
+	assert.NoError(t, json.Unmarshal([]byte(`{"messages":[
+		{"role":"user","content":"plain"},
+		{"role":"user","content":[
+			{"type":"text","text":"what is this?"},
+			{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}},
+			{"type":"file","file":{"file_data":"aGk=","filename":"notes.txt"}}]}]}`), &req))
+	assert.True(t, req.HasImages())
+
+	var saved []Attachment
+	out, err := ReplaceAttachments(req, func(a Attachment) (string, error) {
+		saved = append(saved, a)
+		return "scratch/" + a.Kind, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []Attachment{{Kind: "image", Ref: "data:image/png;base64,AAAA"}, {Kind: "file", Ref: "aGk=", Filename: "notes.txt"}}, saved)
+	assert.False(t, out.HasImages())
+	assert.True(t, req.HasImages(), "original is unchanged")
+	prompt := buildPrompt(t, out)
+	assert.Contains(t, prompt, "what is this?")
+	assert.Contains(t, prompt, "[Image attached: scratch/image (open this file to view it)]")
+	assert.Contains(t, prompt, "[File attached: notes.txt saved at scratch/file (read it as needed)]")
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"messages":[{"role":"user","content":[{"type":"file","file":{"file_id":"file-1"}}]}]}`), &req))
+	_, err = ReplaceAttachments(req, func(Attachment) (string, error) { return "", nil })
+	assert.ErrorContains(t, err, "file_id")
+}
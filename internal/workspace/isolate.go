@@ -0,0 +1,475 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Isolation modes.
+const (
+	IsolationOff     = "off"
+	IsolationRequest = "request"
+	IsolationSession = "session"
+)
+
+// Isolator creates throwaway copies of a workspace so concurrent agents don't
+// edit the same files: a detached git worktree for repositories, a plain copy
+// for everything else.
+type Isolator struct {
+	dir    string
+	maxAge time.Duration
+	mu     sync.Mutex
+	// MaxCopyFiles and MaxCopyBytes cap a plain copy; a bigger workspace
+	// fails to isolate instead of filling the disk. 0 means no cap.
+	MaxCopyFiles int
+	MaxCopyBytes int64
+}
+
+// copySkipDirs are left out of plain copies (and of their diffs).
+var copySkipDirs = map[string]bool{".git": true, "node_modules": true, ScratchDir: true}
+
+// Isolated is a workspace copy handed to cursor-agent.
+type Isolated struct {
+	// Source is the canonical workspace the copy was made from.
+	Source string
+	// Path is where cursor-agent runs (same relative position as Source).
+	Path string
+	// Root is the top of the copy (the worktree or copied directory).
+	Root string
+	Git  bool
+	// Reused is true when a session's existing copy was picked up again.
+	Reused bool
+
+	repoRoot string
+	// isoDir is the isolation directory, which plain copies skip.
+	isoDir string
+}
+
+// DefaultIsolationDir returns ~/.openclaw/cursor-worktrees.
+func DefaultIsolationDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "openclaw-cursor-worktrees")
+	}
+	return filepath.Join(home, ".openclaw", "cursor-worktrees")
+}
+
+// NewIsolator stores copies under dir (default location if empty). Copies
+// untouched for longer than maxAge are removed by CleanupStale.
+func NewIsolator(dir string, maxAge time.Duration) *Isolator {
+	if dir == "" {
+		dir = DefaultIsolationDir()
+	}
+	if maxAge <= 0 {
+		maxAge = 24 * time.Hour
+	}
+	return &Isolator{dir: ExpandHome(dir), maxAge: maxAge}
+}
+
+var unsafeKey = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// NewKey returns a random key for per-request isolation.
+func NewKey() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return "req-" + hex.EncodeToString(b)
+}
+
+// Acquire returns an isolated copy of source for key. Calling it again with
+// the same source and key reuses the existing copy (session mode).
+func (i *Isolator) Acquire(ctx context.Context, source, key string) (*Isolated, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(source))
+	name := hex.EncodeToString(sum[:4]) + "-" + strings.Trim(unsafeKey.ReplaceAllString(key, "_"), "_")
+	root := filepath.Join(i.dir, name)
+	iso := &Isolated{Source: source, Root: root, isoDir: canonicalDir(i.dir)}
+
+	repoRoot, err := gitOutput(ctx, source, "rev-parse", "--show-toplevel")
+	if err == nil {
+		iso.Git = true
+		iso.repoRoot = filepath.Clean(strings.TrimSpace(repoRoot))
+		if resolved, err := filepath.EvalSymlinks(iso.repoRoot); err == nil {
+			iso.repoRoot = resolved
+		}
+	}
+	iso.Path = root
+	if iso.Git {
+		if rel, err := filepath.Rel(iso.repoRoot, source); err == nil && rel != "." {
+			iso.Path = filepath.Join(root, rel)
+		}
+	}
+
+	if _, err := os.Stat(root); err == nil {
+		iso.Reused = true
+		now := time.Now()
+		os.Chtimes(root, now, now)
+		return iso, nil
+	}
+	if err := os.MkdirAll(i.dir, 0755); err != nil {
+		return nil, fmt.Errorf("isolation dir: %w", err)
+	}
+	if iso.Git {
+		if _, err := gitOutput(ctx, iso.repoRoot, "worktree", "add", "--detach", root, "HEAD"); err != nil {
+			return nil, fmt.Errorf("create worktree: %w", err)
+		}
+		if err := carryChanges(ctx, iso.repoRoot, root, iso.isoDir); err != nil {
+			i.remove(root)
+			return nil, fmt.Errorf("copy uncommitted changes: %w", err)
+		}
+	} else if err := i.copyTree(source, root, iso.isoDir); err != nil {
+		os.RemoveAll(root)
+		return nil, fmt.Errorf("copy workspace: %w", err)
+	} else if err := commitBaseline(ctx, root); err != nil {
+		os.RemoveAll(root)
+		return nil, fmt.Errorf("record workspace copy: %w", err)
+	}
+	return iso, nil
+}
+
+// Diff returns a unified diff of everything cursor-agent changed in the copy,
+// truncated to maxBytes when maxBytes > 0.
+func (iso *Isolated) Diff(ctx context.Context, maxBytes int) (string, error) {
+	var out string
+	var err error
+	if iso.Git || iso.hasBaseline() {
+		// Stage everything (including new files) in the throwaway worktree so
+		// the diff against HEAD is complete. Plain copies track ignored
+		// files too.
+		add := []string{"add", "-A"}
+		if !iso.Git {
+			add = append(add, "-f")
+		}
+		if _, err = gitOutput(ctx, iso.Root, add...); err != nil {
+			return "", err
+		}
+		out, err = gitOutput(ctx, iso.Root, "diff", "--cached", "HEAD")
+	} else {
+		out, err = diffNoIndex(ctx, iso.Source, iso.Root)
+		out = iso.dropSkipped(out)
+	}
+	if err != nil {
+		return "", err
+	}
+	if maxBytes > 0 && len(out) > maxBytes {
+		out = out[:maxBytes] + "\n... diff truncated ...\n"
+	}
+	return out, nil
+}
+
+// Release removes the copy unless keep is set.
+func (i *Isolator) Release(iso *Isolated, keep bool) error {
+	if keep {
+		return nil
+	}
+	return i.remove(iso.Root)
+}
+
+// CleanupStale removes copies that haven't been used for longer than maxAge.
+func (i *Isolator) CleanupStale() (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	entries, err := os.ReadDir(i.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	removed := 0
+	cutoff := time.Now().Add(-i.maxAge)
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !e.IsDir() || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := i.remove(filepath.Join(i.dir, e.Name())); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// remove deletes a copy; for worktrees it also prunes the source repository's
+// worktree metadata.
+func (i *Isolator) remove(root string) error {
+	var commonDir string
+	if b, err := os.ReadFile(filepath.Join(root, ".git")); err == nil {
+		gitdir := strings.TrimSpace(strings.TrimPrefix(string(b), "gitdir:"))
+		// gitdir is <repo>/.git/worktrees/<name>
+		commonDir = filepath.Dir(filepath.Dir(gitdir))
+	}
+	if err := os.RemoveAll(root); err != nil {
+		return err
+	}
+	if commonDir != "" {
+		exec.Command("git", "--git-dir", commonDir, "worktree", "prune").Run()
+	}
+	return nil
+}
+
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// carryChanges brings the repository's uncommitted work into a fresh
+// worktree (tracked changes and untracked, non-ignored files) and commits it
+// on the detached HEAD, so Diff only shows what the agent changes.
+func carryChanges(ctx context.Context, repo, root, isoDir string) error {
+	diff, err := gitOutput(ctx, repo, "diff", "HEAD", "--binary")
+	if err != nil {
+		return err
+	}
+	if diff != "" {
+		cmd := exec.CommandContext(ctx, "git", "-C", root, "apply", "--binary", "--whitespace=nowarn", "-")
+		cmd.Stdin = strings.NewReader(diff)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("git apply: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+	}
+	untracked, err := gitOutput(ctx, repo, "ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return err
+	}
+	for _, rel := range strings.Split(untracked, "\x00") {
+		p := filepath.Join(repo, filepath.FromSlash(rel))
+		if rel == "" || Within(p, isoDir) {
+			continue
+		}
+		info, err := os.Lstat(p)
+		if err != nil {
+			continue
+		}
+		target := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			if link, ok := copiedLink(p, repo, root); ok {
+				if err := os.Symlink(link, target); err != nil {
+					return err
+				}
+			}
+		case info.Mode().IsRegular():
+			if err := copyFile(p, target, info.Mode().Perm()); err != nil {
+				return err
+			}
+		}
+	}
+	if diff == "" && untracked == "" {
+		return nil
+	}
+	return commitAll(ctx, root, "openclaw-cursor: uncommitted changes", "-A")
+}
+
+// commitBaseline records a plain copy in a git repository of its own, so
+// Diff shows what the agent changed even if the source changes meanwhile
+// (as when the source is another copy with an agent at work).
+func commitBaseline(ctx context.Context, root string) error {
+	if _, err := gitOutput(ctx, root, "init", "-q"); err != nil {
+		return err
+	}
+	return commitAll(ctx, root, "openclaw-cursor: workspace copy", "-A", "-f")
+}
+
+// hasBaseline reports whether a plain copy has its baseline repository.
+// Copies made before baselines existed are diffed against the source.
+func (iso *Isolated) hasBaseline() bool {
+	info, err := os.Stat(filepath.Join(iso.Root, ".git"))
+	return !iso.Git && err == nil && info.IsDir()
+}
+
+// commitAll stages files in root with git add addArgs and commits them
+// under the proxy's name, skipping hooks and signing.
+func commitAll(ctx context.Context, root, msg string, addArgs ...string) error {
+	if _, err := gitOutput(ctx, root, append([]string{"add"}, addArgs...)...); err != nil {
+		return err
+	}
+	_, err := gitOutput(ctx, root, "-c", "user.name=openclaw-cursor", "-c", "user.email=openclaw-cursor@localhost",
+		"-c", "commit.gpgsign=false", "commit", "-q", "--no-verify", "--allow-empty", "-m", msg)
+	return err
+}
+
+// copiedLink returns what the copy of symlink p (inside src) should point
+// at in dst. Absolute links into src are redirected into dst; links that
+// resolve outside src are left out (ok false) so the copy can't reach back
+// into the real workspace.
+func copiedLink(p, src, dst string) (string, bool) {
+	link, err := os.Readlink(p)
+	if err != nil {
+		return "", false
+	}
+	target := link
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(p), target)
+	}
+	if resolved, err := filepath.EvalSymlinks(target); err == nil {
+		target = resolved
+	}
+	rel, err := filepath.Rel(src, filepath.Clean(target))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if !filepath.IsAbs(link) {
+		return link, true
+	}
+	pRel, err := filepath.Rel(src, filepath.Dir(p))
+	if err != nil {
+		return "", false
+	}
+	link, err = filepath.Rel(filepath.Join(dst, pRel), filepath.Join(dst, rel))
+	return link, err == nil
+}
+
+// diffNoIndex diffs two plain directories with git and rewrites the absolute
+// paths in the headers to be relative to the workspace.
+func diffNoIndex(ctx context.Context, from, to string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "diff", "--no-index", "--", from, to)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		err = nil // exit 1 means "differences found"
+	}
+	if err != nil {
+		return "", fmt.Errorf("git diff --no-index: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	// git drops the leading slash when it prefixes absolute paths.
+	out := strings.ReplaceAll(stdout.String(), "a/"+strings.TrimPrefix(from, "/")+"/", "a/")
+	out = strings.ReplaceAll(out, "b/"+strings.TrimPrefix(to, "/")+"/", "b/")
+	return out, nil
+}
+
+// canonicalDir resolves symlinks in dir as far as it exists.
+func canonicalDir(dir string) string {
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		return resolved
+	}
+	return filepath.Clean(dir)
+}
+
+// skipCopy reports whether a plain copy leaves out the directory p: the
+// isolation directory itself (the workspace may contain it, e.g. $HOME),
+// VCS metadata, dependencies and scratch files.
+func skipCopy(p, name, isoDir string) bool {
+	return copySkipDirs[name] || p == isoDir
+}
+
+// copyTree copies src to dst for a non-git workspace, within the copy caps.
+func (i *Isolator) copyTree(src, dst, isoDir string) error {
+	files, size := 0, int64(0)
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && p != src && skipCopy(p, d.Name(), isoDir) {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			files++
+			size += info.Size()
+			if i.MaxCopyFiles > 0 && files > i.MaxCopyFiles {
+				return fmt.Errorf("workspace has more than %d files to copy; isolate a git repository or raise isolation.max_copy_files", i.MaxCopyFiles)
+			}
+			if i.MaxCopyBytes > 0 && size > i.MaxCopyBytes {
+				return fmt.Errorf("workspace has more than %d bytes to copy; isolate a git repository or raise isolation.max_copy_bytes", i.MaxCopyBytes)
+			}
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case d.Type()&fs.ModeSymlink != 0:
+			if link, ok := copiedLink(p, src, dst); ok {
+				return os.Symlink(link, target)
+			}
+		case d.Type().IsRegular():
+			return copyFile(p, target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+// dropSkipped removes the diff sections of paths a plain copy left out,
+// which would otherwise show up as deleted.
+func (iso *Isolated) dropSkipped(diff string) string {
+	sections := strings.SplitAfter(diff, "\n")
+	var b strings.Builder
+	keep := true
+	for _, line := range sections {
+		if strings.HasPrefix(line, "diff --git a/") {
+			rel := strings.TrimPrefix(line, "diff --git a/")
+			if j := strings.Index(rel, " b/"); j >= 0 {
+				rel = rel[:j]
+			}
+			keep = !iso.skippedPath(rel)
+		}
+		if keep {
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
+
+// skippedPath reports whether rel (relative to the source) lies in a
+// directory the copy skipped.
+func (iso *Isolated) skippedPath(rel string) bool {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for k := range parts[:len(parts)-1] {
+		dir := filepath.Join(iso.Source, filepath.Join(parts[:k+1]...))
+		if skipCopy(dir, parts[k], iso.isoDir) {
+			return true
+		}
+	}
+	return false
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
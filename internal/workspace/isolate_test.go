@@ -0,0 +1,255 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func initRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "user.name", "test"},
+	} {
+		require.NoError(t, exec.Command("git", append([]string{"-C", dir}, args...)...).Run())
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644))
+	require.NoError(t, exec.Command("git", "-C", dir, "add", ".").Run())
+	require.NoError(t, exec.Command("git", "-C", dir, "commit", "-qm", "init").Run())
+	return dir
+}
+
+func TestIsolator_GitWorktree(t *testing.T) {
+	repo := initRepo(t)
+	ctx := context.Background()
+	iso := NewIsolator(t.TempDir(), time.Hour)
+
+	w, err := iso.Acquire(ctx, repo, NewKey())
+	require.NoError(t, err)
+	assert.True(t, w.Git)
+	assert.NotEqual(t, repo, w.Path)
+
+	require.NoError(t, os.WriteFile(filepath.Join(w.Path, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(w.Path, "new.txt"), []byte("hello\n"), 0644))
+
+	diff, err := w.Diff(ctx, 0)
+	require.NoError(t, err)
+	assert.Contains(t, diff, "+func main() {}")
+	assert.Contains(t, diff, "b/new.txt")
+
+	// The source repository is untouched.
+	src, _ := os.ReadFile(filepath.Join(repo, "main.go"))
+	assert.Equal(t, "package main\n", string(src))
+	_, err = os.Stat(filepath.Join(repo, "new.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	require.NoError(t, iso.Release(w, false))
+	_, err = os.Stat(w.Root)
+	assert.True(t, os.IsNotExist(err))
+	out, _ := exec.Command("git", "-C", repo, "worktree", "list").Output()
+	assert.NotContains(t, string(out), w.Root)
+}
+
+func TestIsolator_SessionReuse(t *testing.T) {
+	repo := initRepo(t)
+	ctx := context.Background()
+	iso := NewIsolator(t.TempDir(), time.Hour)
+
+	first, err := iso.Acquire(ctx, repo, "session/42")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(first.Path, "notes.md"), []byte("x"), 0644))
+
+	second, err := iso.Acquire(ctx, repo, "session/42")
+	require.NoError(t, err)
+	assert.True(t, second.Reused)
+	assert.Equal(t, first.Root, second.Root)
+	assert.FileExists(t, filepath.Join(second.Path, "notes.md"))
+}
+
+func TestIsolator_PlainCopy(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	src, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("one\n"), 0644))
+	ctx := context.Background()
+	iso := NewIsolator(t.TempDir(), time.Hour)
+
+	w, err := iso.Acquire(ctx, src, NewKey())
+	require.NoError(t, err)
+	assert.False(t, w.Git)
+	require.NoError(t, os.WriteFile(filepath.Join(w.Path, "a.txt"), []byte("two\n"), 0644))
+
+	diff, err := w.Diff(ctx, 0)
+	require.NoError(t, err)
+	assert.Contains(t, diff, "a/a.txt")
+	assert.Contains(t, diff, "-one")
+	assert.Contains(t, diff, "+two")
+	assert.NotContains(t, diff, src)
+}
+
+func TestIsolator_PlainCopyDiffsAgainstCopyTime(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	src, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("one\n"), 0644))
+	ctx := context.Background()
+	w, err := NewIsolator(t.TempDir(), time.Hour).Acquire(ctx, src, NewKey())
+	require.NoError(t, err)
+
+	// The source moves on; only the copy's own edits are reported.
+	require.NoError(t, os.WriteFile(filepath.Join(src, "b.txt"), []byte("source\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(w.Path, "c.txt"), []byte("agent\n"), 0644))
+	diff, err := w.Diff(ctx, 0)
+	require.NoError(t, err)
+	assert.Contains(t, diff, "b/c.txt")
+	assert.NotContains(t, diff, "b.txt")
+	assert.NotContains(t, diff, "a.txt")
+}
+
+func TestIsolator_CleanupStale(t *testing.T) {
+	repo := initRepo(t)
+	iso := NewIsolator(t.TempDir(), time.Minute)
+	w, err := iso.Acquire(context.Background(), repo, NewKey())
+	require.NoError(t, err)
+
+	n, err := iso.CleanupStale()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(w.Root, old, old))
+	n, err = iso.CleanupStale()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = os.Stat(w.Root)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestIsolator_PlainCopySkipsIsolationDir(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	src, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("one\n"), 0644))
+	for _, dir := range []string{"node_modules/pkg", ".git", ScratchDir} {
+		require.NoError(t, os.MkdirAll(filepath.Join(src, dir), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(src, dir, "f"), []byte("x\n"), 0644))
+	}
+	// The isolation dir lives inside the workspace, as when it is $HOME.
+	ctx := context.Background()
+	iso := NewIsolator(filepath.Join(src, ".openclaw", "cursor-worktrees"), time.Hour)
+
+	w, err := iso.Acquire(ctx, src, NewKey())
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(w.Path, "a.txt"))
+	for _, dir := range []string{"node_modules", ScratchDir, ".openclaw/cursor-worktrees"} {
+		assert.NoDirExists(t, filepath.Join(w.Path, dir))
+	}
+	// .git in the copy is its own baseline, not the source's.
+	assert.NoFileExists(t, filepath.Join(w.Path, ".git", "f"))
+
+	diff, err := w.Diff(ctx, 0)
+	require.NoError(t, err)
+	assert.NotContains(t, diff, "node_modules")
+	assert.NotContains(t, diff, "cursor-worktrees")
+	assert.NotContains(t, diff, ScratchDir)
+}
+
+func TestIsolator_PlainCopyCaps(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	src := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(src, name), []byte("0123456789"), 0644))
+	}
+	ctx := context.Background()
+
+	iso := NewIsolator(t.TempDir(), time.Hour)
+	iso.MaxCopyFiles = 2
+	_, err := iso.Acquire(ctx, src, "files")
+	assert.ErrorContains(t, err, "more than 2 files")
+
+	iso = NewIsolator(t.TempDir(), time.Hour)
+	iso.MaxCopyBytes = 25
+	_, err = iso.Acquire(ctx, src, "bytes")
+	assert.ErrorContains(t, err, "more than 25 bytes")
+	entries, _ := os.ReadDir(iso.dir)
+	assert.Empty(t, entries, "a failed copy is removed")
+
+	iso.MaxCopyBytes = 30
+	_, err = iso.Acquire(ctx, src, "bytes")
+	assert.NoError(t, err)
+}
+
+func TestIsolator_GitWorktreeCarriesUncommittedChanges(t *testing.T) {
+	repo := initRepo(t)
+	ctx := context.Background()
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main // edited\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "draft.txt"), []byte("draft\n"), 0644))
+	iso := NewIsolator(t.TempDir(), time.Hour)
+
+	w, err := iso.Acquire(ctx, repo, NewKey())
+	require.NoError(t, err)
+	got, _ := os.ReadFile(filepath.Join(w.Path, "main.go"))
+	assert.Equal(t, "package main // edited\n", string(got))
+	assert.FileExists(t, filepath.Join(w.Path, "draft.txt"))
+
+	// Only the agent's own edits show up in the diff.
+	require.NoError(t, os.WriteFile(filepath.Join(w.Path, "new.txt"), []byte("hello\n"), 0644))
+	diff, err := w.Diff(ctx, 0)
+	require.NoError(t, err)
+	assert.Contains(t, diff, "b/new.txt")
+	assert.NotContains(t, diff, "draft.txt")
+	assert.NotContains(t, diff, "main.go")
+
+	// The source repository's history is untouched.
+	out, err := exec.Command("git", "-C", repo, "rev-list", "--count", "HEAD").Output()
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", string(out))
+	require.NoError(t, iso.Release(w, false))
+}
+
+func TestIsolator_PlainCopySymlinks(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	src, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	outside, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("one\n"), 0644))
+	require.NoError(t, os.Symlink(filepath.Join(src, "a.txt"), filepath.Join(src, "sub", "abs")))
+	require.NoError(t, os.Symlink("../a.txt", filepath.Join(src, "sub", "rel")))
+	require.NoError(t, os.Symlink(outside, filepath.Join(src, "escape")))
+	iso := NewIsolator(t.TempDir(), time.Hour)
+
+	w, err := iso.Acquire(context.Background(), src, NewKey())
+	require.NoError(t, err)
+	for _, name := range []string{"abs", "rel"} {
+		resolved, err := filepath.EvalSymlinks(filepath.Join(w.Path, "sub", name))
+		require.NoError(t, err, name)
+		assert.Equal(t, filepath.Join(w.Path, "a.txt"), resolved, name)
+	}
+	_, err = os.Lstat(filepath.Join(w.Path, "escape"))
+	assert.True(t, os.IsNotExist(err), "links out of the workspace are left out")
+}
@@ -0,0 +1,211 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lock policies.
+const (
+	LockOff        = "off"
+	LockSerialize  = "serialize"
+	LockReject     = "reject"
+	LockSharedRead = "shared-read"
+)
+
+// Access levels a request can ask for.
+const (
+	AccessWrite = "write"
+	AccessRead  = "read"
+)
+
+// ErrBusy is returned under the reject policy when the workspace is held.
+var ErrBusy = errors.New("workspace busy")
+
+// Holder describes a request holding (or waiting for) a workspace lock.
+type Holder struct {
+	ID     string    `json:"id"`
+	Model  string    `json:"model,omitempty"`
+	Access string    `json:"access"`
+	Since  time.Time `json:"since"`
+}
+
+// LockInfo is the state of one workspace lock, for the admin endpoint.
+type LockInfo struct {
+	Workspace string   `json:"workspace"`
+	Holders   []Holder `json:"holders"`
+	Waiting   int      `json:"waiting"`
+}
+
+type lockState struct {
+	holders        map[string]Holder
+	writer         bool
+	waiting        int
+	writersWaiting int
+	changed        chan struct{}
+}
+
+// LockManager serializes agents working in the same directory, keyed by the
+// canonical workspace path.
+type LockManager struct {
+	mode  string
+	mu    sync.Mutex
+	locks map[string]*lockState
+}
+
+// LockKey returns the path dir's lock is keyed on, so agents started in
+// nested directories of one repository share a lock: the git top-level when
+// dir is inside one, else the canonical dir.
+func LockKey(ctx context.Context, dir string) string {
+	if top, err := gitOutput(ctx, dir, "rev-parse", "--show-toplevel"); err == nil {
+		if key, err := Canonicalize(strings.TrimSpace(top), ""); err == nil {
+			return key
+		}
+	}
+	if key, err := Canonicalize(dir, ""); err == nil {
+		return key
+	}
+	return filepath.Clean(dir)
+}
+
+// NewLockManager creates a lock manager with the given policy.
+func NewLockManager(mode string) (*LockManager, error) {
+	switch mode {
+	case "":
+		mode = LockOff
+	case LockOff, LockSerialize, LockReject, LockSharedRead:
+	default:
+		return nil, fmt.Errorf("unknown workspace lock policy %q", mode)
+	}
+	return &LockManager{mode: mode, locks: make(map[string]*lockState)}, nil
+}
+
+// Acquire takes the lock for path and returns its release function. Under
+// serialize and shared-read it waits until the lock is free or ctx is done;
+// under reject it fails with ErrBusy. Read access is only shared under
+// shared-read; every other policy treats reads as writes.
+func (m *LockManager) Acquire(ctx context.Context, path string, h Holder) (func(), error) {
+	if m == nil || m.mode == LockOff {
+		return func() {}, nil
+	}
+	write := h.Access != AccessRead || m.mode != LockSharedRead
+	if h.Access == "" {
+		h.Access = AccessWrite
+	}
+
+	m.mu.Lock()
+	st := m.locks[path]
+	if st == nil {
+		st = &lockState{holders: make(map[string]Holder), changed: make(chan struct{})}
+		m.locks[path] = st
+	}
+	waited := false
+	for !st.canTake(write, waited) {
+		if m.mode == LockReject {
+			m.mu.Unlock()
+			return nil, fmt.Errorf("%w: %s", ErrBusy, path)
+		}
+		if !waited {
+			waited = true
+			st.waiting++
+			if write {
+				st.writersWaiting++
+			}
+		}
+		ch := st.changed
+		m.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			m.mu.Lock()
+			st.waiting--
+			if write {
+				st.writersWaiting--
+			}
+			m.gc(path, st)
+			m.mu.Unlock()
+			return nil, ctx.Err()
+		case <-ch:
+		}
+		m.mu.Lock()
+	}
+	if waited {
+		st.waiting--
+		if write {
+			st.writersWaiting--
+		}
+	}
+	if h.Since.IsZero() {
+		h.Since = time.Now()
+	}
+	st.holders[h.ID] = h
+	st.writer = write
+	m.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			delete(st.holders, h.ID)
+			if len(st.holders) == 0 {
+				st.writer = false
+			}
+			close(st.changed)
+			st.changed = make(chan struct{})
+			m.gc(path, st)
+		})
+	}, nil
+}
+
+// canTake reports whether a new holder can enter. Readers queue behind
+// waiting writers so writers aren't starved; a waiting writer itself only
+// needs the lock to be empty.
+func (st *lockState) canTake(write, waiting bool) bool {
+	if len(st.holders) == 0 {
+		return true
+	}
+	if write || st.writer {
+		return false
+	}
+	return st.writersWaiting == 0 || waiting
+}
+
+func (m *LockManager) gc(path string, st *lockState) {
+	if len(st.holders) == 0 && st.waiting == 0 && m.locks[path] == st {
+		delete(m.locks, path)
+	}
+}
+
+// Mode returns the configured policy.
+func (m *LockManager) Mode() string {
+	if m == nil {
+		return LockOff
+	}
+	return m.mode
+}
+
+// Locks returns current holders and waiters per workspace, sorted by path.
+func (m *LockManager) Locks() []LockInfo {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]LockInfo, 0, len(m.locks))
+	for path, st := range m.locks {
+		info := LockInfo{Workspace: path, Waiting: st.waiting, Holders: make([]Holder, 0, len(st.holders))}
+		for _, h := range st.holders {
+			info.Holders = append(info.Holders, h)
+		}
+		sort.Slice(info.Holders, func(i, j int) bool { return info.Holders[i].Since.Before(info.Holders[j].Since) })
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Workspace < out[j].Workspace })
+	return out
+}
@@ -0,0 +1,131 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockManager_Serialize(t *testing.T) {
+	m, err := NewLockManager(LockSerialize)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	release, err := m.Acquire(ctx, "/w", Holder{ID: "a"})
+	require.NoError(t, err)
+
+	acquired := make(chan struct{})
+	go func() {
+		rel, err := m.Acquire(ctx, "/w", Holder{ID: "b"})
+		if err == nil {
+			close(acquired)
+			rel()
+		}
+	}()
+
+	require.Eventually(t, func() bool {
+		locks := m.Locks()
+		return len(locks) == 1 && locks[0].Waiting == 1
+	}, time.Second, 5*time.Millisecond)
+	select {
+	case <-acquired:
+		t.Fatal("second holder acquired while first held the lock")
+	default:
+	}
+
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("second holder never acquired the lock")
+	}
+	require.Eventually(t, func() bool { return len(m.Locks()) == 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestLockManager_Reject(t *testing.T) {
+	m, err := NewLockManager(LockReject)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	release, err := m.Acquire(ctx, "/w", Holder{ID: "a", Model: "auto"})
+	require.NoError(t, err)
+	_, err = m.Acquire(ctx, "/w", Holder{ID: "b"})
+	assert.ErrorIs(t, err, ErrBusy)
+
+	// Different workspaces don't conflict.
+	other, err := m.Acquire(ctx, "/other", Holder{ID: "c"})
+	require.NoError(t, err)
+	other()
+
+	locks := m.Locks()
+	require.Len(t, locks, 1)
+	assert.Equal(t, "a", locks[0].Holders[0].ID)
+	assert.Equal(t, AccessWrite, locks[0].Holders[0].Access)
+
+	release()
+	release() // idempotent
+	_, err = m.Acquire(ctx, "/w", Holder{ID: "b"})
+	assert.NoError(t, err)
+}
+
+func TestLockManager_SharedRead(t *testing.T) {
+	m, err := NewLockManager(LockSharedRead)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	r1, err := m.Acquire(ctx, "/w", Holder{ID: "r1", Access: AccessRead})
+	require.NoError(t, err)
+	r2, err := m.Acquire(ctx, "/w", Holder{ID: "r2", Access: AccessRead})
+	require.NoError(t, err)
+	assert.Len(t, m.Locks()[0].Holders, 2)
+
+	// A writer waits for the readers.
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = m.Acquire(short, "/w", Holder{ID: "w"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	r1()
+	r2()
+	w, err := m.Acquire(ctx, "/w", Holder{ID: "w"})
+	require.NoError(t, err)
+	w()
+}
+
+func TestLockManager_Off(t *testing.T) {
+	m, err := NewLockManager("")
+	require.NoError(t, err)
+	a, err := m.Acquire(context.Background(), "/w", Holder{ID: "a"})
+	require.NoError(t, err)
+	b, err := m.Acquire(context.Background(), "/w", Holder{ID: "b"})
+	require.NoError(t, err)
+	a()
+	b()
+	assert.Empty(t, m.Locks())
+
+	_, err = NewLockManager("optimistic")
+	assert.Error(t, err)
+}
+
+func TestLockKey(t *testing.T) {
+	ctx := context.Background()
+
+	repo := initRepo(t)
+	nested := filepath.Join(repo, "cmd", "tool")
+	require.NoError(t, os.MkdirAll(nested, 0755))
+	assert.Equal(t, repo, LockKey(ctx, nested))
+	assert.Equal(t, repo, LockKey(ctx, repo))
+
+	// Outside git each directory is its own lock.
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	sub := filepath.Join(root, "project", "src")
+	require.NoError(t, os.MkdirAll(sub, 0755))
+	assert.Equal(t, sub, LockKey(ctx, sub))
+	assert.Equal(t, sub, LockKey(ctx, filepath.Join(sub, "..", "src")))
+}
@@ -0,0 +1,154 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ScratchDir is the directory inside a workspace where the proxy leaves
+// files for cursor-agent to read (decoded attachments and the like). It
+// ignores itself for git, and snapshots skip it.
+const ScratchDir = ".openclaw-cursor"
+
+// Scratch is one directory under ScratchDir.
+type Scratch struct {
+	workspace string
+	// Dir is the absolute path of the directory.
+	Dir string
+}
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// ScratchPath is the path of scratch directory name relative to the
+// workspace, as NewScratch creates it.
+func ScratchPath(name string) string {
+	return filepath.Join(ScratchDir, SafeName(name))
+}
+
+// NewScratch creates <workspace>/.openclaw-cursor/<name>, or marks an
+// existing one as just used (see PruneScratch).
+func NewScratch(workspace, name string) (*Scratch, error) {
+	base := filepath.Join(workspace, ScratchDir)
+	if err := os.MkdirAll(base, 0o755); err != nil {
+		return nil, fmt.Errorf("create scratch dir: %w", err)
+	}
+	ignore := filepath.Join(base, ".gitignore")
+	if _, err := os.Stat(ignore); os.IsNotExist(err) {
+		_ = os.WriteFile(ignore, []byte("*\n"), 0o644)
+	}
+	dir := filepath.Join(base, SafeName(name))
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create scratch dir: %w", err)
+	}
+	now := time.Now()
+	_ = os.Chtimes(dir, now, now)
+	return &Scratch{workspace: workspace, Dir: dir}, nil
+}
+
+// SafeName reduces name to characters that are safe in a file name.
+func SafeName(name string) string {
+	name = strings.Trim(unsafeName.ReplaceAllString(filepath.Base(name), "_"), "._")
+	if name == "" {
+		return "file"
+	}
+	return name
+}
+
+// Write stores data as name (made safe and unique within the directory) and
+// returns its path relative to the workspace.
+func (s *Scratch) Write(name string, data []byte) (string, error) {
+	name = SafeName(name)
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	path := filepath.Join(s.Dir, name)
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			break
+		}
+		path = filepath.Join(s.Dir, fmt.Sprintf("%s-%d%s", stem, i, ext))
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(s.workspace, path)
+	if err != nil {
+		return path, nil
+	}
+	return rel, nil
+}
+
+// Put stores data as name (made safe), replacing any file of that name, and
+// returns its path relative to the workspace.
+func (s *Scratch) Put(name string, data []byte) (string, error) {
+	path := filepath.Join(s.Dir, SafeName(name))
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(s.workspace, path)
+	if err != nil {
+		return path, nil
+	}
+	return rel, nil
+}
+
+// CopyScratch copies the scratch files of workspace from into workspace to,
+// so an agent running in another copy finds the same attachments and tool
+// results.
+func CopyScratch(from, to string) error {
+	src := filepath.Join(from, ScratchDir)
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+	return (&Isolator{}).copyTree(src, filepath.Join(to, ScratchDir), "")
+}
+
+// Remove deletes the directory, and ScratchDir too once nothing else is in it.
+func (s *Scratch) Remove() error {
+	if err := os.RemoveAll(s.Dir); err != nil {
+		return err
+	}
+	removeIfEmpty(filepath.Dir(s.Dir))
+	return nil
+}
+
+// PruneScratch removes the scratch directories of workspace whose names
+// start with prefix and that have not been used for maxAge.
+func PruneScratch(workspace, prefix string, maxAge time.Duration) (int, error) {
+	base := filepath.Join(workspace, ScratchDir)
+	entries, err := os.ReadDir(base)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-maxAge)
+	n := 0
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), prefix) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(base, e.Name())); err != nil {
+			return n, err
+		}
+		n++
+	}
+	removeIfEmpty(base)
+	return n, nil
+}
+
+// removeIfEmpty removes ScratchDir once only its .gitignore is left.
+func removeIfEmpty(base string) {
+	if entries, err := os.ReadDir(base); err == nil && len(entries) == 1 && entries[0].Name() == ".gitignore" {
+		_ = os.Remove(filepath.Join(base, ".gitignore"))
+		_ = os.Remove(base)
+	}
+}
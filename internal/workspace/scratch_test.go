@@ -0,0 +1,98 @@
+package workspace
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScratch(t *testing.T) {
+	ws := t.TempDir()
+	if _, err := exec.LookPath("git"); err == nil {
+		require.NoError(t, exec.Command("git", "-C", ws, "init", "-q").Run())
+	}
+	s, err := NewScratch(ws, "req/../1")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(ws, ScratchDir, "1"), s.Dir)
+
+	a, err := s.Write("../../etc/passwd", []byte("x"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(ScratchDir, "1", "passwd"), a)
+	b, err := s.Write("passwd", []byte("y"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(ScratchDir, "1", "passwd-2"), b)
+	data, err := os.ReadFile(filepath.Join(ws, b))
+	require.NoError(t, err)
+	assert.Equal(t, "y", string(data))
+	assert.Equal(t, "screen_shot_1_.png", SafeName("screen shot (1).png"))
+
+	if _, err := exec.LookPath("git"); err == nil {
+		out, err := exec.Command("git", "-C", ws, "status", "--porcelain").Output()
+		require.NoError(t, err)
+		assert.False(t, strings.Contains(string(out), ScratchDir), "scratch files must be git-ignored")
+	}
+
+	other := t.TempDir()
+	require.NoError(t, CopyScratch(ws, other))
+	data, err = os.ReadFile(filepath.Join(other, b))
+	require.NoError(t, err)
+	assert.Equal(t, "y", string(data))
+	assert.NoError(t, CopyScratch(t.TempDir(), t.TempDir()), "nothing to copy")
+
+	require.NoError(t, s.Remove())
+	_, err = os.Stat(filepath.Join(ws, ScratchDir))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPruneScratch(t *testing.T) {
+	ws := t.TempDir()
+	old, err := NewScratch(ws, "session-old")
+	require.NoError(t, err)
+	p, err := old.Put("tool-call_1.txt", []byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(ScratchPath("session-old"), "tool-call_1.txt"), p)
+	p, err = old.Put("tool-call_1.txt", []byte("b"))
+	require.NoError(t, err)
+	data, _ := os.ReadFile(filepath.Join(ws, p))
+	assert.Equal(t, "b", string(data), "Put replaces")
+
+	fresh, err := NewScratch(ws, "session-new")
+	require.NoError(t, err)
+	req, err := NewScratch(ws, "req-1")
+	require.NoError(t, err)
+	stale := time.Now().Add(-2 * time.Hour)
+	for _, dir := range []string{old.Dir, req.Dir} {
+		require.NoError(t, os.Chtimes(dir, stale, stale))
+	}
+
+	n, err := PruneScratch(ws, "session-", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoDirExists(t, old.Dir)
+	assert.DirExists(t, fresh.Dir)
+	assert.DirExists(t, req.Dir, "other prefixes are left alone")
+
+	// Reusing a directory marks it as used.
+	require.NoError(t, os.Chtimes(fresh.Dir, stale, stale))
+	_, err = NewScratch(ws, "session-new")
+	require.NoError(t, err)
+	n, err = PruneScratch(ws, "session-", time.Hour)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	require.NoError(t, os.RemoveAll(req.Dir))
+	require.NoError(t, os.Chtimes(fresh.Dir, stale, stale))
+	_, err = PruneScratch(ws, "session-", time.Hour)
+	require.NoError(t, err)
+	assert.NoDirExists(t, filepath.Join(ws, ScratchDir))
+
+	n, err = PruneScratch(t.TempDir(), "session-", time.Hour)
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+}
@@ -0,0 +1,134 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrForbidden is returned when a requested workspace lies outside the
+// configured roots.
+var ErrForbidden = errors.New("workspace outside allowed roots")
+
+// ErrInvalid is returned when a workspace fails the existence or git checks.
+var ErrInvalid = errors.New("invalid workspace")
+
+// Policy restricts which directories cursor-agent may be pointed at.
+type Policy struct {
+	// Roots are the allowed workspace roots. Empty means unrestricted.
+	Roots []string
+	// RequireExists rejects directories that don't exist.
+	RequireExists bool
+	// RequireGit rejects directories that aren't inside a git work tree.
+	RequireGit bool
+}
+
+// ExpandHome resolves a leading ~ or ~/ to the user's home directory.
+func ExpandHome(p string) string {
+	if p == "" || p[0] != '~' {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	if len(p) == 1 || p[1] == '/' {
+		return filepath.Join(home, p[1:])
+	}
+	// ~user form - not supported, return as-is
+	return p
+}
+
+// Canonicalize returns the absolute, cleaned, symlink-free form of p.
+// Relative paths are resolved against base. Missing trailing components are
+// kept as-is after resolving the longest existing prefix, so a symlinked
+// parent can't be used to escape a root either.
+func Canonicalize(p, base string) (string, error) {
+	p = ExpandHome(strings.TrimSpace(p))
+	if p == "" {
+		return "", fmt.Errorf("%w: empty path", ErrInvalid)
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(base, p)
+	}
+	p, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+
+	existing, rest := p, ""
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return p, nil
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+}
+
+// Within reports whether path is root or a descendant of it. Both must be
+// canonical.
+func Within(path, root string) bool {
+	if path == root {
+		return true
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// Resolve canonicalizes a requested workspace and checks it against the policy.
+// base is used for relative paths (normally the default workspace).
+func (p Policy) Resolve(requested, base string) (string, error) {
+	path, err := Canonicalize(requested, base)
+	if err != nil {
+		return "", err
+	}
+	if len(p.Roots) > 0 {
+		allowed := false
+		for _, r := range p.Roots {
+			root, err := Canonicalize(r, base)
+			if err != nil {
+				continue
+			}
+			if Within(path, root) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "", fmt.Errorf("%w: %s", ErrForbidden, path)
+		}
+	}
+	if p.RequireExists || p.RequireGit {
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			return "", fmt.Errorf("%w: %s is not a directory", ErrInvalid, path)
+		}
+	}
+	if p.RequireGit && !IsGitRepo(path) {
+		return "", fmt.Errorf("%w: %s is not a git repository", ErrInvalid, path)
+	}
+	return path, nil
+}
+
+// IsGitRepo reports whether dir is inside a git work tree.
+func IsGitRepo(dir string) bool {
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return true
+		}
+		if filepath.Dir(d) == d {
+			return false
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_Resolve(t *testing.T) {
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	root := filepath.Join(tmp, "dev")
+	project := filepath.Join(root, "project")
+	repo := filepath.Join(root, "repo")
+	secret := filepath.Join(tmp, "secret")
+	for _, d := range []string{project, filepath.Join(repo, ".git"), secret} {
+		require.NoError(t, os.MkdirAll(d, 0755))
+	}
+	// Symlink inside the root that points outside of it.
+	require.NoError(t, os.Symlink(secret, filepath.Join(root, "escape")))
+	// Symlink inside the root that stays inside.
+	require.NoError(t, os.Symlink(project, filepath.Join(root, "alias")))
+
+	tests := []struct {
+		name      string
+		policy    Policy
+		requested string
+		want      string
+		wantErr   error
+	}{
+		{"inside root", Policy{Roots: []string{root}}, project, project, nil},
+		{"root itself", Policy{Roots: []string{root}}, root, root, nil},
+		{"relative to base", Policy{Roots: []string{root}}, "project", project, nil},
+		{"dotdot traversal", Policy{Roots: []string{root}}, filepath.Join(project, "..", "..", "secret"), "", ErrForbidden},
+		{"relative traversal", Policy{Roots: []string{root}}, "../secret", "", ErrForbidden},
+		{"filesystem root", Policy{Roots: []string{root}}, "/", "", ErrForbidden},
+		{"sibling with shared prefix", Policy{Roots: []string{root}}, root + "-other", "", ErrForbidden},
+		{"symlink escape", Policy{Roots: []string{root}}, filepath.Join(root, "escape"), "", ErrForbidden},
+		{"symlink escape via child", Policy{Roots: []string{root}}, filepath.Join(root, "escape", "keys"), "", ErrForbidden},
+		{"symlink inside", Policy{Roots: []string{root}}, filepath.Join(root, "alias"), project, nil},
+		{"missing dir allowed", Policy{Roots: []string{root}}, filepath.Join(root, "new"), filepath.Join(root, "new"), nil},
+		{"missing dir rejected", Policy{Roots: []string{root}, RequireExists: true}, filepath.Join(root, "new"), "", ErrInvalid},
+		{"git required, not a repo", Policy{Roots: []string{root}, RequireGit: true}, project, "", ErrInvalid},
+		{"git required, repo", Policy{Roots: []string{root}, RequireGit: true}, repo, repo, nil},
+		{"no roots is unrestricted", Policy{}, secret, secret, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.Resolve(tt.requested, root)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	assert.Equal(t, "/foo", ExpandHome("/foo"))
+	assert.Equal(t, home, ExpandHome("~"))
+	assert.Equal(t, filepath.Join(home, "dev"), ExpandHome("~/dev"))
+}
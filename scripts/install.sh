@@ -38,10 +38,10 @@ echo "  1. Authenticate: openclaw-cursor login"
 echo "  2. Start proxy: openclaw-cursor start"
 echo "  3. Configure OpenClaw to use: http://127.0.0.1:32125"
 echo ""
-echo "If OpenClaw cron jobs fail with WhatsApp delivery errors, run (from this repo):"
-echo "  node scripts/fix-cron-delivery.js --dry-run   # preview"
-echo "  node scripts/fix-cron-delivery.js            # apply"
+echo "If OpenClaw cron jobs fail with WhatsApp delivery errors, run:"
+echo "  openclaw-cursor cron fix-delivery --to <telegram-id> --dry-run   # preview"
+echo "  openclaw-cursor cron fix-delivery --to <telegram-id>             # apply"
 echo ""
 echo "To set all cron jobs to cursor/auto (same as heartbeat):"
-echo "  node scripts/set-cron-model.js --dry-run   # preview"
-echo "  node scripts/set-cron-model.js             # apply"
+echo "  openclaw-cursor cron set-model --dry-run   # preview"
+echo "  openclaw-cursor cron set-model             # apply"